@@ -39,7 +39,7 @@ func main() {
 		respArray.Values = make([]resp.Value, len(parts))
 
 		for i, part := range parts {
-			respArray.Values[i] = resp.BulkString{Value: part}
+			respArray.Values[i] = resp.NewBulkString(part)
 		}
 
 		_, err = writer.Write(resp.Serialize(respArray))
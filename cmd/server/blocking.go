@@ -0,0 +1,406 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"redis-lite/kvstore"
+	"redis-lite/resp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	registerCommands(
+		&command{name: "blpop", arity: -3, flags: []string{flagWrite, flagBlocking},
+			firstKey: 1, lastKey: -2, keyStep: 1,
+			group: "list", since: "2.0.0", args: "<key> [key ...] <timeout>",
+			summary: "Removes and returns the first element in a list, blocking until one is available",
+			handler: (*RedisServer).handleBlockingPop},
+		&command{name: "brpop", arity: -3, flags: []string{flagWrite, flagBlocking},
+			firstKey: 1, lastKey: -2, keyStep: 1,
+			group: "list", since: "2.0.0", args: "<key> [key ...] <timeout>",
+			summary: "Removes and returns the last element in a list, blocking until one is available",
+			handler: (*RedisServer).handleBlockingPop},
+		&command{name: "blmove", arity: 6, flags: []string{flagWrite, flagDenyOOM, flagBlocking},
+			firstKey: 1, lastKey: 2, keyStep: 1,
+			group: "list", since: "6.2.0", args: "<source> <destination> <LEFT | RIGHT> <LEFT | RIGHT> <timeout>",
+			summary: "Pops an element from a list, pushes it to another list and returns it, blocking until one is available",
+			handler: (*RedisServer).handleBLMove},
+		&command{name: "blmpop", arity: -5, flags: []string{flagWrite, flagBlocking, flagMovableKeys},
+			group: "list", since: "7.0.0", args: "<timeout> <numkeys> <key> [key ...] <LEFT | RIGHT> [COUNT count]",
+			summary: "Pops the first or last elements from the first non-empty list, blocking until one is available",
+			handler: (*RedisServer).handleBLMPop},
+	)
+}
+
+// blockedClient is a client waiting in BLPOP, BRPOP, BLMOVE or BLMPOP for
+// one of its keys to hold a list.
+type blockedClient struct {
+	keys      []string // Keys waited on, in the order they are tried
+	extraKeys []string // Other keys pop needs, locked along with the key served from
+	// pop takes what the command wants from list, the non-empty list stored
+	// at key, and returns the reply. The transaction holds key and extraKeys.
+	pop       func(tx kvstore.Tx[object], key string, list *kvstore.Quicklist) resp.Value
+	timeout   time.Duration // How long to wait; 0 to wait forever
+	nullArray bool          // Reply with a null array on timeout, instead of a null
+
+	reply  resp.Value    // Set by whoever serves the client
+	served chan struct{} // Signalled once reply is set
+	queued bool          // Registered in blockedKeys; guarded by its mutex
+}
+
+// blockedKeys is the registry of blocked clients, keyed by the keys they wait
+// on. Each key has a queue of clients, served in the order they blocked.
+// The registry is guarded by its own mutex, which may be taken while holding
+// shard locks but never the other way round.
+type blockedKeys struct {
+	mu      sync.Mutex
+	waiting map[string][]*blockedClient
+	ready   []string    // Keys that got a list while clients were waiting on them
+	pending atomic.Bool // Whether ready is non-empty, to check without the mutex
+}
+
+// add queues b on each of its keys.
+func (bk *blockedKeys) add(b *blockedClient) {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	if bk.waiting == nil {
+		bk.waiting = make(map[string][]*blockedClient)
+	}
+	for _, key := range b.keys {
+		if !slices.Contains(bk.waiting[key], b) {
+			bk.waiting[key] = append(bk.waiting[key], b)
+		}
+	}
+	b.queued = true
+}
+
+// remove takes b off all its queues. It reports false if b was not queued
+// any more: it has already been served, or has timed out.
+func (bk *blockedKeys) remove(b *blockedClient) bool {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	if !b.queued {
+		return false
+	}
+	for _, key := range b.keys {
+		queue := slices.DeleteFunc(bk.waiting[key], func(w *blockedClient) bool { return w == b })
+		if len(queue) == 0 {
+			delete(bk.waiting, key)
+		} else {
+			bk.waiting[key] = queue
+		}
+	}
+	b.queued = false
+	return true
+}
+
+// first returns the client that has waited longest on key, or nil.
+func (bk *blockedKeys) first(key string) *blockedClient {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	if queue := bk.waiting[key]; len(queue) > 0 {
+		return queue[0]
+	}
+	return nil
+}
+
+// count returns the number of clients blocked on key.
+func (bk *blockedKeys) count(key string) int {
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	return len(bk.waiting[key])
+}
+
+// signalKeyAsReady records that a list was just stored at key, so that the
+// clients blocked on it are served once the current command completes. It is
+// called with the key's shard locked, which orders it with clients blocking
+// on the key: they either see the list or are already queued.
+func (rs *RedisServer) signalKeyAsReady(key string) {
+	bk := &rs.blocked
+	bk.mu.Lock()
+	defer bk.mu.Unlock()
+	if len(bk.waiting[key]) > 0 && !slices.Contains(bk.ready, key) {
+		bk.ready = append(bk.ready, key)
+		bk.pending.Store(true)
+	}
+}
+
+// serveBlockedClients serves the clients blocked on keys signalled as ready,
+// like Redis' handleClientsBlockedOnKeys. dispatch calls it after every
+// command, so with the single executor the clients are served before any
+// other command runs. Serving a BLMOVE may make another key ready in turn.
+func (rs *RedisServer) serveBlockedClients() {
+	bk := &rs.blocked
+	for bk.pending.Load() {
+		bk.mu.Lock()
+		keys := bk.ready
+		bk.ready = nil
+		bk.pending.Store(false)
+		bk.mu.Unlock()
+
+		for _, key := range keys {
+			for {
+				b := bk.first(key)
+				if b == nil || !rs.serveBlocked(b, key) {
+					break
+				}
+			}
+		}
+	}
+}
+
+// serveBlocked serves b from the list at key, if there is still one, and
+// reports whether it did so, or found b gone, so that the next client in the
+// queue can be tried.
+func (rs *RedisServer) serveBlocked(b *blockedClient, key string) bool {
+	tx := rs.data.Lock(append([]string{key}, b.extraKeys...)...)
+	defer tx.Unlock()
+
+	list, ok, _ := getList(tx, key)
+	if !ok {
+		return false
+	}
+	if !rs.blocked.remove(b) {
+		return true
+	}
+	// The client's connection goroutine is waiting for served and does not
+	// touch the client until then, so only it writes the reply.
+	b.reply = b.pop(tx, key, list)
+	b.served <- struct{}{}
+	return true
+}
+
+// blockingPop serves c right away from the first of b.keys holding a list,
+// like the non-blocking command would. If none does, it queues b, and the
+// connection goroutine waits for it to be served after the command returns;
+// see waitUnblocked.
+func (rs *RedisServer) blockingPop(c *client, b *blockedClient) {
+	tx := rs.data.Lock(append(slices.Clone(b.keys), b.extraKeys...)...)
+	defer tx.Unlock()
+
+	for _, key := range b.keys {
+		list, ok, errMsg := getList(tx, key)
+		switch {
+		case errMsg != "":
+			c.writeError(errMsg)
+		case ok:
+			c.writeValue(b.pop(tx, key, list))
+		default:
+			continue
+		}
+		return
+	}
+	b.served = make(chan struct{}, 1)
+	rs.blocked.add(b)
+	c.blocked = b
+}
+
+// maxBlockedInput caps how much input a blocked client may send before it is
+// disconnected, like Redis' client-query-buffer-limit.
+const maxBlockedInput = 1 << 30
+
+var errBlockedInput = errors.New("blocked client sent too much input")
+
+// waitUnblocked waits on c's connection goroutine until the client blocked
+// by its last command is served, times out or hangs up, and queues the
+// reply. It reports false if the client hung up, or sent more than
+// maxBlockedInput, and is to be disconnected.
+func (rs *RedisServer) waitUnblocked(c *client) bool {
+	b := c.blocked
+	c.blocked = nil
+	c.flush()
+
+	var timeout <-chan time.Time
+	if b.timeout > 0 {
+		timer := time.NewTimer(b.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	// Watch the connection for the client hanging up by reading it. Input
+	// the client pipelined may already be buffered in c.reader, so peeking
+	// there would not notice. What the client sends in the meantime is
+	// kept, and read once it is unblocked.
+	var input []byte
+	watch := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := c.conn.Read(buf)
+			input = append(input, buf[:n]...)
+			if err == nil && len(input) > maxBlockedInput {
+				err = errBlockedInput
+			}
+			if err != nil {
+				watch <- err
+				return
+			}
+		}
+	}()
+	defer func() {
+		if watch != nil {
+			// Interrupt the watcher before the connection is read again.
+			c.conn.SetReadDeadline(time.Now())
+			<-watch
+			c.conn.SetReadDeadline(time.Time{})
+		}
+		c.input.pending = append(c.input.pending, input...)
+	}()
+
+	for {
+		select {
+		case <-b.served:
+			c.writeValue(b.reply)
+			return true
+		case <-timeout:
+			if rs.blocked.remove(b) {
+				if b.nullArray {
+					c.writeNullArray()
+				} else {
+					c.writeValue(resp.Null{})
+				}
+				return true
+			}
+			// It is being served at this very moment.
+			timeout = nil
+		case <-watch:
+			watch = nil
+			rs.blocked.remove(b)
+			return false
+		}
+	}
+}
+
+// parseTimeout parses the timeout of a blocking command, in seconds with
+// decimals. On failure it returns the error reply to send.
+func parseTimeout(arg []byte) (time.Duration, string) {
+	secs, ok := parseFloat(arg)
+	switch {
+	case !ok || math.IsInf(secs, 0):
+		return 0, "ERR timeout is not a float or out of range"
+	case secs < 0:
+		return 0, "ERR timeout is negative"
+	case secs*1000 > math.MaxInt64:
+		return 0, "ERR timeout is out of range"
+	}
+	// Timeouts beyond what a Duration holds, some 292 years, are capped.
+	return time.Duration(min(secs*float64(time.Second), math.MaxInt64)), ""
+}
+
+// handleBlockingPop implements BLPOP and BRPOP key [key ...] timeout. The
+// reply is the key popped from and the element, or a null array on timeout.
+func (rs *RedisServer) handleBlockingPop(c *client, args [][]byte) {
+	timeout, errMsg := parseTimeout(args[len(args)-1])
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	left := strings.EqualFold(string(args[0]), "blpop")
+
+	rs.blockingPop(c, &blockedClient{
+		keys: stringKeys(args[1 : len(args)-1]),
+		pop: func(tx kvstore.Tx[object], key string, list *kvstore.Quicklist) resp.Value {
+			v := listPop(list, left)
+			if list.Len() == 0 {
+				tx.Delete(key)
+			}
+			return resp.Array{Values: []resp.Value{resp.NewBulkString(key), resp.BulkString{Value: v}}}
+		},
+		timeout:   timeout,
+		nullArray: true,
+	})
+}
+
+// handleBLMove implements BLMOVE source destination LEFT|RIGHT LEFT|RIGHT
+// timeout, the blocking LMOVE. It replies with a null on timeout.
+func (rs *RedisServer) handleBLMove(c *client, args [][]byte) {
+	fromLeft, ok := parseListEnd(args[3])
+	toLeft, ok2 := parseListEnd(args[4])
+	if !ok || !ok2 {
+		c.writeError("ERR syntax error")
+		return
+	}
+	timeout, errMsg := parseTimeout(args[5])
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+
+	dst := string(args[2])
+	rs.blockingPop(c, &blockedClient{
+		keys:      []string{string(args[1])},
+		extraKeys: []string{dst},
+		pop: func(tx kvstore.Tx[object], key string, list *kvstore.Quicklist) resp.Value {
+			return rs.lmove(tx, key, list, dst, fromLeft, toLeft)
+		},
+		timeout: timeout,
+	})
+}
+
+// handleBLMPop implements BLMPOP timeout numkeys key [key ...] LEFT|RIGHT
+// [COUNT count]. It pops up to count elements, 1 by default, from the first
+// list, and replies with its key and the elements, or a null array on
+// timeout.
+func (rs *RedisServer) handleBLMPop(c *client, args [][]byte) {
+	numKeys, ok := parseInt64(args[2])
+	switch {
+	case !ok:
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	case numKeys <= 0:
+		c.writeError("ERR numkeys should be greater than 0")
+		return
+	case numKeys > int64(len(args)-4):
+		c.writeError("ERR syntax error")
+		return
+	}
+	keys := stringKeys(args[3 : 3+numKeys])
+	rest := args[3+numKeys:]
+
+	left, ok := parseListEnd(rest[0])
+	if !ok {
+		c.writeError("ERR syntax error")
+		return
+	}
+	count := int64(1)
+	switch {
+	case len(rest) == 1:
+	case len(rest) == 3 && strings.EqualFold(string(rest[1]), "COUNT"):
+		if count, ok = parseInt64(rest[2]); !ok {
+			c.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		if count <= 0 {
+			c.writeError("ERR count should be greater than 0")
+			return
+		}
+	default:
+		c.writeError("ERR syntax error")
+		return
+	}
+	timeout, errMsg := parseTimeout(args[1])
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+
+	rs.blockingPop(c, &blockedClient{
+		keys: keys,
+		pop: func(tx kvstore.Tx[object], key string, list *kvstore.Quicklist) resp.Value {
+			values := make([]resp.Value, 0, min(count, int64(list.Len())))
+			for n := count; n > 0 && list.Len() > 0; n-- {
+				values = append(values, resp.BulkString{Value: listPop(list, left)})
+			}
+			if list.Len() == 0 {
+				tx.Delete(key)
+			}
+			return resp.Array{Values: []resp.Value{resp.NewBulkString(key), resp.Array{Values: values}}}
+		},
+		timeout:   timeout,
+		nullArray: true,
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// waitBlocked waits until n clients are blocked on key.
+func waitBlocked(t *testing.T, rs *RedisServer, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for rs.blocked.count(key) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d clients blocked on %q; want %d", rs.blocked.count(key), key, n)
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestBlockingPop_WokenByPush(t *testing.T) {
+	for _, mode := range []ExecMode{ExecLocking, ExecSingle} {
+		t.Run(mode.String(), func(t *testing.T) {
+			rs := NewRedisServer(ServerOptions{Exec: mode})
+			waiter, pusher := newTestConn(t, rs), newTestConn(t, rs)
+
+			// A list that exists is popped right away, trying keys in order.
+			pusher.do("RPUSH", "b", "1", "2")
+			assertReply(t, waiter.do("BLPOP", "a", "b", "0"), bulks("b", "1"))
+			assertReply(t, waiter.do("BRPOP", "a", "b", "0"), bulks("b", "2"))
+			assertReply(t, pusher.do("EXISTS", "b"), resp.Integer{Value: 0})
+
+			waiter.send("BRPOP", "a", "b", "0")
+			waitBlocked(t, rs, "b", 1)
+			assertReply(t, pusher.do("RPUSH", "b", "x", "y"), resp.Integer{Value: 2})
+			assertReply(t, waiter.read(), bulks("b", "y"))
+			assertReply(t, pusher.do("LRANGE", "b", "0", "-1"), bulks("x"))
+			if rs.blocked.count("a") != 0 {
+				t.Errorf("served client still blocked on its other key")
+			}
+
+			// Clients blocked on the same key are served in the order they
+			// blocked.
+			others := []*testConn{newTestConn(t, rs), newTestConn(t, rs), newTestConn(t, rs)}
+			for i, tc := range others {
+				tc.send("BLPOP", "q", "0")
+				waitBlocked(t, rs, "q", i+1)
+			}
+			pusher.do("RPUSH", "q", "first", "second")
+			assertReply(t, others[0].read(), bulks("q", "first"))
+			assertReply(t, others[1].read(), bulks("q", "second"))
+			waitBlocked(t, rs, "q", 1)
+			pusher.do("LPUSH", "q", "third")
+			assertReply(t, others[2].read(), bulks("q", "third"))
+
+			// A blocked client answers the commands it pipelined once it is
+			// served.
+			waiter.send("BLPOP", "p", "0")
+			waiter.send("PING")
+			waitBlocked(t, rs, "p", 1)
+			pusher.do("RPUSH", "p", "v")
+			assertReply(t, waiter.read(), bulks("p", "v"))
+			assertReply(t, waiter.read(), resp.SimpleString{Value: "PONG"})
+		})
+	}
+}
+
+func TestBlockingPop_Timeout(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	start := time.Now()
+	assertReply(t, tc.do("BLPOP", "k", "0.05"), resp.Array{IsNull: true})
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("BLPOP timed out after %v; want at least 50ms", elapsed)
+	}
+	assertReply(t, tc.do("BLMOVE", "k", "d", "LEFT", "LEFT", "0.01"), resp.BulkString{IsNull: true})
+	assertReply(t, tc.do("BLMPOP", "0.01", "1", "k", "LEFT"), resp.Array{IsNull: true})
+
+	assertReply(t, tc.do("BLPOP", "k", "-1"), resp.Error{Value: "ERR timeout is negative"})
+	assertReply(t, tc.do("BLPOP", "k", "soon"), resp.Error{Value: "ERR timeout is not a float or out of range"})
+	tc.do("SET", "s", "v")
+	assertReply(t, tc.do("BLPOP", "k", "s", "0"), resp.Error{Value: errWrongType})
+
+	tc.do("HELLO", "3")
+	assertReply(t, tc.do("BRPOP", "k", "0.01"), resp.Null{})
+}
+
+func TestBlockingPop_Disconnect(t *testing.T) {
+	rs := NewRedisServer()
+	waiter, pusher := newTestConn(t, rs), newTestConn(t, rs)
+
+	waiter.send("BLPOP", "k", "0")
+	waitBlocked(t, rs, "k", 1)
+	waiter.conn.Close()
+	waitBlocked(t, rs, "k", 0)
+
+	// Nobody is left to take the element.
+	pusher.do("RPUSH", "k", "v")
+	assertReply(t, pusher.do("LLEN", "k"), resp.Integer{Value: 1})
+
+	// A hang-up is noticed even when the client pipelined more commands,
+	// which are buffered by the time it blocks.
+	pipelined := newTestConn(t, rs)
+	both := append(resp.Serialize(bulks("BLPOP", "dk", "0")), resp.Serialize(bulks("PING"))...)
+	if _, err := pipelined.conn.Write(both); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	waitBlocked(t, rs, "dk", 1)
+	pipelined.conn.Close()
+	waitBlocked(t, rs, "dk", 0)
+	assertReply(t, pusher.do("RPUSH", "dk", "v"), resp.Integer{Value: 1})
+	assertReply(t, pusher.do("LLEN", "dk"), resp.Integer{Value: 1})
+}
+
+func TestBlockingPop_InputWhileBlocked(t *testing.T) {
+	rs := NewRedisServer()
+	waiter, pusher := newTestConn(t, rs), newTestConn(t, rs)
+
+	// Commands sent while blocked, and ones pipelined before, are run in
+	// order once the client is unblocked.
+	waiter.send("BLPOP", "k", "0")
+	waiter.send("ECHO", "first")
+	waitBlocked(t, rs, "k", 1)
+	waiter.send("ECHO", "second")
+	waiter.send("SET", "s", "v")
+	pusher.do("RPUSH", "k", "v")
+	assertReply(t, waiter.read(), bulks("k", "v"))
+	assertReply(t, waiter.read(), resp.BulkString{Value: []byte("first")})
+	assertReply(t, waiter.read(), resp.BulkString{Value: []byte("second")})
+	assertReply(t, waiter.read(), resp.SimpleString{Value: "OK"})
+
+	// So are commands sent by a client that times out.
+	waiter.send("BRPOP", "k", "0.01")
+	waiter.send("GET", "s")
+	assertReply(t, waiter.read(), resp.Array{IsNull: true})
+	assertReply(t, waiter.read(), resp.BulkString{Value: []byte("v")})
+}
+
+func TestBLMove(t *testing.T) {
+	rs := NewRedisServer()
+	mover, waiter, pusher := newTestConn(t, rs), newTestConn(t, rs), newTestConn(t, rs)
+
+	pusher.do("RPUSH", "src", "a")
+	assertReply(t, mover.do("BLMOVE", "src", "dst", "LEFT", "RIGHT", "0"), resp.BulkString{Value: []byte("a")})
+	assertReply(t, pusher.do("LRANGE", "dst", "0", "-1"), bulks("a"))
+	pusher.do("DEL", "dst")
+
+	// The element moved by a blocked BLMOVE wakes a client blocked on the
+	// destination in turn.
+	mover.send("BLMOVE", "src", "dst", "RIGHT", "LEFT", "0")
+	waitBlocked(t, rs, "src", 1)
+	waiter.send("BLPOP", "dst", "0")
+	waitBlocked(t, rs, "dst", 1)
+	pusher.do("RPUSH", "src", "x", "y")
+	assertReply(t, mover.read(), resp.BulkString{Value: []byte("y")})
+	assertReply(t, waiter.read(), bulks("dst", "y"))
+	assertReply(t, pusher.do("LRANGE", "src", "0", "-1"), bulks("x"))
+	assertReply(t, pusher.do("EXISTS", "dst"), resp.Integer{Value: 0})
+
+	// A list renamed into place wakes clients too.
+	waiter.send("BLPOP", "renamed", "0")
+	waitBlocked(t, rs, "renamed", 1)
+	pusher.do("RENAME", "src", "renamed")
+	assertReply(t, waiter.read(), bulks("renamed", "x"))
+
+	assertReply(t, mover.do("BLMOVE", "src", "dst", "UP", "LEFT", "0"), resp.Error{Value: "ERR syntax error"})
+}
+
+func TestBLMPop(t *testing.T) {
+	rs := NewRedisServer()
+	waiter, pusher := newTestConn(t, rs), newTestConn(t, rs)
+	pusher.do("RPUSH", "b", "1", "2", "3")
+
+	assertReply(t, waiter.do("BLMPOP", "0", "2", "a", "b", "RIGHT", "COUNT", "2"),
+		resp.Array{Values: []resp.Value{resp.NewBulkString("b"), bulks("3", "2")}})
+	assertReply(t, waiter.do("BLMPOP", "0", "2", "a", "b", "LEFT", "COUNT", "5"),
+		resp.Array{Values: []resp.Value{resp.NewBulkString("b"), bulks("1")}})
+
+	waiter.send("BLMPOP", "0", "2", "a", "b", "LEFT")
+	waitBlocked(t, rs, "a", 1)
+	pusher.do("LPUSH", "a", "x", "y")
+	assertReply(t, waiter.read(), resp.Array{Values: []resp.Value{resp.NewBulkString("a"), bulks("y")}})
+
+	assertReply(t, waiter.do("BLMPOP", "0", "0", "a", "LEFT"), resp.Error{Value: "ERR numkeys should be greater than 0"})
+	assertReply(t, waiter.do("BLMPOP", "0", "3", "a", "LEFT"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, waiter.do("BLMPOP", "0", "1", "a", "UP"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, waiter.do("BLMPOP", "0", "1", "a", "LEFT", "COUNT", "0"), resp.Error{Value: "ERR count should be greater than 0"})
+	assertReply(t, waiter.do("BLMPOP", "0", "1", "a", "LEFT", "COUNT"), resp.Error{Value: "ERR syntax error"})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"log"
+	"net"
+	"redis-lite/resp"
+)
+
+const (
+	// replyBufferSize is the size of a client's output buffer. Replies that
+	// do not fit are written out as the buffer fills.
+	replyBufferSize = 16 * 1024
+	// replyFlushThreshold is how many bytes of replies may be held back while
+	// pipelined commands are still waiting to be processed.
+	replyFlushThreshold = 8 * 1024
+)
+
+// client holds the per-connection state of a single client.
+type client struct {
+	id     int64
+	conn   net.Conn
+	reader *bufio.Reader // Reads from input
+	input  *connReader
+	out    *resp.Writer  // Encodes for the protocol negotiated with HELLO, RESP2 by default
+	name   string        // Set with HELLO ... SETNAME
+	done   chan struct{} // Signalled by the executor when a command has run
+	// blocked is set by a blocking command that found nothing to pop; the
+	// connection goroutine then waits for it to be served.
+	blocked *blockedClient
+}
+
+func newClient(id int64, conn net.Conn) *client {
+	input := &connReader{conn: conn}
+	return &client{
+		id:     id,
+		conn:   conn,
+		reader: bufio.NewReader(input),
+		input:  input,
+		out:    resp.NewWriter(bufio.NewWriterSize(conn, replyBufferSize)),
+		done:   make(chan struct{}, 1),
+	}
+}
+
+// connReader reads a client's connection. Input read off the connection
+// ahead of time, while the client was blocked, is kept in pending and read
+// first.
+type connReader struct {
+	conn    net.Conn
+	pending []byte
+}
+
+func (r *connReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		return r.conn.Read(p)
+	}
+	n := copy(p, r.pending)
+	if r.pending = r.pending[n:]; len(r.pending) == 0 {
+		r.pending = nil
+	}
+	return n, nil
+}
+
+// writeValue queues a reply. All replies go through c.out, which is the
+// single place they are encoded: handlers may build replies from any RESP3
+// type, and clients still speaking RESP2 receive the equivalent RESP2
+// encoding.
+func (c *client) writeValue(v resp.Value) {
+	c.logWriteError(c.out.WriteValue(v))
+}
+
+// writeBulk queues b as a bulk string reply without copying it.
+func (c *client) writeBulk(b []byte) {
+	c.logWriteError(c.out.WriteBulk(b))
+}
+
+// writeBulkString queues s as a bulk string reply without copying it.
+func (c *client) writeBulkString(s string) {
+	c.logWriteError(c.out.WriteBulkString(s))
+}
+
+// writeArrayHeader starts an array reply of n elements, to be followed by
+// the elements themselves, so that large replies are streamed out instead of
+// being built up front.
+func (c *client) writeArrayHeader(n int) {
+	c.logWriteError(c.out.WriteArrayHeader(n))
+}
+
+// writeMapHeader starts a map reply of n key/value pairs, which RESP2
+// clients receive as an array of 2n elements.
+func (c *client) writeMapHeader(n int) {
+	c.logWriteError(c.out.WriteMapHeader(n))
+}
+
+// writeNullArray queues the null reply of commands that otherwise reply with
+// an array: *-1 in RESP2 and _ in RESP3.
+func (c *client) writeNullArray() {
+	if c.out.Protocol() >= resp.RESP3 {
+		c.writeValue(resp.Null{})
+	} else {
+		c.writeValue(resp.Array{IsNull: true})
+	}
+}
+
+func (c *client) writeError(errorStr string) {
+	c.logWriteError(c.out.WriteError(errorStr))
+}
+
+// flush sends all queued replies to the client.
+func (c *client) flush() {
+	c.logWriteError(c.out.Flush())
+}
+
+// flushIfIdle sends the queued replies once every command the client has
+// sent so far was processed, or once enough replies have piled up. Pipelined
+// commands arriving together are thus answered with a single write, instead
+// of one write per command. A command cut off by the end of the read buffer
+// has been sent in full by the client, so waiting for the rest of it does
+// not hold the replies back for long.
+func (c *client) flushIfIdle() {
+	if c.reader.Buffered() == 0 || c.out.Buffered() >= replyFlushThreshold {
+		c.flush()
+	}
+}
+
+// logWriteError logs a failed write. Write errors are sticky, so handlers
+// can keep writing and the connection loop notices on its next read.
+func (c *client) logWriteError(err error) {
+	if err != nil {
+		log.Printf("Error sending reply to %s: %v", c.conn.RemoteAddr(), err)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"redis-lite/resp"
+	"sort"
+	"strings"
+)
+
+// Command flags, named as in Redis' COMMAND output.
+const (
+	flagWrite    = "write"
+	flagReadonly = "readonly"
+	flagDenyOOM  = "denyoom"
+	flagAdmin    = "admin"
+	flagFast     = "fast"
+	flagLoading  = "loading"
+	flagStale    = "stale"
+	flagNoScript = "noscript"
+	flagBlocking = "blocking"
+	// flagMovableKeys marks commands whose key positions depend on their
+	// arguments, which firstKey, lastKey and keyStep cannot describe.
+	flagMovableKeys = "movablekeys"
+)
+
+// command describes a server command. The table of commands drives
+// dispatch, arity checking, COMMAND introspection and HELP.
+type command struct {
+	name  string // Lower-case command name
+	arity int    // Argument count including the name; negative means "at least -arity"
+	// maxArgs caps the argument count of a command with a negative arity.
+	// Zero means no cap. Like Redis, COMMAND reports only the arity.
+	maxArgs int
+	flags   []string // Any of the flag* constants
+	// Positions of the key arguments: first, last (negative counts from the
+	// end) and the step between them. All zero for commands without keys.
+	firstKey, lastKey, keyStep int
+
+	group   string // Documentation group, e.g. "string" or "connection"
+	since   string // Redis version that introduced the command
+	args    string // Argument synopsis for HELP, e.g. "key value"
+	summary string
+
+	handler func(rs *RedisServer, c *client, args [][]byte)
+}
+
+// commandTable maps lower-case command names to their descriptions.
+var commandTable = map[string]*command{}
+
+// registerCommands adds commands to the command table. Each file that
+// implements a group of commands registers them from its init function.
+func registerCommands(cmds ...*command) {
+	for _, cmd := range cmds {
+		if _, dup := commandTable[cmd.name]; dup {
+			panic("command registered twice: " + cmd.name)
+		}
+		commandTable[cmd.name] = cmd
+	}
+}
+
+func init() {
+	registerCommands(
+		&command{name: "ping", arity: -1, maxArgs: 2, flags: []string{flagFast, flagStale},
+			group: "connection", since: "1.0.0", args: "[message]",
+			summary: "Returns PONG, or the message if one is given",
+			handler: (*RedisServer).handlePing},
+		&command{name: "echo", arity: 2, flags: []string{flagFast},
+			group: "connection", since: "1.0.0", args: "<message>",
+			summary: "Returns the provided message",
+			handler: (*RedisServer).handleEcho},
+		&command{name: "hello", arity: -1, flags: []string{flagNoScript, flagLoading, flagStale, flagFast},
+			group: "connection", since: "6.0.0", args: "[protover [AUTH username password] [SETNAME clientname]]",
+			summary: "Switches protocol and returns server info",
+			handler: (*RedisServer).handleHello},
+		&command{name: "help", arity: 1, flags: []string{flagLoading, flagStale},
+			group: "server", since: "1.0.0",
+			summary: "Shows available commands and their usage",
+			handler: (*RedisServer).handleHelp},
+		&command{name: "command", arity: -1, flags: []string{flagLoading, flagStale},
+			group: "server", since: "2.8.13", args: "[COUNT | INFO [command ...] | DOCS [command ...]]",
+			summary: "Returns details about server commands",
+			handler: (*RedisServer).handleCommand},
+	)
+}
+
+// lookupCommand finds a command by name, ignoring case.
+func lookupCommand(name []byte) *command {
+	return commandTable[strings.ToLower(string(name))]
+}
+
+// sortedCommands returns every command ordered by name.
+func sortedCommands() []*command {
+	cmds := make([]*command, 0, len(commandTable))
+	for _, cmd := range commandTable {
+		cmds = append(cmds, cmd)
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].name < cmds[j].name })
+	return cmds
+}
+
+func (cmd *command) hasFlag(flag string) bool {
+	for _, f := range cmd.flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// arityOK reports whether argc arguments (including the name) are valid.
+func (cmd *command) arityOK(argc int) bool {
+	if cmd.arity >= 0 {
+		return argc == cmd.arity
+	}
+	return argc >= -cmd.arity && (cmd.maxArgs == 0 || argc <= cmd.maxArgs)
+}
+
+// dispatch looks up and runs the command in args, replying with an error if
+// the command is unknown or called with the wrong number of arguments.
+func (rs *RedisServer) dispatch(c *client, args [][]byte) {
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		var prefix strings.Builder
+		for _, arg := range args[1:] {
+			fmt.Fprintf(&prefix, "'%s' ", arg)
+		}
+		c.writeError(fmt.Sprintf("ERR unknown command '%s', with args beginning with: %s", args[0], prefix.String()))
+		return
+	}
+	if !cmd.arityOK(len(args)) {
+		c.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmd.name))
+		return
+	}
+	cmd.handler(rs, c, args)
+	rs.serveBlockedClients()
+}
+
+// handleCommand implements COMMAND [COUNT | INFO [command ...] | DOCS [command ...] | HELP].
+func (rs *RedisServer) handleCommand(c *client, args [][]byte) {
+	if len(args) == 1 {
+		cmds := sortedCommands()
+		values := make([]resp.Value, len(cmds))
+		for i, cmd := range cmds {
+			values[i] = cmd.info()
+		}
+		c.writeValue(resp.Array{Values: values})
+		return
+	}
+
+	sub := strings.ToUpper(string(args[1]))
+	switch {
+	case sub == "COUNT" && len(args) == 2:
+		c.writeValue(resp.Integer{Value: int64(len(commandTable))})
+	case sub == "INFO":
+		cmds := sortedCommands()
+		if len(args) > 2 {
+			cmds = make([]*command, len(args)-2)
+			for i, name := range args[2:] {
+				cmds[i] = lookupCommand(name)
+			}
+		}
+		values := make([]resp.Value, len(cmds))
+		for i, cmd := range cmds {
+			if cmd == nil {
+				values[i] = resp.Null{}
+			} else {
+				values[i] = cmd.info()
+			}
+		}
+		c.writeValue(resp.Array{Values: values})
+	case sub == "DOCS":
+		cmds := sortedCommands()
+		if len(args) > 2 {
+			cmds = cmds[:0]
+			for _, name := range args[2:] {
+				// Unknown commands are left out of the reply.
+				if cmd := lookupCommand(name); cmd != nil {
+					cmds = append(cmds, cmd)
+				}
+			}
+		}
+		entries := make([]resp.MapEntry, len(cmds))
+		for i, cmd := range cmds {
+			entries[i] = resp.MapEntry{Key: resp.NewBulkString(cmd.name), Value: cmd.docs()}
+		}
+		c.writeValue(resp.Map{Entries: entries})
+	case sub == "HELP" && len(args) == 2:
+		lines := []string{
+			"COMMAND <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"(no subcommand)",
+			"    Return details about all commands.",
+			"COUNT",
+			"    Return the total number of commands in this server.",
+			"INFO [<command-name> ...]",
+			"    Return details about multiple commands.",
+			"    If no command names are given, details for all commands are",
+			"    returned.",
+			"DOCS [<command-name> ...]",
+			"    Return documentation details about multiple commands.",
+			"    If no command names are given, documentation details for all",
+			"    commands are returned.",
+		}
+		values := make([]resp.Value, len(lines))
+		for i, line := range lines {
+			values[i] = resp.SimpleString{Value: line}
+		}
+		c.writeValue(resp.Array{Values: values})
+	default:
+		c.writeError(fmt.Sprintf("ERR unknown subcommand or wrong number of arguments for '%s'. Try COMMAND HELP.", args[1]))
+	}
+}
+
+// info returns the COMMAND INFO entry for cmd.
+func (cmd *command) info() resp.Value {
+	flags := make([]resp.Value, len(cmd.flags))
+	for i, f := range cmd.flags {
+		flags[i] = resp.SimpleString{Value: f}
+	}
+	categories := cmd.aclCategories()
+	cats := make([]resp.Value, len(categories))
+	for i, cat := range categories {
+		cats[i] = resp.SimpleString{Value: cat}
+	}
+	return resp.Array{Values: []resp.Value{
+		resp.NewBulkString(cmd.name),
+		resp.Integer{Value: int64(cmd.arity)},
+		resp.Set{Values: flags},
+		resp.Integer{Value: int64(cmd.firstKey)},
+		resp.Integer{Value: int64(cmd.lastKey)},
+		resp.Integer{Value: int64(cmd.keyStep)},
+		resp.Set{Values: cats},
+		resp.Array{Values: []resp.Value{}}, // Tips
+		resp.Array{Values: []resp.Value{}}, // Key specifications
+		resp.Array{Values: []resp.Value{}}, // Subcommands
+	}}
+}
+
+// aclCategories derives the ACL categories Redis would report for cmd.
+func (cmd *command) aclCategories() []string {
+	cats := []string{"@" + cmd.group}
+	switch {
+	case cmd.hasFlag(flagWrite):
+		cats = append(cats, "@write")
+	case cmd.hasFlag(flagReadonly):
+		cats = append(cats, "@read")
+	}
+	if cmd.hasFlag(flagAdmin) {
+		cats = append(cats, "@admin", "@dangerous")
+	}
+	if cmd.hasFlag(flagBlocking) {
+		cats = append(cats, "@blocking")
+	}
+	if cmd.hasFlag(flagFast) {
+		cats = append(cats, "@fast")
+	} else {
+		cats = append(cats, "@slow")
+	}
+	return cats
+}
+
+// docs returns the COMMAND DOCS entry for cmd.
+func (cmd *command) docs() resp.Value {
+	return resp.Map{Entries: []resp.MapEntry{
+		{Key: resp.NewBulkString("summary"), Value: resp.NewBulkString(cmd.summary)},
+		{Key: resp.NewBulkString("since"), Value: resp.NewBulkString(cmd.since)},
+		{Key: resp.NewBulkString("group"), Value: resp.NewBulkString(cmd.group)},
+		{Key: resp.NewBulkString("syntax"), Value: resp.NewBulkString(cmd.synopsis())},
+	}}
+}
+
+// synopsis returns the usage line of cmd, e.g. "SET <key> <value>".
+func (cmd *command) synopsis() string {
+	if cmd.args == "" {
+		return strings.ToUpper(cmd.name)
+	}
+	return strings.ToUpper(cmd.name) + " " + cmd.args
+}
+
+// handleHelp lists every command with its usage, generated from the command
+// table.
+func (rs *RedisServer) handleHelp(c *client, args [][]byte) {
+	var help strings.Builder
+	for i, cmd := range sortedCommands() {
+		if i > 0 {
+			help.WriteByte('\n')
+		}
+		help.WriteString(cmd.synopsis())
+		help.WriteString(": ")
+		help.WriteString(cmd.summary)
+	}
+	c.writeValue(resp.NewBulkString(help.String()))
+}
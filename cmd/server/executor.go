@@ -0,0 +1,82 @@
+package main
+
+import "fmt"
+
+// ExecMode selects how commands are executed.
+type ExecMode int
+
+const (
+	// ExecLocking runs each command on its connection's goroutine. Commands
+	// on different connections run in parallel, kept safe by the keyspace's
+	// per-shard locks.
+	ExecLocking ExecMode = iota
+	// ExecSingle runs every command, and the background maintenance, on a
+	// single executor goroutine, one at a time, as Redis does. Connection
+	// goroutines only parse commands and write replies. No command ever sees
+	// the effects of another one half applied.
+	ExecSingle
+)
+
+// ParseExecMode parses "locking" or "single".
+func ParseExecMode(s string) (ExecMode, error) {
+	switch s {
+	case "locking":
+		return ExecLocking, nil
+	case "single":
+		return ExecSingle, nil
+	}
+	return 0, fmt.Errorf("unknown execution mode %q", s)
+}
+
+func (m ExecMode) String() string {
+	if m == ExecSingle {
+		return "single"
+	}
+	return "locking"
+}
+
+// execRequest is a unit of work for the executor: a command from a client,
+// or a server task when task is set. done is signalled once it has run.
+type execRequest struct {
+	c    *client
+	args [][]byte
+	task func()
+	done chan struct{}
+}
+
+// executor applies requests in the order they arrive until the process
+// exits. It only runs in ExecSingle mode.
+func (rs *RedisServer) executor() {
+	for req := range rs.requests {
+		if req.task != nil {
+			req.task()
+		} else {
+			rs.dispatch(req.c, req.args)
+		}
+		req.done <- struct{}{}
+	}
+}
+
+// execute runs a command for c and returns once its replies are queued on
+// c. With the single executor, the command is handed over and the calling
+// connection goroutine waits; c is not touched by anyone else meanwhile.
+func (rs *RedisServer) execute(c *client, args [][]byte) {
+	if rs.requests == nil {
+		rs.dispatch(c, args)
+		return
+	}
+	rs.requests <- execRequest{c: c, args: args, done: c.done}
+	<-c.done
+}
+
+// runTask runs server-side work such as the cron cycles, on the executor
+// when there is one so that it is ordered with client commands.
+func (rs *RedisServer) runTask(task func()) {
+	if rs.requests == nil {
+		task()
+		return
+	}
+	done := make(chan struct{}, 1)
+	rs.requests <- execRequest{task: task, done: done}
+	<-done
+}
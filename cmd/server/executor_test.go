@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"os"
+	"redis-lite/resp"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestExecModes_ConcurrentClients(t *testing.T) {
+	for _, mode := range []ExecMode{ExecLocking, ExecSingle} {
+		t.Run(mode.String(), func(t *testing.T) {
+			rs := NewRedisServer(ServerOptions{Exec: mode})
+
+			var wg sync.WaitGroup
+			for w := 0; w < 8; w++ {
+				tc := newTestConn(t, rs)
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < 50; i++ {
+						key := "key:" + strconv.Itoa(w) + ":" + strconv.Itoa(i)
+						tc.do("SET", key, key)
+						assertReply(t, tc.do("GET", key), resp.BulkString{Value: []byte(key)})
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			tc := newTestConn(t, rs)
+			assertReply(t, tc.do("DBSIZE"), resp.Integer{Value: 400})
+		})
+	}
+}
+
+func TestExecSingle_TasksAreSerialized(t *testing.T) {
+	rs := NewRedisServer(ServerOptions{Exec: ExecSingle})
+	tc := newTestConn(t, rs)
+
+	// While a task runs on the executor, commands wait for it to finish.
+	started, release := make(chan struct{}), make(chan struct{})
+	go rs.runTask(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	replied := make(chan resp.Value, 1)
+	go func() {
+		tc.conn.Write(resp.Serialize(resp.Array{Values: []resp.Value{
+			resp.NewBulkString("SET"), resp.NewBulkString("k"), resp.NewBulkString("v"),
+		}}))
+		reply, _ := resp.Deserialize(tc.reader)
+		replied <- reply
+	}()
+	for len(rs.requests) == 0 {
+		runtime.Gosched()
+	}
+	select {
+	case <-replied:
+		t.Fatalf("SET completed while a task held the executor")
+	default:
+	}
+	close(release)
+
+	assertReply(t, <-replied, resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("GET", "k"), resp.BulkString{Value: []byte("v")})
+}
+
+func TestParseExecMode(t *testing.T) {
+	for _, mode := range []ExecMode{ExecLocking, ExecSingle} {
+		if got, err := ParseExecMode(mode.String()); err != nil || got != mode {
+			t.Errorf("ParseExecMode(%q) = %v, %v; want %v", mode.String(), got, err, mode)
+		}
+	}
+	if _, err := ParseExecMode("threads"); err == nil {
+		t.Errorf("ParseExecMode(threads) succeeded; want an error")
+	}
+}
+
+// SET and GET from GOMAXPROCS clients under each execution model, e.g.
+// go test -bench ExecModes -cpu 1,4,8 ./cmd/server.
+func BenchmarkExecModes(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, mode := range []ExecMode{ExecLocking, ExecSingle} {
+		b.Run(mode.String(), func(b *testing.B) {
+			rs := NewRedisServer(ServerOptions{Exec: mode})
+			var clients atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				serverSide, clientSide := net.Pipe()
+				go rs.handleConnection(serverSide)
+				defer clientSide.Close()
+				reader := bufio.NewReader(clientSide)
+
+				key := "key:" + strconv.FormatInt(clients.Add(1), 10)
+				set := resp.Serialize(resp.Array{Values: []resp.Value{
+					resp.NewBulkString("SET"), resp.NewBulkString(key), resp.NewBulkString("value"),
+				}})
+				get := resp.Serialize(resp.Array{Values: []resp.Value{
+					resp.NewBulkString("GET"), resp.NewBulkString(key),
+				}})
+				for i := 0; pb.Next(); i++ {
+					cmd := get
+					if i%2 == 0 {
+						cmd = set
+					}
+					if _, err := clientSide.Write(cmd); err != nil {
+						b.Error(err)
+						return
+					}
+					if _, err := resp.Deserialize(reader); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"redis-lite/resp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// activeExpireBudget caps the time one cycle may hold the lock.
+	activeExpireBudget = 25 * time.Millisecond
+	// activeExpireSample is the number of volatile keys examined per round.
+	activeExpireSample = 20
+)
+
+func init() {
+	keyed := func(c *command) *command {
+		c.firstKey, c.lastKey, c.keyStep = 1, 1, 1
+		c.group = "generic"
+		return c
+	}
+	registerCommands(
+		keyed(&command{name: "expire", arity: -3, flags: []string{flagWrite, flagFast},
+			since: "1.0.0", args: "<key> <seconds> [NX | XX | GT | LT]",
+			summary: "Sets the expiration time of a key in seconds",
+			handler: (*RedisServer).handleExpire}),
+		keyed(&command{name: "pexpire", arity: -3, flags: []string{flagWrite, flagFast},
+			since: "2.6.0", args: "<key> <milliseconds> [NX | XX | GT | LT]",
+			summary: "Sets the expiration time of a key in milliseconds",
+			handler: (*RedisServer).handleExpire}),
+		keyed(&command{name: "expireat", arity: -3, flags: []string{flagWrite, flagFast},
+			since: "1.2.0", args: "<key> <unix-time-seconds> [NX | XX | GT | LT]",
+			summary: "Sets the expiration time of a key to a Unix timestamp",
+			handler: (*RedisServer).handleExpire}),
+		keyed(&command{name: "pexpireat", arity: -3, flags: []string{flagWrite, flagFast},
+			since: "2.6.0", args: "<key> <unix-time-milliseconds> [NX | XX | GT | LT]",
+			summary: "Sets the expiration time of a key to a Unix millisecond timestamp",
+			handler: (*RedisServer).handleExpire}),
+		keyed(&command{name: "ttl", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "1.0.0", args: "<key>",
+			summary: "Returns the remaining time to live of a key in seconds",
+			handler: (*RedisServer).handleTTL}),
+		keyed(&command{name: "pttl", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "2.6.0", args: "<key>",
+			summary: "Returns the remaining time to live of a key in milliseconds",
+			handler: (*RedisServer).handleTTL}),
+		keyed(&command{name: "expiretime", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "7.0.0", args: "<key>",
+			summary: "Returns the expiration time of a key as a Unix timestamp",
+			handler: (*RedisServer).handleTTL}),
+		keyed(&command{name: "pexpiretime", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "7.0.0", args: "<key>",
+			summary: "Returns the expiration time of a key as a Unix millisecond timestamp",
+			handler: (*RedisServer).handleTTL}),
+		keyed(&command{name: "persist", arity: 2, flags: []string{flagWrite, flagFast},
+			since: "2.2.0", args: "<key>",
+			summary: "Removes the expiration time of a key",
+			handler: (*RedisServer).handlePersist}),
+	)
+}
+
+// nowMs returns the current Unix time in milliseconds.
+func nowMs() int64 {
+	return time.Now().UnixMilli()
+}
+
+// expireDeadline converts the time argument of an expiring command into an
+// absolute Unix time in milliseconds. n is in seconds unless inMillis is set,
+// and relative to now unless absolute is set. ok is false if the result
+// overflows.
+func expireDeadline(n int64, inMillis, absolute bool, now int64) (at int64, ok bool) {
+	at = n
+	if !inMillis {
+		if n > math.MaxInt64/1000 || n < math.MinInt64/1000 {
+			return 0, false
+		}
+		at = n * 1000
+	}
+	if !absolute {
+		if (at > 0 && now > math.MaxInt64-at) || (at < 0 && now < math.MinInt64-at) {
+			return 0, false
+		}
+		at += now
+	}
+	return at, true
+}
+
+// handleExpire implements EXPIRE, PEXPIRE, EXPIREAT and PEXPIREAT:
+// <command> key time [NX | XX | GT | LT].
+func (rs *RedisServer) handleExpire(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	var nx, xx, gt, lt bool
+	for _, opt := range args[3:] {
+		switch strings.ToUpper(string(opt)) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			c.writeError(fmt.Sprintf("ERR Unsupported option %s", opt))
+			return
+		}
+	}
+	if nx && (xx || gt || lt) {
+		c.writeError("ERR NX and XX, GT or LT options at the same time are not compatible")
+		return
+	}
+	if gt && lt {
+		c.writeError("ERR GT and LT options at the same time are not compatible")
+		return
+	}
+
+	inMillis := strings.HasPrefix(name, "p")
+	absolute := strings.HasSuffix(name, "at")
+	at, ok := expireDeadline(n, inMillis, absolute, nowMs())
+	if !ok {
+		c.writeError(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	current, exists := tx.ExpireAt(key)
+	applied := false
+	if exists {
+		// A key without an expiry counts as having an infinite TTL.
+		switch {
+		case nx && current != 0,
+			xx && current == 0,
+			gt && (current == 0 || at <= current),
+			lt && current != 0 && at >= current:
+		default:
+			applied = tx.SetExpire(key, at)
+		}
+	}
+	tx.Unlock()
+
+	if applied {
+		c.writeValue(resp.Integer{Value: 1})
+	} else {
+		c.writeValue(resp.Integer{Value: 0})
+	}
+}
+
+// handleTTL implements TTL, PTTL, EXPIRETIME and PEXPIRETIME. All of them
+// reply -2 for a missing key and -1 for a key without an expiry.
+func (rs *RedisServer) handleTTL(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	at, exists := tx.ExpireAt(key)
+	tx.Unlock()
+
+	switch {
+	case !exists:
+		c.writeValue(resp.Integer{Value: -2})
+		return
+	case at == 0:
+		c.writeValue(resp.Integer{Value: -1})
+		return
+	}
+
+	var reply int64
+	switch strings.ToLower(string(args[0])) {
+	case "ttl":
+		reply = (max(at-nowMs(), 0) + 500) / 1000
+	case "pttl":
+		reply = max(at-nowMs(), 0)
+	case "expiretime":
+		reply = at / 1000
+	case "pexpiretime":
+		reply = at
+	}
+	c.writeValue(resp.Integer{Value: reply})
+}
+
+func (rs *RedisServer) handlePersist(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	removed := tx.Persist(key)
+	tx.Unlock()
+
+	if removed {
+		c.writeValue(resp.Integer{Value: 1})
+	} else {
+		c.writeValue(resp.Integer{Value: 0})
+	}
+}
+
+// activeExpireCycle samples keys with an expiry and deletes the expired ones,
+// repeating while more than a quarter of each sample was expired, like
+// Redis' activeExpireCycle. Shards are locked one at a time, so clients are
+// never stalled for long.
+func (rs *RedisServer) activeExpireCycle() {
+	deadline := time.Now().Add(activeExpireBudget)
+	for time.Now().Before(deadline) {
+		sampled, expired := rs.data.ActiveExpire(activeExpireSample)
+		if sampled == 0 || expired*4 <= sampled {
+			return
+		}
+	}
+}
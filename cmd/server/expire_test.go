@@ -0,0 +1,103 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpire_TTLCommands(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("TTL", "missing"), resp.Integer{Value: -2})
+	assertReply(t, tc.do("EXPIRE", "missing", "10"), resp.Integer{Value: 0})
+
+	tc.do("SET", "k", "v")
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: -1})
+	assertReply(t, tc.do("EXPIRETIME", "k"), resp.Integer{Value: -1})
+	assertReply(t, tc.do("EXPIRE", "k", "100"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 100})
+
+	pttl := tc.do("PTTL", "k").(resp.Integer).Value
+	if pttl <= 99_000 || pttl > 100_000 {
+		t.Errorf("PTTL = %d; want just under 100000", pttl)
+	}
+
+	at := time.Now().Add(time.Hour).Unix()
+	assertReply(t, tc.do("EXPIREAT", "k", strconv.FormatInt(at, 10)), resp.Integer{Value: 1})
+	assertReply(t, tc.do("EXPIRETIME", "k"), resp.Integer{Value: at})
+	assertReply(t, tc.do("PEXPIRETIME", "k"), resp.Integer{Value: at * 1000})
+
+	// GT and LT compare with the current expiry; NX and XX with its presence.
+	assertReply(t, tc.do("EXPIRE", "k", "10", "GT"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("EXPIRE", "k", "10", "LT"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("EXPIRE", "k", "50", "NX"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("PERSIST", "k"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("PERSIST", "k"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("EXPIRE", "k", "50", "XX"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("EXPIRE", "k", "50", "GT"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("EXPIRE", "k", "50", "LT"), resp.Integer{Value: 1})
+
+	// A deadline in the past deletes the key.
+	assertReply(t, tc.do("PEXPIRE", "k", "-1"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("GET", "k"), resp.BulkString{IsNull: true})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: -2})
+}
+
+func TestExpire_Errors(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("EXPIRE", "k", "soon"), resp.Error{Value: "ERR value is not an integer or out of range"})
+	assertReply(t, tc.do("EXPIRE", "k", "10", "NX", "XX"), resp.Error{Value: "ERR NX and XX, GT or LT options at the same time are not compatible"})
+	assertReply(t, tc.do("EXPIRE", "k", "10", "GT", "LT"), resp.Error{Value: "ERR GT and LT options at the same time are not compatible"})
+	assertReply(t, tc.do("EXPIRE", "k", "10", "SOMETIMES"), resp.Error{Value: "ERR Unsupported option SOMETIMES"})
+	assertReply(t, tc.do("EXPIRE", "k", "9223372036854775807"), resp.Error{Value: "ERR invalid expire time in 'expire' command"})
+	assertReply(t, tc.do("PEXPIRE", "k", "9223372036854775807"), resp.Error{Value: "ERR invalid expire time in 'pexpire' command"})
+}
+
+func TestSet_ExpiryOptions(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("SET", "k", "v", "EX", "100"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 100})
+	assertReply(t, tc.do("SET", "k", "v2", "KEEPTTL"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 100})
+	assertReply(t, tc.do("SET", "k", "v3"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: -1})
+
+	at := time.Now().Add(time.Hour).UnixMilli()
+	assertReply(t, tc.do("SET", "k", "v", "pxat", strconv.FormatInt(at, 10)), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("PEXPIRETIME", "k"), resp.Integer{Value: at})
+
+	assertReply(t, tc.do("SET", "k", "v", "PX", "1"), resp.SimpleString{Value: "OK"})
+	time.Sleep(5 * time.Millisecond)
+	assertReply(t, tc.do("GET", "k"), resp.BulkString{IsNull: true})
+
+	assertReply(t, tc.do("SET", "k", "v", "EX", "0"), resp.Error{Value: "ERR invalid expire time in 'set' command"})
+	assertReply(t, tc.do("SET", "k", "v", "EX", "ten"), resp.Error{Value: "ERR value is not an integer or out of range"})
+	assertReply(t, tc.do("SET", "k", "v", "EX", "10", "PX", "10"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, tc.do("SET", "k", "v", "EX", "10", "KEEPTTL"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, tc.do("SET", "k", "v", "EX"), resp.Error{Value: "ERR syntax error"})
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+
+	for i := 0; i < 200; i++ {
+		tc.do("SET", "temp:"+strconv.Itoa(i), "v", "PX", "1")
+	}
+	tc.do("SET", "keep", "v")
+	time.Sleep(5 * time.Millisecond)
+
+	// Nobody reads the expired keys, so only the active cycle can drop them.
+	rs.activeExpireCycle()
+
+	if sampled, _ := rs.data.ActiveExpire(activeExpireSample); sampled != 0 {
+		t.Errorf("%d keys with an expiry left after the active cycle; want 0", sampled)
+	}
+	if _, ok := rs.data.Get("keep"); !ok {
+		t.Errorf("active expiry deleted a persistent key")
+	}
+}
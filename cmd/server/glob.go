@@ -0,0 +1,137 @@
+package main
+
+// globMatch reports whether str matches the glob-style pattern, following
+// Redis' stringmatchlen:
+//
+//   - '*' matches any sequence of bytes, including none
+//   - '?' matches a single byte
+//   - "[abc]", "[a-z]" and "[^abc]" match one byte in or not in the set;
+//     reversed ranges like "[z-a]" are accepted
+//   - '\' makes the next byte literal, inside or outside brackets
+//
+// With nocase set, ASCII letters are compared case-insensitively.
+//
+// Like Redis since the fix for CVE-2022-36021, matching gives up on patterns
+// with more than maxGlobNesting stars and stops backtracking once a star has
+// failed to match through the end of str, so that patterns such as
+// "*a*a*a*a*b" take polynomial rather than exponential time.
+func globMatch(pattern, str []byte, nocase bool) bool {
+	skipLongerMatches := false
+	return globMatchNested(pattern, str, nocase, &skipLongerMatches, 0)
+}
+
+// maxGlobNesting is how many stars a pattern may recurse into.
+const maxGlobNesting = 1000
+
+// globMatchNested matches str against pattern, which follows nesting stars of
+// an enclosing pattern. skipLongerMatches is set once a star has tried every
+// suffix of str: a star before it trying a shorter suffix cannot succeed
+// either, so it need not try.
+func globMatchNested(pattern, str []byte, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	if nesting > maxGlobNesting {
+		return false
+	}
+	for len(pattern) > 0 && len(str) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(str) > 0 {
+				if globMatchNested(pattern[1:], str, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				str = str[1:]
+			}
+			*skipLongerMatches = true
+			return false
+		case '?':
+			str = str[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for {
+				if len(pattern) == 0 {
+					// An unterminated class ends with the pattern.
+					break
+				}
+				if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if equalByte(pattern[0], str[0], nocase) {
+						match = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end, c := pattern[0], pattern[2], str[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equalByte(pattern[0], str[0], nocase) {
+					match = true
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			str = str[1:]
+			if len(pattern) == 0 {
+				// The class was unterminated; nothing is left to match.
+				return len(str) == 0
+			}
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if !equalByte(pattern[0], str[0], nocase) {
+				return false
+			}
+			str = str[1:]
+		}
+		pattern = pattern[1:]
+		if len(str) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+	return len(pattern) == 0 && len(str) == 0
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, str string
+		nocase       bool
+		want         bool
+	}{
+		{"*", "anything", false, true},
+		{"h?llo", "hello", false, true},
+		{"h?llo", "hllo", false, false},
+		{"h*llo", "heeeello", false, true},
+		{"h*llo", "hllo", false, true},
+		{"h[ae]llo", "hallo", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[b-a]llo", "hallo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{`h\*llo`, "h*llo", false, true},
+		{`h\*llo`, "hello", false, false},
+		{`[\]]`, "]", false, true},
+		{"user:*:name", "user:42:name", false, true},
+		{"user:*:name", "user:42:email", false, false},
+		{"a**b", "axxb", false, true},
+		{"a*", "a", false, true},
+		{"HELLO", "hello", true, true},
+		{"[A-C]x", "bx", true, true},
+		{"HELLO", "hello", false, false},
+		{"[abc", "a", false, true},
+		{"", "", false, true},
+		{"a", "", false, false},
+	}
+	for _, tt := range tests {
+		if got := globMatch([]byte(tt.pattern), []byte(tt.str), tt.nocase); got != tt.want {
+			t.Errorf("globMatch(%q, %q, %v) = %v; want %v", tt.pattern, tt.str, tt.nocase, got, tt.want)
+		}
+	}
+}
+
+// Patterns with many stars used to backtrack exponentially (CVE-2022-36021).
+func TestGlobMatch_Pathological(t *testing.T) {
+	pattern := []byte(strings.Repeat("*a", 14) + "b")
+	str := []byte(strings.Repeat("a", 60))
+	done := make(chan bool, 1)
+	go func() { done <- globMatch(pattern, str, false) }()
+	select {
+	case got := <-done:
+		if got {
+			t.Errorf("globMatch(%q, %q) = true; want false", pattern, str)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("globMatch(%q, %q) did not return within a second", pattern, str)
+	}
+
+	// Stars nest at most maxGlobNesting deep.
+	deep := strings.Repeat("a*", maxGlobNesting+1) + "a"
+	if globMatch([]byte(deep), []byte(strings.Repeat("a", maxGlobNesting+2)), false) {
+		t.Errorf("globMatch with %d nested stars = true; want false", maxGlobNesting+1)
+	}
+	if !globMatch([]byte(strings.Repeat("a*", 10)), []byte(strings.Repeat("a", 20)), false) {
+		t.Errorf("globMatch with 10 nested stars = false; want true")
+	}
+}
@@ -0,0 +1,726 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"redis-lite/kvstore"
+	"redis-lite/resp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	keyed := func(c *command) *command {
+		c.firstKey, c.lastKey, c.keyStep = 1, 1, 1
+		c.group = "hash"
+		return c
+	}
+	registerCommands(
+		keyed(&command{name: "hset", arity: -4, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.0.0", args: "<key> <field> <value> [field value ...]",
+			summary: "Creates or modifies the value of fields in a hash",
+			handler: (*RedisServer).handleHSet}),
+		keyed(&command{name: "hsetnx", arity: 4, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.0.0", args: "<key> <field> <value>",
+			summary: "Sets the value of a field in a hash only when the field doesn't exist",
+			handler: (*RedisServer).handleHSetNX}),
+		keyed(&command{name: "hget", arity: 3, flags: []string{flagReadonly, flagFast},
+			since: "2.0.0", args: "<key> <field>",
+			summary: "Returns the value of a field in a hash",
+			handler: (*RedisServer).handleHGet}),
+		keyed(&command{name: "hmget", arity: -3, flags: []string{flagReadonly, flagFast},
+			since: "2.0.0", args: "<key> <field> [field ...]",
+			summary: "Returns the values of all fields in a hash",
+			handler: (*RedisServer).handleHMGet}),
+		keyed(&command{name: "hdel", arity: -3, flags: []string{flagWrite, flagFast},
+			since: "2.0.0", args: "<key> <field> [field ...]",
+			summary: "Deletes one or more fields and their values from a hash, deleting the hash when it is empty",
+			handler: (*RedisServer).handleHDel}),
+		keyed(&command{name: "hexists", arity: 3, flags: []string{flagReadonly, flagFast},
+			since: "2.0.0", args: "<key> <field>",
+			summary: "Determines whether a field exists in a hash",
+			handler: (*RedisServer).handleHExists}),
+		keyed(&command{name: "hlen", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "2.0.0", args: "<key>",
+			summary: "Returns the number of fields in a hash",
+			handler: (*RedisServer).handleHLen}),
+		keyed(&command{name: "hstrlen", arity: 3, flags: []string{flagReadonly, flagFast},
+			since: "3.2.0", args: "<key> <field>",
+			summary: "Returns the length of the value of a field",
+			handler: (*RedisServer).handleHStrlen}),
+		keyed(&command{name: "hkeys", arity: 2, flags: []string{flagReadonly},
+			since: "2.0.0", args: "<key>",
+			summary: "Returns all fields in a hash",
+			handler: (*RedisServer).handleHGetAll}),
+		keyed(&command{name: "hvals", arity: 2, flags: []string{flagReadonly},
+			since: "2.0.0", args: "<key>",
+			summary: "Returns all values in a hash",
+			handler: (*RedisServer).handleHGetAll}),
+		keyed(&command{name: "hgetall", arity: 2, flags: []string{flagReadonly},
+			since: "2.0.0", args: "<key>",
+			summary: "Returns all fields and values in a hash",
+			handler: (*RedisServer).handleHGetAll}),
+		keyed(&command{name: "hincrby", arity: 4, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.0.0", args: "<key> <field> <increment>",
+			summary: "Increments the integer value of a field in a hash by a number",
+			handler: (*RedisServer).handleHIncrBy}),
+		keyed(&command{name: "hincrbyfloat", arity: 4, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.6.0", args: "<key> <field> <increment>",
+			summary: "Increments the floating point value of a field by a number",
+			handler: (*RedisServer).handleHIncrByFloat}),
+		keyed(&command{name: "hrandfield", arity: -2, flags: []string{flagReadonly},
+			since: "6.2.0", args: "<key> [count [WITHVALUES]]",
+			summary: "Returns one or more random fields from a hash",
+			handler: (*RedisServer).handleHRandField}),
+		keyed(&command{name: "hscan", arity: -3, flags: []string{flagReadonly},
+			since: "2.8.0", args: "<key> <cursor> [MATCH pattern] [COUNT count] [NOVALUES]",
+			summary: "Iterates over fields and values of a hash",
+			handler: (*RedisServer).handleHScan}),
+	)
+}
+
+const (
+	// defaultHashMaxListpackEntries and defaultHashMaxListpackValue are
+	// Redis' defaults for hash-max-listpack-entries and
+	// hash-max-listpack-value.
+	defaultHashMaxListpackEntries = 128
+	defaultHashMaxListpackValue   = 64
+)
+
+// hashLimits tells how large a hash may grow before it is converted from a
+// listpack to a hash table.
+type hashLimits struct {
+	maxEntries int // Most fields a listpack holds
+	maxValue   int // Longest field or value a listpack holds
+}
+
+// hashValue is the payload of a hash object. A small hash keeps its fields
+// and values in a listpack, alternating, which takes little memory but is
+// searched linearly; once it outgrows the server's hashLimits it moves to a
+// hash table for good, as in Redis.
+//
+// Fields and values are never modified in place, so replies can be built
+// from them and written after the key's lock is released.
+type hashValue struct {
+	lp    *kvstore.Listpack              // Fields and values, alternating; nil once converted
+	table *kvstore.Table[string, []byte] // Values by field
+}
+
+func newHashObject() object {
+	return object{typ: objHash, hash: &hashValue{lp: kvstore.NewListpack()}}
+}
+
+func (h *hashValue) len() int {
+	if h.lp != nil {
+		return h.lp.Len() / 2
+	}
+	return h.table.Len()
+}
+
+func (h *hashValue) get(field []byte) ([]byte, bool) {
+	if h.lp != nil {
+		i := h.lp.Find(field, 2)
+		if i < 0 {
+			return nil, false
+		}
+		return h.lp.Get(i + 1)
+	}
+	return h.table.Peek(string(field))
+}
+
+// set stores value under field and reports whether field is new.
+func (h *hashValue) set(field, value []byte, limits hashLimits) bool {
+	if h.lp != nil && (len(field) > limits.maxValue || len(value) > limits.maxValue) {
+		h.convert()
+	}
+	if h.lp == nil {
+		if h.table.Update(string(field), value) {
+			return false
+		}
+		h.table.Insert(string(field), value)
+		return true
+	}
+
+	if i := h.lp.Find(field, 2); i >= 0 {
+		h.lp.Set(i+1, value)
+		return false
+	}
+	h.lp.Append(field, value)
+	if h.len() > limits.maxEntries {
+		h.convert()
+	}
+	return true
+}
+
+// delete removes field and reports whether it existed.
+func (h *hashValue) delete(field []byte) bool {
+	if h.lp == nil {
+		return h.table.Delete(string(field))
+	}
+	i := h.lp.Find(field, 2)
+	if i < 0 {
+		return false
+	}
+	h.lp.Delete(i, 2)
+	return true
+}
+
+// forEach calls fn for every field and value until fn returns false.
+func (h *hashValue) forEach(fn func(field, value []byte) bool) {
+	if h.lp == nil {
+		h.table.ForEach(func(field string, value []byte) bool {
+			return fn([]byte(field), value)
+		})
+		return
+	}
+	var field []byte
+	h.lp.Iter(func(i int, v []byte) bool {
+		if i%2 == 0 {
+			field = v
+			return true
+		}
+		return fn(field, v)
+	})
+}
+
+// random returns a field picked at random, and its value, from a non-empty
+// hash.
+func (h *hashValue) random() (field, value []byte) {
+	if h.lp == nil {
+		key, _ := h.table.RandomKey()
+		v, _ := h.table.Peek(key)
+		return []byte(key), v
+	}
+	i := 2 * rand.IntN(h.len())
+	field, _ = h.lp.Get(i)
+	value, _ = h.lp.Get(i + 1)
+	return field, value
+}
+
+// newFieldTable returns an empty hash table for the fields of a hash.
+func newFieldTable() *kvstore.Table[string, []byte] {
+	return kvstore.NewTable[string, []byte](kvstore.SeededHash)
+}
+
+// convert moves the fields from the listpack to a hash table.
+func (h *hashValue) convert() {
+	table := newFieldTable()
+	h.forEach(func(field, value []byte) bool {
+		table.Insert(string(field), value)
+		return true
+	})
+	h.lp, h.table = nil, table
+}
+
+func (h *hashValue) clone() *hashValue {
+	if h.lp != nil {
+		return &hashValue{lp: h.lp.Clone()}
+	}
+	// The values can be shared, since they are never modified.
+	c := &hashValue{table: newFieldTable()}
+	h.forEach(func(field, value []byte) bool {
+		c.table.Insert(string(field), value)
+		return true
+	})
+	return c
+}
+
+// getHash returns the hash stored at key, whose shard tx must hold. ok is
+// false if the key does not exist, and errMsg is set if it holds another
+// type.
+func getHash(tx kvstore.Tx[object], key string) (h *hashValue, ok bool, errMsg string) {
+	obj, ok := tx.Get(key)
+	if !ok {
+		return nil, false, ""
+	}
+	if obj.typ != objHash {
+		return nil, false, errWrongType
+	}
+	return obj.hash, true, ""
+}
+
+// setField stores value under field of the hash at key, creating the hash if
+// it does not exist. h is the hash found at key, if any. It returns the hash,
+// for further fields to be set in, and reports whether field is new.
+func (rs *RedisServer) setField(tx kvstore.Tx[object], key string, h *hashValue, field, value []byte) (*hashValue, bool) {
+	if h == nil {
+		obj := newHashObject()
+		tx.Insert(key, obj)
+		h = obj.hash
+	}
+	return h, h.set(field, value, rs.hashLimits)
+}
+
+// handleHSet implements HSET key field value [field value ...] and replies
+// with the number of fields added.
+func (rs *RedisServer) handleHSet(c *client, args [][]byte) {
+	if len(args)%2 != 0 {
+		c.writeError("ERR wrong number of arguments for 'hset' command")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, _, errMsg := getHash(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	added := 0
+	for i := 2; i < len(args); i += 2 {
+		var isNew bool
+		if h, isNew = rs.setField(tx, key, h, args[i], args[i+1]); isNew {
+			added++
+		}
+	}
+	c.writeValue(resp.Integer{Value: int64(added)})
+}
+
+func (rs *RedisServer) handleHSetNX(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case exists:
+		if _, ok := h.get(args[2]); ok {
+			c.writeValue(resp.Integer{Value: 0})
+			return
+		}
+	}
+	rs.setField(tx, key, h, args[2], args[3])
+	c.writeValue(resp.Integer{Value: 1})
+}
+
+func (rs *RedisServer) handleHGet(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	h, exists, errMsg := getHash(tx, key)
+	var value []byte
+	ok := false
+	if exists {
+		value, ok = h.get(args[2])
+	}
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !ok:
+		c.writeValue(resp.Null{})
+	default:
+		c.writeBulk(value)
+	}
+}
+
+// handleHMGet implements HMGET key field [field ...]. Missing fields yield
+// nulls.
+func (rs *RedisServer) handleHMGet(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	h, exists, errMsg := getHash(tx, key)
+	values := make([]resp.Value, len(args)-2)
+	for i, field := range args[2:] {
+		values[i] = resp.Null{}
+		if exists {
+			if v, ok := h.get(field); ok {
+				values[i] = resp.BulkString{Value: v}
+			}
+		}
+	}
+	tx.Unlock()
+
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	c.writeValue(resp.Array{Values: values})
+}
+
+// handleHDel implements HDEL key field [field ...] and replies with the
+// number of fields removed.
+func (rs *RedisServer) handleHDel(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	deleted := 0
+	if exists {
+		for _, field := range args[2:] {
+			if h.delete(field) {
+				deleted++
+			}
+		}
+		if h.len() == 0 {
+			tx.Delete(key)
+		}
+	}
+	c.writeValue(resp.Integer{Value: int64(deleted)})
+}
+
+func (rs *RedisServer) handleHExists(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	if exists {
+		if _, found := h.get(args[2]); found {
+			c.writeValue(resp.Integer{Value: 1})
+			return
+		}
+	}
+	c.writeValue(resp.Integer{Value: 0})
+}
+
+func (rs *RedisServer) handleHLen(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !exists:
+		c.writeValue(resp.Integer{Value: 0})
+	default:
+		c.writeValue(resp.Integer{Value: int64(h.len())})
+	}
+}
+
+func (rs *RedisServer) handleHStrlen(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	var value []byte
+	if exists {
+		value, _ = h.get(args[2])
+	}
+	c.writeValue(resp.Integer{Value: int64(len(value))})
+}
+
+// handleHGetAll implements HGETALL, HKEYS and HVALS key. HGETALL replies
+// with a map, which RESP2 clients receive as a flat array of fields and
+// values.
+func (rs *RedisServer) handleHGetAll(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	h, exists, errMsg := getHash(tx, key)
+	// Fields and values are never modified in place, so they are collected
+	// as they are and the reply is streamed out after the lock is released:
+	// fields and values alternating for HGETALL, one of them otherwise.
+	var items [][]byte
+	if exists {
+		h.forEach(func(field, value []byte) bool {
+			switch name {
+			case "hgetall":
+				items = append(items, field, value)
+			case "hkeys":
+				items = append(items, field)
+			case "hvals":
+				items = append(items, value)
+			}
+			return true
+		})
+	}
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case name == "hgetall":
+		c.writeMapHeader(len(items) / 2)
+	default:
+		c.writeArrayHeader(len(items))
+	}
+	for _, item := range items {
+		c.writeBulk(item)
+	}
+}
+
+func (rs *RedisServer) handleHIncrBy(c *client, args [][]byte) {
+	incr, ok := parseInt64(args[3])
+	if !ok {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	var n int64
+	if exists {
+		if value, found := h.get(args[2]); found {
+			if n, ok = parseInt64(value); !ok {
+				c.writeError("ERR hash value is not an integer")
+				return
+			}
+		}
+	}
+	if (incr > 0 && n > math.MaxInt64-incr) || (incr < 0 && n < math.MinInt64-incr) {
+		c.writeError("ERR increment or decrement would overflow")
+		return
+	}
+	n += incr
+	rs.setField(tx, key, h, args[2], strconv.AppendInt(nil, n, 10))
+	c.writeValue(resp.Integer{Value: n})
+}
+
+func (rs *RedisServer) handleHIncrByFloat(c *client, args [][]byte) {
+	incr, ok := parseFloat(args[3])
+	if !ok {
+		c.writeError("ERR value is not a valid float")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	h, exists, errMsg := getHash(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	var f float64
+	if exists {
+		if value, found := h.get(args[2]); found {
+			if f, ok = parseFloat(value); !ok {
+				c.writeError("ERR hash value is not a float")
+				return
+			}
+		}
+	}
+	f += incr
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		c.writeError("ERR increment would produce NaN or Infinity")
+		return
+	}
+	value := strconv.AppendFloat(nil, f, 'f', -1, 64)
+	rs.setField(tx, key, h, args[2], value)
+	c.writeBulk(value)
+}
+
+// handleHRandField implements HRANDFIELD key [count [WITHVALUES]]. A
+// positive count picks up to count distinct fields, a negative one picks
+// -count fields that may repeat. With WITHVALUES, RESP3 clients receive each
+// field and its value as a pair, RESP2 clients a flat array.
+func (rs *RedisServer) handleHRandField(c *client, args [][]byte) {
+	withValues := false
+	count := int64(1)
+	switch {
+	case len(args) > 4 || (len(args) == 4 && !strings.EqualFold(string(args[3]), "WITHVALUES")):
+		c.writeError("ERR syntax error")
+		return
+	case len(args) >= 3:
+		var ok bool
+		if count, ok = parseInt64(args[2]); !ok {
+			c.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		withValues = len(args) == 4
+		if withValues && count < -math.MaxInt64/2 {
+			c.writeError("ERR value is out of range")
+			return
+		}
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	h, exists, errMsg := getHash(tx, key)
+	var fields, values [][]byte
+	if exists {
+		fields, values = h.randomFields(count)
+	}
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case len(args) == 2 && !exists:
+		c.writeValue(resp.Null{})
+		return
+	case len(args) == 2:
+		c.writeBulk(fields[0])
+		return
+	}
+
+	pairs := c.out.Protocol() >= resp.RESP3
+	reply := make([]resp.Value, 0, len(fields))
+	for i, field := range fields {
+		switch {
+		case !withValues:
+			reply = append(reply, resp.BulkString{Value: field})
+		case pairs:
+			reply = append(reply, resp.Array{Values: []resp.Value{resp.BulkString{Value: field}, resp.BulkString{Value: values[i]}}})
+		default:
+			reply = append(reply, resp.BulkString{Value: field}, resp.BulkString{Value: values[i]})
+		}
+	}
+	c.writeValue(resp.Array{Values: reply})
+}
+
+// randomFields picks fields for HRANDFIELD: up to count distinct ones if
+// count is positive, or -count that may repeat.
+func (h *hashValue) randomFields(count int64) (fields, values [][]byte) {
+	if count < 0 {
+		for ; count < 0; count++ {
+			field, value := h.random()
+			fields, values = append(fields, field), append(values, value)
+		}
+		return fields, values
+	}
+
+	n := int64(h.len())
+	if h.lp == nil && count*3 <= n {
+		// Few fields out of many: sample until enough distinct ones.
+		seen := make(map[string]bool, count)
+		for int64(len(fields)) < count {
+			field, value := h.random()
+			if !seen[string(field)] {
+				seen[string(field)] = true
+				fields, values = append(fields, field), append(values, value)
+			}
+		}
+		return fields, values
+	}
+
+	h.forEach(func(field, value []byte) bool {
+		fields, values = append(fields, field), append(values, value)
+		return true
+	})
+	if count < n {
+		rand.Shuffle(len(fields), func(i, j int) {
+			fields[i], fields[j] = fields[j], fields[i]
+			values[i], values[j] = values[j], values[i]
+		})
+		fields, values = fields[:count], values[:count]
+	}
+	return fields, values
+}
+
+// handleHScan implements HSCAN key cursor [MATCH pattern] [COUNT count]
+// [NOVALUES]. A hash stored as a listpack is returned whole in a single call,
+// as in Redis; a hash table is scanned like the keyspace, see handleScan.
+func (rs *RedisServer) handleHScan(c *client, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[2]), 10, 64)
+	if err != nil {
+		c.writeError("ERR invalid cursor")
+		return
+	}
+
+	count := 10
+	var pattern []byte
+	noValues := false
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if opt == "NOVALUES" {
+			noValues = true
+			continue
+		}
+		if i+1 == len(args) {
+			c.writeError("ERR syntax error")
+			return
+		}
+		i++
+		switch opt {
+		case "MATCH":
+			pattern = args[i]
+		case "COUNT":
+			n, err := strconv.Atoi(string(args[i]))
+			if err != nil {
+				c.writeError("ERR value is not an integer or out of range")
+				return
+			}
+			if n < 1 {
+				c.writeError("ERR syntax error")
+				return
+			}
+			count = n
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+	// "*" matches everything, so skip matching altogether.
+	if len(pattern) == 1 && pattern[0] == '*' {
+		pattern = nil
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	h, exists, errMsg := getHash(tx, key)
+	items, found := []resp.Value{}, 0
+	collect := func(field, value []byte) {
+		if pattern != nil && !globMatch(pattern, field, false) {
+			return
+		}
+		found++
+		items = append(items, resp.BulkString{Value: field})
+		if !noValues {
+			items = append(items, resp.BulkString{Value: value})
+		}
+	}
+	switch {
+	case !exists:
+		cursor = 0
+	case h.lp != nil:
+		h.forEach(func(field, value []byte) bool {
+			collect(field, value)
+			return true
+		})
+		cursor = 0
+	default:
+		for visits := count * 10; ; {
+			cursor = h.table.Scan(cursor, func(field string, value []byte) {
+				collect([]byte(field), value)
+			})
+			visits--
+			if cursor == 0 || visits == 0 || found >= count {
+				break
+			}
+		}
+	}
+	tx.Unlock()
+
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	c.writeValue(resp.Array{Values: []resp.Value{
+		resp.NewBulkString(strconv.FormatUint(cursor, 10)),
+		resp.Array{Values: items},
+	}})
+}
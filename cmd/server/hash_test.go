@@ -0,0 +1,212 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sortedBulks returns the strings of an array reply of bulk strings, sorted.
+func sortedBulks(t *testing.T, reply resp.Value) []string {
+	t.Helper()
+	arr, ok := reply.(resp.Array)
+	if !ok {
+		t.Fatalf("reply = %#v; want an array", reply)
+	}
+	var got []string
+	for _, v := range arr.Values {
+		got = append(got, string(v.(resp.BulkString).Value))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestHash_Commands(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	null := resp.BulkString{IsNull: true}
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	assertReply(t, tc.do("HSET", "user", "name", "ada", "lang", "en"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("HSET", "user", "lang", "fr", "age", "36"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("HSET", "user", "odd"), resp.Error{Value: "ERR wrong number of arguments for 'hset' command"})
+	assertReply(t, tc.do("HSETNX", "user", "name", "bob"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("HSETNX", "user", "city", "paris"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("TYPE", "user"), resp.SimpleString{Value: "hash"})
+
+	assertReply(t, tc.do("HGET", "user", "lang"), bulk("fr"))
+	assertReply(t, tc.do("HGET", "user", "nope"), null)
+	assertReply(t, tc.do("HGET", "missing", "name"), null)
+	assertReply(t, tc.do("HMGET", "user", "name", "nope", "age"), resp.Array{Values: []resp.Value{bulk("ada"), null, bulk("36")}})
+	assertReply(t, tc.do("HEXISTS", "user", "age"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("HEXISTS", "user", "nope"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("HLEN", "user"), resp.Integer{Value: 4})
+	assertReply(t, tc.do("HSTRLEN", "user", "city"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("HSTRLEN", "user", "nope"), resp.Integer{Value: 0})
+
+	assertReply(t, tc.do("HKEYS", "user"), bulks("name", "lang", "age", "city"))
+	assertReply(t, tc.do("HVALS", "user"), bulks("ada", "fr", "36", "paris"))
+	assertReply(t, tc.do("HGETALL", "user"), bulks("name", "ada", "lang", "fr", "age", "36", "city", "paris"))
+	assertReply(t, tc.do("HGETALL", "missing"), bulks())
+
+	assertReply(t, tc.do("HDEL", "user", "lang", "nope", "city"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("HDEL", "user", "name", "age"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("EXISTS", "user"), resp.Integer{Value: 0})
+
+	tc.do("SET", "s", "v")
+	assertReply(t, tc.do("HSET", "s", "f", "v"), resp.Error{Value: errWrongType})
+	assertReply(t, tc.do("HGET", "s", "f"), resp.Error{Value: errWrongType})
+	assertReply(t, tc.do("HGETALL", "s"), resp.Error{Value: errWrongType})
+	tc.do("HSET", "h", "f", "v")
+	assertReply(t, tc.do("GET", "h"), resp.Error{Value: errWrongType})
+
+	// RESP3 clients get HGETALL as a map.
+	tc.do("HELLO", "3")
+	assertReply(t, tc.do("HGETALL", "h"), resp.Map{Entries: []resp.MapEntry{{Key: bulk("f"), Value: bulk("v")}}})
+	assertReply(t, tc.do("HGET", "h", "nope"), resp.Null{})
+}
+
+func TestHash_Incr(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	assertReply(t, tc.do("HINCRBY", "h", "n", "5"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("HINCRBY", "h", "n", "-7"), resp.Integer{Value: -2})
+	assertReply(t, tc.do("HGET", "h", "n"), bulk("-2"))
+	assertReply(t, tc.do("HINCRBY", "h", "n", "x"), resp.Error{Value: "ERR value is not an integer or out of range"})
+	tc.do("HSET", "h", "max", "9223372036854775807", "s", "abc")
+	assertReply(t, tc.do("HINCRBY", "h", "max", "1"), resp.Error{Value: "ERR increment or decrement would overflow"})
+	assertReply(t, tc.do("HINCRBY", "h", "s", "1"), resp.Error{Value: "ERR hash value is not an integer"})
+
+	assertReply(t, tc.do("HINCRBYFLOAT", "h", "f", "10.5"), bulk("10.5"))
+	assertReply(t, tc.do("HINCRBYFLOAT", "h", "f", "0.1"), bulk("10.6"))
+	assertReply(t, tc.do("HINCRBYFLOAT", "h", "n", "1.5"), bulk("-0.5"))
+	assertReply(t, tc.do("HINCRBYFLOAT", "h", "s", "1"), resp.Error{Value: "ERR hash value is not a float"})
+	assertReply(t, tc.do("HINCRBYFLOAT", "h", "f", "x"), resp.Error{Value: "ERR value is not a valid float"})
+	assertReply(t, tc.do("HINCRBYFLOAT", "h", "f", "inf"), resp.Error{Value: "ERR increment would produce NaN or Infinity"})
+
+	// A failed increment does not create the key.
+	assertReply(t, tc.do("HINCRBYFLOAT", "new", "f", "inf"), resp.Error{Value: "ERR increment would produce NaN or Infinity"})
+	assertReply(t, tc.do("EXISTS", "new"), resp.Integer{Value: 0})
+}
+
+func TestHash_Encoding(t *testing.T) {
+	entries, value := 4, 8
+	rs := NewRedisServer(ServerOptions{HashMaxListpackEntries: &entries, HashMaxListpackValue: &value})
+	tc := newTestConn(t, rs)
+	encoding := func(key string) resp.Value { return tc.do("OBJECT", "ENCODING", key) }
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	tc.do("HSET", "h", "a", "1", "b", "2", "c", "3", "d", "4")
+	assertReply(t, encoding("h"), bulk("listpack"))
+	tc.do("HSET", "h", "e", "5")
+	assertReply(t, encoding("h"), bulk("hashtable"))
+	// Like Redis, a hash never converts back.
+	tc.do("HDEL", "h", "a", "b", "c")
+	assertReply(t, encoding("h"), bulk("hashtable"))
+	if got := sortedBulks(t, tc.do("HKEYS", "h")); strings.Join(got, ",") != "d,e" {
+		t.Errorf("HKEYS = %q; want [d e]", got)
+	}
+	assertReply(t, tc.do("HGET", "h", "e"), bulk("5"))
+
+	// A long field or value converts a hash too.
+	tc.do("HSET", "long", "f", "123456789")
+	assertReply(t, encoding("long"), bulk("hashtable"))
+
+	// A copy is independent of the original, in either encoding.
+	tc.do("HSET", "small", "f", "v")
+	for _, key := range []string{"small", "h"} {
+		assertReply(t, tc.do("COPY", key, key+":copy"), resp.Integer{Value: 1})
+		assertReply(t, encoding(key+":copy"), encoding(key))
+		before := tc.do("HGET", key, "f")
+		tc.do("HSET", key+":copy", "f", "changed")
+		assertReply(t, tc.do("HGET", key, "f"), before)
+	}
+}
+
+func TestHash_ZeroListpackLimits(t *testing.T) {
+	zero := 0
+	tc := newTestConn(t, NewRedisServer(ServerOptions{HashMaxListpackEntries: &zero}))
+
+	// As in Redis, a limit of 0 entries stores every hash as a hash table.
+	assertReply(t, tc.do("HSET", "h", "f", "v", "g", "w"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("OBJECT", "ENCODING", "h"), resp.NewBulkString("hashtable"))
+	if got := sortedBulks(t, tc.do("HKEYS", "h")); strings.Join(got, ",") != "f,g" {
+		t.Errorf("HKEYS = %q; want [f g]", got)
+	}
+
+	tc = newTestConn(t, NewRedisServer(ServerOptions{HashMaxListpackValue: &zero}))
+	tc.do("HSET", "empty", "", "")
+	assertReply(t, tc.do("OBJECT", "ENCODING", "empty"), resp.NewBulkString("listpack"))
+	tc.do("HSET", "h", "f", "v")
+	assertReply(t, tc.do("OBJECT", "ENCODING", "h"), resp.NewBulkString("hashtable"))
+}
+
+func TestHash_RandFieldAndScan(t *testing.T) {
+	for _, size := range []int{5, 300} {
+		t.Run(strconv.Itoa(size), func(t *testing.T) {
+			tc := newTestConn(t, NewRedisServer())
+			var want []string
+			for i := 0; i < size; i++ {
+				field := "f" + strconv.Itoa(i)
+				tc.do("HSET", "h", field, "v"+strconv.Itoa(i))
+				want = append(want, field)
+			}
+			sort.Strings(want)
+
+			field := string(tc.do("HRANDFIELD", "h").(resp.BulkString).Value)
+			if v := tc.do("HGET", "h", field); v.(resp.BulkString).IsNull {
+				t.Errorf("HRANDFIELD returned %q, which is not in the hash", field)
+			}
+			distinct := sortedBulks(t, tc.do("HRANDFIELD", "h", "3"))
+			if len(distinct) != 3 || distinct[0] == distinct[1] || distinct[1] == distinct[2] {
+				t.Errorf("HRANDFIELD h 3 = %q; want 3 distinct fields", distinct)
+			}
+			if got := sortedBulks(t, tc.do("HRANDFIELD", "h", strconv.Itoa(size+10))); strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("HRANDFIELD with a count above the size returned %d fields; want all %d", len(got), size)
+			}
+			if got := sortedBulks(t, tc.do("HRANDFIELD", "h", "-20")); len(got) != 20 {
+				t.Errorf("HRANDFIELD h -20 returned %d fields; want 20", len(got))
+			}
+			pairs := tc.do("HRANDFIELD", "h", "2", "WITHVALUES").(resp.Array)
+			if len(pairs.Values) != 4 || "v"+strings.TrimPrefix(string(pairs.Values[0].(resp.BulkString).Value), "f") != string(pairs.Values[1].(resp.BulkString).Value) {
+				t.Errorf("HRANDFIELD WITHVALUES = %v; want 2 fields and their values", pairs)
+			}
+
+			// HSCAN returns every field, with its value unless NOVALUES.
+			var got []string
+			cursor := "0"
+			for {
+				reply := tc.do("HSCAN", "h", cursor, "COUNT", "20").(resp.Array)
+				items := reply.Values[1].(resp.Array).Values
+				for i := 0; i < len(items); i += 2 {
+					got = append(got, string(items[i].(resp.BulkString).Value))
+				}
+				if cursor = string(reply.Values[0].(resp.BulkString).Value); cursor == "0" {
+					break
+				}
+			}
+			sort.Strings(got)
+			got = slices.Compact(got)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("HSCAN returned %d distinct fields; want %d", len(got), len(want))
+			}
+			reply := tc.do("HSCAN", "h", "0", "MATCH", "f1", "NOVALUES", "COUNT", "1000")
+			assertReply(t, reply.(resp.Array).Values[1], bulks("f1"))
+		})
+	}
+
+	tc := newTestConn(t, NewRedisServer())
+	assertReply(t, tc.do("HRANDFIELD", "missing"), resp.BulkString{IsNull: true})
+	assertReply(t, tc.do("HRANDFIELD", "missing", "3"), bulks())
+	assertReply(t, tc.do("HRANDFIELD", "missing", "3", "VALUES"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, tc.do("HSCAN", "missing", "0"), resp.Array{Values: []resp.Value{resp.NewBulkString("0"), bulks()}})
+	assertReply(t, tc.do("HSCAN", "missing", "x"), resp.Error{Value: "ERR invalid cursor"})
+
+	// RESP3 clients get each field and value as a pair.
+	tc.do("HSET", "h", "f", "v")
+	tc.do("HELLO", "3")
+	assertReply(t, tc.do("HRANDFIELD", "h", "1", "WITHVALUES"), resp.Array{Values: []resp.Value{bulks("f", "v")}})
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerCommands(
+		&command{name: "del", arity: -2, flags: []string{flagWrite},
+			firstKey: 1, lastKey: -1, keyStep: 1,
+			group: "generic", since: "1.0.0", args: "<key> [key ...]",
+			summary: "Deletes one or more keys",
+			handler: (*RedisServer).handleDel},
+		&command{name: "unlink", arity: -2, flags: []string{flagWrite, flagFast},
+			firstKey: 1, lastKey: -1, keyStep: 1,
+			group: "generic", since: "4.0.0", args: "<key> [key ...]",
+			summary: "Asynchronously deletes one or more keys",
+			handler: (*RedisServer).handleDel},
+		&command{name: "exists", arity: -2, flags: []string{flagReadonly, flagFast},
+			firstKey: 1, lastKey: -1, keyStep: 1,
+			group: "generic", since: "1.0.0", args: "<key> [key ...]",
+			summary: "Counts how many of the given keys exist",
+			handler: (*RedisServer).handleExists},
+		&command{name: "type", arity: 2, flags: []string{flagReadonly, flagFast},
+			firstKey: 1, lastKey: 1, keyStep: 1,
+			group: "generic", since: "1.0.0", args: "<key>",
+			summary: "Determines the type of value stored at a key",
+			handler: (*RedisServer).handleType},
+		&command{name: "rename", arity: 3, flags: []string{flagWrite},
+			firstKey: 1, lastKey: 2, keyStep: 1,
+			group: "generic", since: "1.0.0", args: "<key> <newkey>",
+			summary: "Renames a key and overwrites the destination",
+			handler: (*RedisServer).handleRename},
+		&command{name: "renamenx", arity: 3, flags: []string{flagWrite, flagFast},
+			firstKey: 1, lastKey: 2, keyStep: 1,
+			group: "generic", since: "1.0.0", args: "<key> <newkey>",
+			summary: "Renames a key only when the destination doesn't exist",
+			handler: (*RedisServer).handleRename},
+		&command{name: "copy", arity: -3, flags: []string{flagWrite, flagDenyOOM},
+			firstKey: 1, lastKey: 2, keyStep: 1,
+			group: "generic", since: "6.2.0", args: "<source> <destination> [DB destination-db] [REPLACE]",
+			summary: "Copies the value of a key to a new key",
+			handler: (*RedisServer).handleCopy},
+		&command{name: "dbsize", arity: 1, flags: []string{flagReadonly, flagFast},
+			group: "server", since: "1.0.0",
+			summary: "Returns the number of keys in the database",
+			handler: (*RedisServer).handleDBSize},
+		&command{name: "flushdb", arity: -1, flags: []string{flagWrite},
+			group: "server", since: "1.0.0", args: "[ASYNC | SYNC]",
+			summary: "Removes all keys from the current database",
+			handler: (*RedisServer).handleFlush},
+		&command{name: "flushall", arity: -1, flags: []string{flagWrite},
+			group: "server", since: "1.0.0", args: "[ASYNC | SYNC]",
+			summary: "Removes all keys from all databases",
+			handler: (*RedisServer).handleFlush},
+		&command{name: "randomkey", arity: 1, flags: []string{flagReadonly},
+			group: "generic", since: "1.0.0",
+			summary: "Returns a random key name from the database",
+			handler: (*RedisServer).handleRandomKey},
+		&command{name: "scan", arity: -2, flags: []string{flagReadonly},
+			group: "generic", since: "2.8.0", args: "<cursor> [MATCH pattern] [COUNT count] [TYPE type]",
+			summary: "Iterates over the key names in the database",
+			handler: (*RedisServer).handleScan},
+		&command{name: "keys", arity: 2, flags: []string{flagReadonly},
+			group: "generic", since: "1.0.0", args: "<pattern>",
+			summary: "Returns all key names that match a pattern",
+			handler: (*RedisServer).handleKeys},
+	)
+}
+
+// handleDel implements DEL and UNLINK. Freeing memory is left to the garbage
+// collector, so UNLINK is the same as DEL.
+func (rs *RedisServer) handleDel(c *client, args [][]byte) {
+	keys := stringKeys(args[1:])
+	deleted := 0
+	tx := rs.data.Lock(keys...)
+	for _, key := range keys {
+		// Delete on its own would count keys that expired but were not
+		// removed yet, so check that the key is live first.
+		if _, ok := tx.Get(key); ok && tx.Delete(key) {
+			deleted++
+		}
+	}
+	tx.Unlock()
+
+	c.writeValue(resp.Integer{Value: int64(deleted)})
+}
+
+// handleExists implements EXISTS key [key ...]. A key mentioned several times
+// is counted each time.
+func (rs *RedisServer) handleExists(c *client, args [][]byte) {
+	keys := stringKeys(args[1:])
+	count := 0
+	tx := rs.data.Lock(keys...)
+	for _, key := range keys {
+		if _, ok := tx.Peek(key); ok {
+			count++
+		}
+	}
+	tx.Unlock()
+
+	c.writeValue(resp.Integer{Value: int64(count)})
+}
+
+func (rs *RedisServer) handleType(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	value, ok := tx.Peek(key)
+	tx.Unlock()
+
+	if ok {
+		c.writeValue(resp.SimpleString{Value: value.typ.String()})
+	} else {
+		c.writeValue(resp.SimpleString{Value: "none"})
+	}
+}
+
+// handleRename implements RENAME and RENAMENX. The value keeps its expiry.
+func (rs *RedisServer) handleRename(c *client, args [][]byte) {
+	nx := strings.EqualFold(string(args[0]), "renamenx")
+	src, dst := string(args[1]), string(args[2])
+
+	tx := rs.data.Lock(src, dst)
+	value, ok := tx.Get(src)
+	if !ok {
+		tx.Unlock()
+		c.writeError("ERR no such key")
+		return
+	}
+	renamed := false
+	if _, exists := tx.Get(dst); !nx || !exists {
+		if src != dst {
+			expireAt, _ := tx.ExpireAt(src)
+			tx.Delete(src)
+			tx.Insert(dst, value)
+			if expireAt != 0 {
+				tx.SetExpire(dst, expireAt)
+			}
+			if value.typ == objList {
+				rs.signalKeyAsReady(dst)
+			}
+		}
+		renamed = true
+	}
+	tx.Unlock()
+
+	switch {
+	case !nx:
+		c.writeValue(resp.SimpleString{Value: "OK"})
+	case renamed:
+		c.writeValue(resp.Integer{Value: 1})
+	default:
+		c.writeValue(resp.Integer{Value: 0})
+	}
+}
+
+// handleCopy implements COPY source destination [DB destination-db] [REPLACE].
+// There is a single database, so DB only accepts 0.
+func (rs *RedisServer) handleCopy(c *client, args [][]byte) {
+	replace := false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); {
+		case opt == "REPLACE":
+			replace = true
+		case opt == "DB" && i+1 < len(args):
+			i++
+			if string(args[i]) != "0" {
+				c.writeError("ERR DB index is out of range")
+				return
+			}
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	src, dst := string(args[1]), string(args[2])
+	if src == dst {
+		c.writeError("ERR source and destination objects are the same")
+		return
+	}
+
+	tx := rs.data.Lock(src, dst)
+	value, ok := tx.Get(src)
+	_, exists := tx.Get(dst)
+	copied := ok && (replace || !exists)
+	if copied {
+		expireAt, _ := tx.ExpireAt(src)
+		tx.Insert(dst, value.dup())
+		if expireAt != 0 {
+			tx.SetExpire(dst, expireAt)
+		}
+		if value.typ == objList {
+			rs.signalKeyAsReady(dst)
+		}
+	}
+	tx.Unlock()
+
+	if copied {
+		c.writeValue(resp.Integer{Value: 1})
+	} else {
+		c.writeValue(resp.Integer{Value: 0})
+	}
+}
+
+func (rs *RedisServer) handleDBSize(c *client, args [][]byte) {
+	size := rs.data.Len()
+
+	c.writeValue(resp.Integer{Value: int64(size)})
+}
+
+// handleFlush implements FLUSHDB and FLUSHALL. The old buckets are freed by
+// the garbage collector in the background, so ASYNC and SYNC behave alike.
+func (rs *RedisServer) handleFlush(c *client, args [][]byte) {
+	if len(args) > 2 || (len(args) == 2 && !strings.EqualFold(string(args[1]), "ASYNC") && !strings.EqualFold(string(args[1]), "SYNC")) {
+		c.writeError("ERR syntax error")
+		return
+	}
+
+	rs.data.Clear()
+
+	c.writeValue(resp.SimpleString{Value: "OK"})
+}
+
+func (rs *RedisServer) handleRandomKey(c *client, args [][]byte) {
+	key, ok := rs.data.RandomKey()
+
+	if !ok {
+		c.writeValue(resp.Null{})
+		return
+	}
+	c.writeValue(resp.NewBulkString(key))
+}
+
+// handleScan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+// Like Redis, it visits buckets until it has collected about count keys or
+// visited ten times as many buckets, and MATCH and TYPE only filter what
+// was collected, so a call may return no keys with a non-zero cursor.
+func (rs *RedisServer) handleScan(c *client, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.writeError("ERR invalid cursor")
+		return
+	}
+
+	count := 10
+	var pattern []byte
+	typ := ""
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.writeError("ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				c.writeError("ERR value is not an integer or out of range")
+				return
+			}
+			if n < 1 {
+				c.writeError("ERR syntax error")
+				return
+			}
+			count = n
+		case "TYPE":
+			typ = string(args[i+1])
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+	// "*" matches everything, so skip matching altogether.
+	if len(pattern) == 1 && pattern[0] == '*' {
+		pattern = nil
+	}
+
+	keys := []resp.Value{}
+	for visits := count * 10; ; {
+		cursor = rs.data.Scan(cursor, func(key string, value object) {
+			if typ != "" && !strings.EqualFold(typ, value.typ.String()) {
+				return
+			}
+			if pattern != nil && !globMatch(pattern, []byte(key), false) {
+				return
+			}
+			keys = append(keys, resp.NewBulkString(key))
+		})
+		visits--
+		if cursor == 0 || visits == 0 || len(keys) >= count {
+			break
+		}
+	}
+
+	c.writeValue(resp.Array{Values: []resp.Value{
+		resp.NewBulkString(strconv.FormatUint(cursor, 10)),
+		resp.Array{Values: keys},
+	}})
+}
+
+// handleKeys implements KEYS pattern.
+func (rs *RedisServer) handleKeys(c *client, args [][]byte) {
+	pattern := args[1]
+	all := len(pattern) == 1 && pattern[0] == '*'
+
+	// Only the matching keys are collected, without copying them; the
+	// reply is streamed out once the shards are unlocked.
+	var keys []string
+	rs.data.ForEach(func(key string, value object) bool {
+		if all || globMatch(pattern, []byte(key), false) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	c.writeArrayHeader(len(keys))
+	for _, key := range keys {
+		c.writeBulkString(key)
+	}
+}
+
+// stringKeys converts key arguments to strings, as taken by the store.
+func stringKeys(args [][]byte) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
+	}
+	return keys
+}
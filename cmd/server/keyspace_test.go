@@ -0,0 +1,116 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeyspace_DelExistsType(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	tc.do("SET", "a", "1")
+	tc.do("SET", "b", "2")
+	tc.do("SET", "gone", "3", "PX", "1")
+	time.Sleep(5 * time.Millisecond)
+
+	assertReply(t, tc.do("EXISTS", "a", "a", "b", "nope", "gone"), resp.Integer{Value: 3})
+	assertReply(t, tc.do("TYPE", "a"), resp.SimpleString{Value: "string"})
+	assertReply(t, tc.do("TYPE", "nope"), resp.SimpleString{Value: "none"})
+	assertReply(t, tc.do("DBSIZE"), resp.Integer{Value: 2})
+
+	assertReply(t, tc.do("DEL", "a", "nope", "a"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("UNLINK", "b", "gone"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("DBSIZE"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("RANDOMKEY"), resp.BulkString{IsNull: true})
+}
+
+func TestKeyspace_RenameCopy(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	tc.do("SET", "src", "v", "EX", "100")
+	tc.do("SET", "other", "o")
+
+	assertReply(t, tc.do("RENAME", "missing", "x"), resp.Error{Value: "ERR no such key"})
+	assertReply(t, tc.do("RENAME", "src", "dst"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("EXISTS", "src"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("TTL", "dst"), resp.Integer{Value: 100})
+	assertReply(t, tc.do("RENAMENX", "dst", "other"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("RENAMENX", "dst", "dst"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("RENAME", "dst", "dst"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("RENAMENX", "dst", "fresh"), resp.Integer{Value: 1})
+
+	assertReply(t, tc.do("COPY", "fresh", "other"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("COPY", "fresh", "other", "REPLACE"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("GET", "other"), resp.BulkString{Value: []byte("v")})
+	assertReply(t, tc.do("TTL", "other"), resp.Integer{Value: 100})
+	assertReply(t, tc.do("COPY", "fresh", "third", "DB", "0"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("COPY", "missing", "x"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("COPY", "fresh", "x", "DB", "1"), resp.Error{Value: "ERR DB index is out of range"})
+	assertReply(t, tc.do("COPY", "fresh", "fresh"), resp.Error{Value: "ERR source and destination objects are the same"})
+	assertReply(t, tc.do("COPY", "fresh", "x", "BOGUS"), resp.Error{Value: "ERR syntax error"})
+}
+
+func TestKeyspace_FlushAndRandomKey(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	tc.do("SET", "a", "1")
+	tc.do("SET", "b", "2")
+	key, ok := tc.do("RANDOMKEY").(resp.BulkString)
+	if !ok || (string(key.Value) != "a" && string(key.Value) != "b") {
+		t.Errorf("RANDOMKEY = %v; want a or b", key)
+	}
+
+	assertReply(t, tc.do("FLUSHDB", "BOGUS"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, tc.do("FLUSHDB", "async"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("DBSIZE"), resp.Integer{Value: 0})
+	tc.do("SET", "a", "1")
+	assertReply(t, tc.do("FLUSHALL"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("EXISTS", "a"), resp.Integer{Value: 0})
+}
+
+func TestKeyspace_ScanAndKeys(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	want := map[string]bool{}
+	for i := 0; i < 300; i++ {
+		key := "user:" + strconv.Itoa(i)
+		tc.do("SET", key, "v")
+		want[key] = true
+	}
+	tc.do("SET", "other", "v")
+
+	seen := map[string]bool{}
+	cursor := "0"
+	for {
+		reply := tc.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "25", "TYPE", "string").(resp.Array)
+		cursor = string(reply.Values[0].(resp.BulkString).Value)
+		for _, key := range reply.Values[1].(resp.Array).Values {
+			seen[string(key.(resp.BulkString).Value)] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("SCAN returned %d distinct keys; want the %d user keys", len(seen), len(want))
+	}
+
+	// No key has another type.
+	reply := tc.do("SCAN", "0", "TYPE", "list", "COUNT", "1000").(resp.Array)
+	assertReply(t, reply.Values[1], resp.Array{Values: []resp.Value{}})
+
+	keys := tc.do("KEYS", "user:1?").(resp.Array)
+	if len(keys.Values) != 10 {
+		t.Errorf("KEYS user:1? returned %d keys; want 10", len(keys.Values))
+	}
+	if all := tc.do("KEYS", "*").(resp.Array); len(all.Values) != 301 {
+		t.Errorf("KEYS * returned %d keys; want 301", len(all.Values))
+	}
+
+	assertReply(t, tc.do("SCAN", "abc"), resp.Error{Value: "ERR invalid cursor"})
+	assertReply(t, tc.do("SCAN", "0", "COUNT", "0"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, tc.do("SCAN", "0", "MATCH"), resp.Error{Value: "ERR syntax error"})
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"redis-lite/kvstore"
+	"redis-lite/resp"
+	"strings"
+)
+
+func init() {
+	keyed := func(c *command) *command {
+		c.firstKey, c.lastKey, c.keyStep = 1, 1, 1
+		c.group = "list"
+		return c
+	}
+	registerCommands(
+		keyed(&command{name: "lpush", arity: -3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key> <element> [element ...]",
+			summary: "Prepends one or more elements to a list, creating the key if needed",
+			handler: (*RedisServer).handlePush}),
+		keyed(&command{name: "rpush", arity: -3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key> <element> [element ...]",
+			summary: "Appends one or more elements to a list, creating the key if needed",
+			handler: (*RedisServer).handlePush}),
+		keyed(&command{name: "lpushx", arity: -3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.2.0", args: "<key> <element> [element ...]",
+			summary: "Prepends one or more elements to a list only when the list exists",
+			handler: (*RedisServer).handlePush}),
+		keyed(&command{name: "rpushx", arity: -3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.2.0", args: "<key> <element> [element ...]",
+			summary: "Appends one or more elements to a list only when the list exists",
+			handler: (*RedisServer).handlePush}),
+		keyed(&command{name: "lpop", arity: -2, maxArgs: 3, flags: []string{flagWrite, flagFast},
+			since: "1.0.0", args: "<key> [count]",
+			summary: "Returns and removes the first elements of a list, deleting the list when it is empty",
+			handler: (*RedisServer).handlePop}),
+		keyed(&command{name: "rpop", arity: -2, maxArgs: 3, flags: []string{flagWrite, flagFast},
+			since: "1.0.0", args: "<key> [count]",
+			summary: "Returns and removes the last elements of a list, deleting the list when it is empty",
+			handler: (*RedisServer).handlePop}),
+		keyed(&command{name: "llen", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "1.0.0", args: "<key>",
+			summary: "Returns the length of a list",
+			handler: (*RedisServer).handleLLen}),
+		keyed(&command{name: "lrange", arity: 4, flags: []string{flagReadonly},
+			since: "1.0.0", args: "<key> <start> <stop>",
+			summary: "Returns a range of elements from a list",
+			handler: (*RedisServer).handleLRange}),
+		keyed(&command{name: "lindex", arity: 3, flags: []string{flagReadonly},
+			since: "1.0.0", args: "<key> <index>",
+			summary: "Returns an element from a list by its index",
+			handler: (*RedisServer).handleLIndex}),
+		keyed(&command{name: "lset", arity: 4, flags: []string{flagWrite, flagDenyOOM},
+			since: "1.0.0", args: "<key> <index> <element>",
+			summary: "Sets the value of an element in a list by its index",
+			handler: (*RedisServer).handleLSet}),
+		keyed(&command{name: "linsert", arity: 5, flags: []string{flagWrite, flagDenyOOM},
+			since: "2.2.0", args: "<key> <BEFORE | AFTER> <pivot> <element>",
+			summary: "Inserts an element before or after another element in a list",
+			handler: (*RedisServer).handleLInsert}),
+		keyed(&command{name: "lrem", arity: 4, flags: []string{flagWrite},
+			since: "1.0.0", args: "<key> <count> <element>",
+			summary: "Removes elements from a list, deleting the list when it is empty",
+			handler: (*RedisServer).handleLRem}),
+		keyed(&command{name: "ltrim", arity: 4, flags: []string{flagWrite},
+			since: "1.0.0", args: "<key> <start> <stop>",
+			summary: "Removes elements from both ends of a list, deleting the list when it is empty",
+			handler: (*RedisServer).handleLTrim}),
+		keyed(&command{name: "lpos", arity: -3, flags: []string{flagReadonly},
+			since: "6.0.6", args: "<key> <element> [RANK rank] [COUNT num-matches] [MAXLEN len]",
+			summary: "Returns the index of matching elements in a list",
+			handler: (*RedisServer).handleLPos}),
+		&command{name: "lmove", arity: 5, flags: []string{flagWrite, flagDenyOOM},
+			firstKey: 1, lastKey: 2, keyStep: 1,
+			group: "list", since: "6.2.0", args: "<source> <destination> <LEFT | RIGHT> <LEFT | RIGHT>",
+			summary: "Returns an element after removing it from one list and pushing it to another, deleting the source when it is empty",
+			handler: (*RedisServer).handleLMove},
+	)
+}
+
+// getList returns the list stored at key, whose shard tx must hold. ok is
+// false if the key does not exist, and errMsg is set if it holds another
+// type. The list is modified in place, so it must only be used, and its
+// entries read, while the lock is held.
+func getList(tx kvstore.Tx[object], key string) (list *kvstore.Quicklist, ok bool, errMsg string) {
+	obj, ok := tx.Get(key)
+	if !ok {
+		return nil, false, ""
+	}
+	if obj.typ != objList {
+		return nil, false, errWrongType
+	}
+	return obj.list, true, ""
+}
+
+// listIndex resolves index, which counts from the tail when negative, to a
+// position in a list of n entries. The result is out of range [0, n) if the
+// index is.
+func listIndex(index int64, n int) int64 {
+	if index < 0 {
+		index += int64(n)
+	}
+	return index
+}
+
+// listRange resolves the inclusive range start..stop of LRANGE and LTRIM the
+// way Redis does, and reports whether any entry of a list of n entries falls
+// into it.
+func listRange(start, stop int64, n int) (int, int, bool) {
+	start, stop = listIndex(start, n), listIndex(stop, n)
+	start = max(start, 0)
+	if start > stop || start >= int64(n) {
+		return 0, 0, false
+	}
+	stop = min(stop, int64(n)-1)
+	return int(start), int(stop), true
+}
+
+// parseListEnd parses the LEFT or RIGHT argument of LMOVE, reporting whether
+// it is LEFT.
+func parseListEnd(arg []byte) (left, ok bool) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// listPop removes and returns the first entry of a non-empty list if left is
+// set, or else its last entry.
+func listPop(list *kvstore.Quicklist, left bool) []byte {
+	var v []byte
+	if left {
+		v, _ = list.PopFront()
+	} else {
+		v, _ = list.PopBack()
+	}
+	return v
+}
+
+func listPush(list *kvstore.Quicklist, left bool, v []byte) {
+	if left {
+		list.PushFront(v)
+	} else {
+		list.PushBack(v)
+	}
+}
+
+// handlePush implements LPUSH, RPUSH, LPUSHX and RPUSHX key element
+// [element ...]. The X variants only push onto an existing list. Elements are
+// pushed one at a time, so LPUSH leaves them in reverse order.
+func (rs *RedisServer) handlePush(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	front, onlyExisting := name[0] == 'l', strings.HasSuffix(name, "x")
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	if !exists {
+		if onlyExisting {
+			c.writeValue(resp.Integer{Value: 0})
+			return
+		}
+		obj := newListObject()
+		tx.Insert(key, obj)
+		list = obj.list
+		rs.signalKeyAsReady(key)
+	}
+	for _, element := range args[2:] {
+		listPush(list, front, element)
+	}
+	c.writeValue(resp.Integer{Value: int64(list.Len())})
+}
+
+// handlePop implements LPOP and RPOP key [count]. Without a count the reply
+// is the element; with one it is an array of up to count elements, or a null
+// array if the key does not exist.
+func (rs *RedisServer) handlePop(c *client, args [][]byte) {
+	front := args[0][0] == 'l' || args[0][0] == 'L'
+	hasCount := len(args) == 3
+	count := int64(1)
+	if hasCount {
+		var ok bool
+		if count, ok = parseInt64(args[2]); !ok || count < 0 {
+			c.writeError("ERR value is out of range, must be positive")
+			return
+		}
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case !exists && hasCount:
+		c.writeNullArray()
+		return
+	case !exists:
+		c.writeValue(resp.Null{})
+		return
+	}
+
+	values := make([]resp.Value, 0, min(count, int64(list.Len())))
+	for ; count > 0 && list.Len() > 0; count-- {
+		values = append(values, resp.BulkString{Value: listPop(list, front)})
+	}
+	if list.Len() == 0 {
+		tx.Delete(key)
+	}
+
+	if !hasCount {
+		c.writeValue(values[0])
+		return
+	}
+	c.writeValue(resp.Array{Values: values})
+}
+
+func (rs *RedisServer) handleLLen(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !exists:
+		c.writeValue(resp.Integer{Value: 0})
+	default:
+		c.writeValue(resp.Integer{Value: int64(list.Len())})
+	}
+}
+
+// handleLRange implements LRANGE key start stop, where both ends are
+// inclusive and negative indexes count from the tail.
+func (rs *RedisServer) handleLRange(c *client, args [][]byte) {
+	start, ok := parseInt64(args[2])
+	stop, ok2 := parseInt64(args[3])
+	if !ok || !ok2 {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	list, exists, errMsg := getList(tx, key)
+	// The list is modified in place, so the entries are copied while the
+	// lock is held: back to back into one buffer, which the reply is then
+	// streamed from.
+	var buf []byte
+	var ends []int // End of each entry in buf
+	if exists {
+		if from, to, ok := listRange(start, stop, list.Len()); ok {
+			ends = make([]int, 0, to-from+1)
+			list.Iter(from, false, func(i int, v []byte) bool {
+				buf = append(buf, v...)
+				ends = append(ends, len(buf))
+				return i < to
+			})
+		}
+	}
+	tx.Unlock()
+
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	c.writeArrayHeader(len(ends))
+	for i, end := range ends {
+		begin := 0
+		if i > 0 {
+			begin = ends[i-1]
+		}
+		c.writeBulk(buf[begin:end])
+	}
+}
+
+func (rs *RedisServer) handleLIndex(c *client, args [][]byte) {
+	index, ok := parseInt64(args[2])
+	if !ok {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	if exists {
+		if i := listIndex(index, list.Len()); i >= 0 && i < int64(list.Len()) {
+			v, _ := list.Index(int(i))
+			c.writeBulk(v)
+			return
+		}
+	}
+	c.writeValue(resp.Null{})
+}
+
+func (rs *RedisServer) handleLSet(c *client, args [][]byte) {
+	index, ok := parseInt64(args[2])
+	if !ok {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case !exists:
+		c.writeError("ERR no such key")
+		return
+	}
+	i := listIndex(index, list.Len())
+	if i < 0 || i >= int64(list.Len()) {
+		c.writeError("ERR index out of range")
+		return
+	}
+	list.Set(int(i), args[3])
+	c.writeValue(resp.SimpleString{Value: "OK"})
+}
+
+// handleLInsert implements LINSERT key BEFORE|AFTER pivot element. It replies
+// with the new length, 0 if the key does not exist and -1 if pivot is not in
+// the list.
+func (rs *RedisServer) handleLInsert(c *client, args [][]byte) {
+	var after bool
+	switch strings.ToUpper(string(args[2])) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		c.writeError("ERR syntax error")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case !exists:
+		c.writeValue(resp.Integer{Value: 0})
+		return
+	}
+	pivot := -1
+	list.Iter(0, false, func(i int, v []byte) bool {
+		if bytes.Equal(v, args[3]) {
+			pivot = i
+			return false
+		}
+		return true
+	})
+	if pivot < 0 {
+		c.writeValue(resp.Integer{Value: -1})
+		return
+	}
+	if after {
+		pivot++
+	}
+	list.Insert(pivot, args[4])
+	c.writeValue(resp.Integer{Value: int64(list.Len())})
+}
+
+// handleLRem implements LREM key count element: it removes the first count
+// occurrences of element, the last -count ones if count is negative, or all
+// of them if it is 0, and replies with the number removed.
+func (rs *RedisServer) handleLRem(c *client, args [][]byte) {
+	count, ok := parseInt64(args[2])
+	if !ok {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+		return
+	case !exists:
+		c.writeValue(resp.Integer{Value: 0})
+		return
+	}
+
+	// Clamping to the length of the list, which is never empty, keeps the
+	// sign of count and cannot overflow when it is negated.
+	count = max(min(count, int64(list.Len())), -int64(list.Len()))
+	removed := list.Remove(args[3], int(count))
+	if list.Len() == 0 {
+		tx.Delete(key)
+	}
+	c.writeValue(resp.Integer{Value: int64(removed)})
+}
+
+// handleLTrim implements LTRIM key start stop, keeping only the entries in
+// the inclusive range.
+func (rs *RedisServer) handleLTrim(c *client, args [][]byte) {
+	start, ok := parseInt64(args[2])
+	stop, ok2 := parseInt64(args[3])
+	if !ok || !ok2 {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	list, exists, errMsg := getList(tx, key)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	if exists {
+		n := list.Len()
+		if from, to, ok := listRange(start, stop, n); ok {
+			list.Delete(to+1, n-to-1)
+			list.Delete(0, from)
+		} else {
+			list.Delete(0, n)
+		}
+		if list.Len() == 0 {
+			tx.Delete(key)
+		}
+	}
+	c.writeValue(resp.SimpleString{Value: "OK"})
+}
+
+// handleLPos implements LPOS key element [RANK rank] [COUNT num-matches]
+// [MAXLEN len]. RANK picks the rank-th match, searching from the tail when
+// negative; MAXLEN bounds the number of entries compared. With COUNT the
+// reply is an array of the indexes of up to count matches, all of them if
+// count is 0.
+func (rs *RedisServer) handleLPos(c *client, args [][]byte) {
+	rank, count, maxLen := int64(1), int64(-1), int64(0)
+	for i := 3; i < len(args); i += 2 {
+		opt := strings.ToUpper(string(args[i]))
+		if i+1 >= len(args) || (opt != "RANK" && opt != "COUNT" && opt != "MAXLEN") {
+			c.writeError("ERR syntax error")
+			return
+		}
+		n, ok := parseInt64(args[i+1])
+		if !ok {
+			c.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		switch opt {
+		case "RANK":
+			if n == 0 {
+				c.writeError("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+				return
+			}
+			if n == math.MinInt64 {
+				c.writeError(fmt.Sprintf("ERR value is out of range, value must between %d and %d", int64(-math.MaxInt64), int64(math.MaxInt64)))
+				return
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				c.writeError("ERR COUNT can't be negative")
+				return
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				c.writeError("ERR MAXLEN can't be negative")
+				return
+			}
+			maxLen = n
+		}
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	list, exists, errMsg := getList(tx, key)
+	var matches []resp.Value
+	if exists {
+		reverse, start := rank < 0, 0
+		if reverse {
+			rank, start = -rank, list.Len()-1
+		}
+		var compared int64
+		list.Iter(start, reverse, func(i int, v []byte) bool {
+			if maxLen > 0 && compared == maxLen {
+				return false
+			}
+			compared++
+			if !bytes.Equal(v, args[2]) {
+				return true
+			}
+			if rank > 1 {
+				rank--
+				return true
+			}
+			matches = append(matches, resp.Integer{Value: int64(i)})
+			return count == 0 || int64(len(matches)) < max(count, 1)
+		})
+	}
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case count >= 0:
+		c.writeValue(resp.Array{Values: matches})
+	case len(matches) == 0:
+		c.writeValue(resp.Null{})
+	default:
+		c.writeValue(matches[0])
+	}
+}
+
+// handleLMove implements LMOVE source destination LEFT|RIGHT LEFT|RIGHT: it
+// pops an element from one end of source and pushes it onto one end of
+// destination, atomically, and replies with the element. source and
+// destination may be the same list, to rotate it.
+func (rs *RedisServer) handleLMove(c *client, args [][]byte) {
+	fromLeft, ok := parseListEnd(args[3])
+	toLeft, ok2 := parseListEnd(args[4])
+	if !ok || !ok2 {
+		c.writeError("ERR syntax error")
+		return
+	}
+
+	src, dst := string(args[1]), string(args[2])
+	tx := rs.data.Lock(src, dst)
+	list, exists, errMsg := getList(tx, src)
+	var reply resp.Value = resp.Null{}
+	if errMsg != "" {
+		reply = resp.Error{Value: errMsg}
+	} else if exists {
+		reply = rs.lmove(tx, src, list, dst, fromLeft, toLeft)
+	}
+	tx.Unlock()
+
+	c.writeValue(reply)
+}
+
+// lmove moves an element from srcList, the list stored at src, onto the list
+// at dst, and returns the reply of LMOVE. tx must hold both keys.
+func (rs *RedisServer) lmove(tx kvstore.Tx[object], src string, srcList *kvstore.Quicklist, dst string, fromLeft, toLeft bool) resp.Value {
+	dstList, exists, errMsg := getList(tx, dst)
+	if errMsg != "" {
+		return resp.Error{Value: errMsg}
+	}
+	v := listPop(srcList, fromLeft)
+	if !exists {
+		obj := newListObject()
+		tx.Insert(dst, obj)
+		dstList = obj.list
+		rs.signalKeyAsReady(dst)
+	}
+	listPush(dstList, toLeft, v)
+	if srcList.Len() == 0 {
+		tx.Delete(src)
+	}
+	return resp.BulkString{Value: v}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// bulks returns the array reply holding the given bulk strings.
+func bulks(values ...string) resp.Value {
+	arr := resp.Array{Values: make([]resp.Value, len(values))}
+	for i, v := range values {
+		arr.Values[i] = resp.BulkString{Value: []byte(v)}
+	}
+	return arr
+}
+
+func TestList_PushPop(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	null := resp.BulkString{IsNull: true}
+
+	assertReply(t, tc.do("RPUSH", "l", "a", "b"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("LPUSH", "l", "x", "y"), resp.Integer{Value: 4})
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("y", "x", "a", "b"))
+	assertReply(t, tc.do("LPUSHX", "missing", "v"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("RPUSHX", "l", "c"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("EXISTS", "missing"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("TYPE", "l"), resp.SimpleString{Value: "list"})
+
+	assertReply(t, tc.do("LPOP", "l"), resp.BulkString{Value: []byte("y")})
+	assertReply(t, tc.do("RPOP", "l", "2"), bulks("c", "b"))
+	assertReply(t, tc.do("LPOP", "l", "0"), bulks())
+	assertReply(t, tc.do("LLEN", "l"), resp.Integer{Value: 2})
+
+	// Popping the last elements deletes the key.
+	assertReply(t, tc.do("LPOP", "l", "10"), bulks("x", "a"))
+	assertReply(t, tc.do("EXISTS", "l"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("LPOP", "l"), null)
+	assertReply(t, tc.do("LPOP", "l", "1"), resp.Array{IsNull: true})
+	assertReply(t, tc.do("LLEN", "l"), resp.Integer{Value: 0})
+
+	assertReply(t, tc.do("LPOP", "l", "-1"), resp.Error{Value: "ERR value is out of range, must be positive"})
+	assertReply(t, tc.do("LPOP", "l", "1", "2"), resp.Error{Value: "ERR wrong number of arguments for 'lpop' command"})
+	assertReply(t, tc.do("RPOP", "l", "1", "2"), resp.Error{Value: "ERR wrong number of arguments for 'rpop' command"})
+	tc.do("SET", "s", "v")
+	assertReply(t, tc.do("LPUSH", "s", "v"), resp.Error{Value: errWrongType})
+	assertReply(t, tc.do("LPOP", "s"), resp.Error{Value: errWrongType})
+	assertReply(t, tc.do("LRANGE", "s", "0", "-1"), resp.Error{Value: errWrongType})
+
+	// A null array is _ in RESP3, like the other nulls.
+	tc.do("HELLO", "3")
+	assertReply(t, tc.do("RPOP", "l", "1"), resp.Null{})
+}
+
+func TestList_IndexCommands(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	null := resp.BulkString{IsNull: true}
+	ok := resp.SimpleString{Value: "OK"}
+	tc.do("RPUSH", "l", "a", "b", "c", "d", "e")
+
+	assertReply(t, tc.do("LRANGE", "l", "1", "2"), bulks("b", "c"))
+	assertReply(t, tc.do("LRANGE", "l", "-2", "100"), bulks("d", "e"))
+	assertReply(t, tc.do("LRANGE", "l", "-100", "0"), bulks("a"))
+	assertReply(t, tc.do("LRANGE", "l", "3", "1"), bulks())
+	assertReply(t, tc.do("LRANGE", "l", "5", "10"), bulks())
+	assertReply(t, tc.do("LRANGE", "missing", "0", "-1"), bulks())
+
+	assertReply(t, tc.do("LINDEX", "l", "0"), resp.BulkString{Value: []byte("a")})
+	assertReply(t, tc.do("LINDEX", "l", "-1"), resp.BulkString{Value: []byte("e")})
+	assertReply(t, tc.do("LINDEX", "l", "5"), null)
+	assertReply(t, tc.do("LINDEX", "missing", "0"), null)
+
+	assertReply(t, tc.do("LSET", "l", "-2", "D"), ok)
+	assertReply(t, tc.do("LSET", "l", "5", "x"), resp.Error{Value: "ERR index out of range"})
+	assertReply(t, tc.do("LSET", "missing", "0", "x"), resp.Error{Value: "ERR no such key"})
+
+	assertReply(t, tc.do("LINSERT", "l", "BEFORE", "a", "start"), resp.Integer{Value: 6})
+	assertReply(t, tc.do("LINSERT", "l", "after", "e", "end"), resp.Integer{Value: 7})
+	assertReply(t, tc.do("LINSERT", "l", "AFTER", "nope", "x"), resp.Integer{Value: -1})
+	assertReply(t, tc.do("LINSERT", "missing", "AFTER", "a", "x"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("LINSERT", "l", "AROUND", "a", "x"), resp.Error{Value: "ERR syntax error"})
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("start", "a", "b", "c", "D", "e", "end"))
+
+	assertReply(t, tc.do("LTRIM", "l", "1", "-2"), ok)
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("a", "b", "c", "D", "e"))
+	assertReply(t, tc.do("LTRIM", "l", "-2", "-1"), ok)
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("D", "e"))
+	assertReply(t, tc.do("LTRIM", "l", "1", "0"), ok)
+	assertReply(t, tc.do("EXISTS", "l"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("LTRIM", "missing", "0", "1"), ok)
+}
+
+func TestList_LRemLPos(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	null := resp.BulkString{IsNull: true}
+	tc.do("RPUSH", "l", "a", "x", "b", "x", "c", "x", "d")
+
+	assertReply(t, tc.do("LPOS", "l", "x"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("LPOS", "l", "x", "RANK", "2"), resp.Integer{Value: 3})
+	assertReply(t, tc.do("LPOS", "l", "x", "RANK", "-1"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("LPOS", "l", "x", "RANK", "4"), null)
+	assertReply(t, tc.do("LPOS", "l", "x", "COUNT", "0"), resp.Array{Values: []resp.Value{
+		resp.Integer{Value: 1}, resp.Integer{Value: 3}, resp.Integer{Value: 5}}})
+	assertReply(t, tc.do("LPOS", "l", "x", "RANK", "-2", "COUNT", "5"), resp.Array{Values: []resp.Value{
+		resp.Integer{Value: 3}, resp.Integer{Value: 1}}})
+	assertReply(t, tc.do("LPOS", "l", "x", "COUNT", "0", "MAXLEN", "4"), resp.Array{Values: []resp.Value{
+		resp.Integer{Value: 1}, resp.Integer{Value: 3}}})
+	assertReply(t, tc.do("LPOS", "l", "nope", "COUNT", "1"), resp.Array{Values: []resp.Value{}})
+	assertReply(t, tc.do("LPOS", "missing", "x"), null)
+	assertReply(t, tc.do("LPOS", "l", "x", "RANK", "0"), resp.Error{Value: "ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"})
+	assertReply(t, tc.do("LPOS", "l", "x", "COUNT", "-1"), resp.Error{Value: "ERR COUNT can't be negative"})
+	assertReply(t, tc.do("LPOS", "l", "x", "MAXLEN"), resp.Error{Value: "ERR syntax error"})
+
+	assertReply(t, tc.do("LREM", "l", "-2", "x"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("a", "x", "b", "c", "d"))
+	tc.do("RPUSH", "l", "x", "x")
+	assertReply(t, tc.do("LREM", "l", "1", "x"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("LREM", "l", "0", "x"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("a", "b", "c", "d"))
+	assertReply(t, tc.do("LREM", "missing", "0", "x"), resp.Integer{Value: 0})
+	tc.do("RPUSH", "l", "x", "b", "x")
+	assertReply(t, tc.do("LREM", "l", "-9223372036854775808", "x"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("LREM", "l", "9223372036854775807", "b"), resp.Integer{Value: 2})
+	assertReply(t, tc.do("LRANGE", "l", "0", "-1"), bulks("a", "c", "d"))
+}
+
+func TestList_LMove(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	tc.do("RPUSH", "src", "a", "b", "c")
+
+	assertReply(t, tc.do("LMOVE", "src", "dst", "LEFT", "RIGHT"), resp.BulkString{Value: []byte("a")})
+	assertReply(t, tc.do("LMOVE", "src", "dst", "right", "left"), resp.BulkString{Value: []byte("c")})
+	assertReply(t, tc.do("LRANGE", "dst", "0", "-1"), bulks("c", "a"))
+
+	// Moving within one list rotates it.
+	assertReply(t, tc.do("LMOVE", "dst", "dst", "LEFT", "RIGHT"), resp.BulkString{Value: []byte("c")})
+	assertReply(t, tc.do("LRANGE", "dst", "0", "-1"), bulks("a", "c"))
+
+	assertReply(t, tc.do("LMOVE", "src", "dst", "LEFT", "LEFT"), resp.BulkString{Value: []byte("b")})
+	assertReply(t, tc.do("EXISTS", "src"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("LMOVE", "src", "dst", "LEFT", "LEFT"), resp.BulkString{IsNull: true})
+
+	tc.do("SET", "s", "v")
+	assertReply(t, tc.do("LMOVE", "dst", "s", "LEFT", "LEFT"), resp.Error{Value: errWrongType})
+	assertReply(t, tc.do("LLEN", "dst"), resp.Integer{Value: 3})
+	assertReply(t, tc.do("LMOVE", "dst", "x", "UP", "LEFT"), resp.Error{Value: "ERR syntax error"})
+}
+
+func TestList_EncodingAndCopy(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	tc.do("RPUSH", "l", "a", "b")
+	assertReply(t, tc.do("OBJECT", "ENCODING", "l"), bulk("listpack"))
+	big := strings.Repeat("x", 1000)
+	for i := 0; i < 20; i++ {
+		tc.do("RPUSH", "l", big+strconv.Itoa(i))
+	}
+	assertReply(t, tc.do("OBJECT", "ENCODING", "l"), bulk("quicklist"))
+
+	// A copy is independent of the original.
+	assertReply(t, tc.do("COPY", "l", "c"), resp.Integer{Value: 1})
+	tc.do("LSET", "c", "0", "changed")
+	tc.do("RPOP", "c", "5")
+	assertReply(t, tc.do("LINDEX", "l", "0"), bulk("a"))
+	assertReply(t, tc.do("LLEN", "l"), resp.Integer{Value: 22})
+	assertReply(t, tc.do("LLEN", "c"), resp.Integer{Value: 17})
+
+	tc.do("LTRIM", "l", "0", "1")
+	assertReply(t, tc.do("OBJECT", "ENCODING", "l"), bulk("listpack"))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net"
 )
@@ -10,6 +11,18 @@ const (
 )
 
 func main() {
+	execFlag := flag.String("exec", "locking", "command execution model: locking (commands run in parallel on per-shard locks) or single (one executor goroutine, like Redis)")
+	hashEntries := flag.Int("hash-max-listpack-entries", defaultHashMaxListpackEntries, "most fields of a hash stored as a listpack")
+	hashValue := flag.Int("hash-max-listpack-value", defaultHashMaxListpackValue, "longest field or value of a hash stored as a listpack")
+	flag.Parse()
+	mode, err := ParseExecMode(*execFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *hashEntries < 0 || *hashValue < 0 {
+		log.Fatal("hash-max-listpack-entries and hash-max-listpack-value must not be negative")
+	}
+
 	listener, err := net.Listen("tcp", listenAddr)
 	if err != nil {
 		log.Fatalf("Failed to start the Redis Lite Server at port:%s. Error: %v", listenAddr, err)
@@ -17,10 +30,15 @@ func main() {
 
 	defer listener.Close()
 
-	log.Printf("TCP Server started. Listening on %s", listenAddr)
+	log.Printf("TCP Server started. Listening on %s (%s execution)", listenAddr, mode)
 	log.Println("Waiting for clients to connect...")
 
-	rs := NewRedisServer()
+	rs := NewRedisServer(ServerOptions{
+		Exec:                   mode,
+		HashMaxListpackEntries: hashEntries,
+		HashMaxListpackValue:   hashValue,
+	})
+	go rs.cron()
 
 	for {
 		conn, err := listener.Accept()
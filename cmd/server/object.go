@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"redis-lite/kvstore"
+	"redis-lite/resp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerCommands(
+		&command{name: "object", arity: -2, flags: []string{flagReadonly},
+			firstKey: 2, lastKey: 2, keyStep: 1,
+			group: "generic", since: "2.2.3", args: "<ENCODING | FREQ | IDLETIME | REFCOUNT> <key> | HELP",
+			summary: "Inspects the internals of the value stored at a key",
+			handler: (*RedisServer).handleObject},
+	)
+}
+
+// objectType tags the type of a value stored in the keyspace.
+type objectType uint8
+
+const (
+	objString objectType = iota
+	objList
+	objHash
+)
+
+// String returns the type name reported by TYPE.
+func (t objectType) String() string {
+	switch t {
+	case objString:
+		return "string"
+	case objList:
+		return "list"
+	case objHash:
+		return "hash"
+	}
+	return "unknown"
+}
+
+// objectEncoding tells how the payload of an object is represented.
+type objectEncoding uint8
+
+const (
+	encRaw       objectEncoding = iota // A string held as bytes in str
+	encInt                             // A string that is a canonical int64, held in num
+	encEmbstr                          // A short string held as bytes in str, as written by SET
+	encListpack                        // A list that fits in a single quicklist node, or a small hash
+	encQuicklist                       // A list spanning several quicklist nodes
+	encHashtable                       // A hash held in a hash table
+)
+
+// String returns the encoding name reported by OBJECT ENCODING.
+func (e objectEncoding) String() string {
+	switch e {
+	case encRaw:
+		return "raw"
+	case encInt:
+		return "int"
+	case encEmbstr:
+		return "embstr"
+	case encListpack:
+		return "listpack"
+	case encQuicklist:
+		return "quicklist"
+	case encHashtable:
+		return "hashtable"
+	}
+	return "unknown"
+}
+
+// object is a value stored in the keyspace: a type tag, how the payload is
+// encoded and the payload itself. Handlers check the tag before using the
+// payload. The rest of the metadata Redis keeps with a value, its expiry and
+// its access time and frequency, is kept by kvstore next to it.
+type object struct {
+	typ  objectType
+	enc  objectEncoding
+	str  []byte             // Payload of a raw string; see newStringObject
+	num  int64              // Payload of an int-encoded string
+	list *kvstore.Quicklist // Payload of a list, modified in place
+	hash *hashValue         // Payload of a hash, modified in place
+}
+
+const (
+	// maxIntStringLen is the length of the longest int64,
+	// "-9223372036854775808".
+	maxIntStringLen = 20
+	// maxEmbstrLen is the longest string Redis allocates together with its
+	// object header, reported as the embstr encoding.
+	maxEmbstrLen = 44
+	// sharedIntegers is the number of small integers, from 0, that Redis
+	// keeps as shared objects.
+	sharedIntegers = 10000
+	// sharedRefCount is the reference count reported for shared objects.
+	sharedRefCount = 2147483647
+)
+
+// newStringObject returns a string object holding b. Like Redis, strings that
+// are the canonical form of an integer are stored as that integer, so
+// counters need not be parsed on every increment.
+//
+// The bytes of a stored string are never modified, so replies can be written
+// from them after the key's lock is released. APPEND may however grow a
+// string into the spare capacity of its slice, which is safe as long as no
+// other object shares that capacity: b is therefore stored with its capacity
+// cut to its length, and only APPEND creates slices with room to spare.
+func newStringObject(b []byte) object {
+	if n, ok := parseInt64(b); ok {
+		return newIntObject(n)
+	}
+	enc := encRaw
+	if len(b) <= maxEmbstrLen {
+		enc = encEmbstr
+	}
+	return object{typ: objString, enc: enc, str: b[:len(b):len(b)]}
+}
+
+// newRawStringObject returns a string object holding b as is, for commands
+// that build strings piecewise, which Redis never converts to another
+// encoding.
+func newRawStringObject(b []byte) object {
+	return object{typ: objString, enc: encRaw, str: b}
+}
+
+func newIntObject(n int64) object {
+	return object{typ: objString, enc: encInt, num: n}
+}
+
+func newListObject() object {
+	return object{typ: objList, list: kvstore.NewQuicklist()}
+}
+
+// encoding returns the current encoding of o. Lists report the encoding
+// Redis would use for them: a list small enough for a single node is a
+// listpack.
+func (o object) encoding() objectEncoding {
+	switch o.typ {
+	case objList:
+		if o.list.Nodes() <= 1 {
+			return encListpack
+		}
+		return encQuicklist
+	case objHash:
+		if o.hash.lp != nil {
+			return encListpack
+		}
+		return encHashtable
+	}
+	return o.enc
+}
+
+// dup returns a copy of o that can be stored under another key.
+func (o object) dup() object {
+	switch {
+	case o.typ == objList:
+		o.list = o.list.Clone()
+	case o.typ == objHash:
+		o.hash = o.hash.clone()
+	case o.typ == objString && o.enc != encInt:
+		// The bytes can be shared, since they are never modified; only the
+		// spare capacity a string may grow into must stay with the original.
+		o.str = o.str[:len(o.str):len(o.str)]
+	}
+	return o
+}
+
+// bytes returns the value of a string object.
+func (o object) bytes() []byte {
+	if o.enc == encInt {
+		return strconv.AppendInt(nil, o.num, 10)
+	}
+	return o.str
+}
+
+// int64Value returns the value of a string object as an integer, if it is
+// one, following Redis' string2ll: no spaces, no leading '+' or zeros.
+func (o object) int64Value() (int64, bool) {
+	if o.enc == encInt {
+		return o.num, true
+	}
+	return parseInt64(o.str)
+}
+
+// parseInt64 parses b the way Redis parses integer arguments.
+func parseInt64(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > maxIntStringLen {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != string(b) {
+		return 0, false
+	}
+	return n, true
+}
+
+// errWrongType is the reply to a command used on a key of another type.
+const errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// refCount returns the reference count Redis would report for o: small
+// integers are shared objects, everything else has a single owner.
+func (o object) refCount() int64 {
+	if o.enc == encInt && o.num >= 0 && o.num < sharedIntegers {
+		return sharedRefCount
+	}
+	return 1
+}
+
+var objectHelp = []string{
+	"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"ENCODING <key>",
+	"    Return the kind of internal representation used in order to store the value",
+	"    associated with a <key>.",
+	"FREQ <key>",
+	"    Return the access frequency index of the <key>. The returned integer is",
+	"    proportional to the logarithm of the recent access frequency of the key.",
+	"IDLETIME <key>",
+	"    Return the idle time of the <key>, that is the approximated number of",
+	"    seconds elapsed since the last access to the key.",
+	"REFCOUNT <key>",
+	"    Return the number of references of the value associated with the specified",
+	"    <key>.",
+	"HELP",
+	"    Print this help.",
+}
+
+// handleObject implements OBJECT ENCODING|FREQ|IDLETIME|REFCOUNT key and
+// OBJECT HELP. Inspecting a key does not count as an access. Both the LRU
+// and the LFU metadata are always tracked, so unlike Redis IDLETIME and FREQ
+// do not depend on a maxmemory policy.
+func (rs *RedisServer) handleObject(c *client, args [][]byte) {
+	sub := strings.ToUpper(string(args[1]))
+	switch {
+	case sub == "HELP" && len(args) != 2:
+		c.writeError("ERR wrong number of arguments for 'object|help' command")
+		return
+	case sub == "HELP":
+		lines := make([]resp.Value, len(objectHelp))
+		for i, line := range objectHelp {
+			lines[i] = resp.SimpleString{Value: line}
+		}
+		c.writeValue(resp.Array{Values: lines})
+		return
+	case sub != "ENCODING" && sub != "FREQ" && sub != "IDLETIME" && sub != "REFCOUNT" && sub != "HELP":
+		c.writeError(fmt.Sprintf("ERR unknown subcommand '%s'. Try OBJECT HELP.", args[1]))
+		return
+	case len(args) != 3:
+		c.writeError(fmt.Sprintf("ERR wrong number of arguments for 'object|%s' command", strings.ToLower(sub)))
+		return
+	}
+
+	key := string(args[2])
+	tx := rs.data.Lock(key)
+	obj, ok := tx.Peek(key)
+	idle, freq, _ := tx.Access(key)
+	tx.Unlock()
+
+	if !ok {
+		c.writeValue(resp.Null{})
+		return
+	}
+	switch sub {
+	case "ENCODING":
+		c.writeValue(resp.NewBulkString(obj.encoding().String()))
+	case "FREQ":
+		c.writeValue(resp.Integer{Value: int64(freq)})
+	case "IDLETIME":
+		c.writeValue(resp.Integer{Value: idle / 1000})
+	case "REFCOUNT":
+		c.writeValue(resp.Integer{Value: obj.refCount()})
+	}
+}
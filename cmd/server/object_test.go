@@ -0,0 +1,103 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"strings"
+	"testing"
+)
+
+func TestObject_Encoding(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	encoding := func(key string) resp.Value { return tc.do("OBJECT", "ENCODING", key) }
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	tc.do("SET", "int", "12345")
+	assertReply(t, encoding("int"), bulk("int"))
+	tc.do("SET", "short", "hello")
+	assertReply(t, encoding("short"), bulk("embstr"))
+	tc.do("SET", "long", strings.Repeat("x", maxEmbstrLen+1))
+	assertReply(t, encoding("long"), bulk("raw"))
+	tc.do("SET", "padded", "0123")
+	assertReply(t, encoding("padded"), bulk("embstr"))
+
+	// Counters stay int-encoded; strings built piecewise are raw.
+	tc.do("INCRBY", "counter", "7")
+	assertReply(t, encoding("counter"), bulk("int"))
+	tc.do("APPEND", "short", "!")
+	assertReply(t, encoding("short"), bulk("raw"))
+	tc.do("SETRANGE", "range", "0", "42")
+	assertReply(t, encoding("range"), bulk("raw"))
+	assertReply(t, tc.do("INCR", "range"), resp.Integer{Value: 43})
+	assertReply(t, encoding("range"), bulk("int"))
+
+	assertReply(t, encoding("missing"), resp.BulkString{IsNull: true})
+}
+
+func TestObject_RefcountAndAccess(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	// Small integers are shared, like in Redis.
+	tc.do("SET", "small", "100")
+	assertReply(t, tc.do("OBJECT", "REFCOUNT", "small"), resp.Integer{Value: sharedRefCount})
+	tc.do("SET", "big", "100000")
+	assertReply(t, tc.do("OBJECT", "REFCOUNT", "big"), resp.Integer{Value: 1})
+	tc.do("SET", "str", "v")
+	assertReply(t, tc.do("OBJECT", "REFCOUNT", "str"), resp.Integer{Value: 1})
+
+	// A new key starts with a frequency of 5, and at that level every access
+	// counts. Inspecting the key is not an access.
+	assertReply(t, tc.do("OBJECT", "FREQ", "str"), resp.Integer{Value: 5})
+	tc.do("GET", "str")
+	assertReply(t, tc.do("OBJECT", "FREQ", "str"), resp.Integer{Value: 6})
+	tc.do("TYPE", "str")
+	tc.do("EXISTS", "str")
+	tc.do("TTL", "str")
+	assertReply(t, tc.do("OBJECT", "FREQ", "str"), resp.Integer{Value: 6})
+	assertReply(t, tc.do("OBJECT", "IDLETIME", "str"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("OBJECT", "IDLETIME", "missing"), resp.BulkString{IsNull: true})
+}
+
+func TestObject_FreqOfWrittenKey(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	// A write looks the key up once, so it counts as a single access: from
+	// the initial 5 the counter goes to exactly 6. Anything more would mean
+	// the write was counted twice.
+	writes := [][]string{
+		{"SET", "k", "v2"},
+		{"APPEND", "k", "x"},
+		{"SETRANGE", "k", "0", "x"},
+		{"GETSET", "k", "v2"},
+		{"MSET", "k", "v2"},
+		{"SETEX", "k", "100", "v2"},
+	}
+	for _, write := range writes {
+		tc.do("SET", "k", "v")
+		assertReply(t, tc.do("OBJECT", "FREQ", "k"), resp.Integer{Value: 5})
+		tc.do(write...)
+		assertReply(t, tc.do("OBJECT", "FREQ", "k"), resp.Integer{Value: 6})
+		tc.do("DEL", "k")
+	}
+	for _, write := range [][]string{{"INCR", "n"}, {"INCRBYFLOAT", "n", "1.5"}} {
+		tc.do("SET", "n", "1")
+		tc.do(write...)
+		assertReply(t, tc.do("OBJECT", "FREQ", "n"), resp.Integer{Value: 6})
+		tc.do("DEL", "n")
+	}
+}
+
+func TestObject_Errors(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("OBJECT", "foo", "k"), resp.Error{Value: "ERR unknown subcommand 'foo'. Try OBJECT HELP."})
+	assertReply(t, tc.do("OBJECT", "encoding"), resp.Error{Value: "ERR wrong number of arguments for 'object|encoding' command"})
+	assertReply(t, tc.do("OBJECT", "FREQ", "a", "b"), resp.Error{Value: "ERR wrong number of arguments for 'object|freq' command"})
+	tc.do("SET", "k", "v")
+	assertReply(t, tc.do("OBJECT", "HELP", "k"), resp.Error{Value: "ERR wrong number of arguments for 'object|help' command"})
+	assertReply(t, tc.do("OBJECT", "help", "k", "x"), resp.Error{Value: "ERR wrong number of arguments for 'object|help' command"})
+
+	help, ok := tc.do("OBJECT", "HELP").(resp.Array)
+	if !ok || len(help.Values) != len(objectHelp) {
+		t.Errorf("OBJECT HELP = %#v; want %d lines", help, len(objectHelp))
+	}
+}
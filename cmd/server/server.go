@@ -1,128 +1,219 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"redis-lite/kvstore"
 	"redis-lite/resp"
+	"strconv"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	serverName    = "redis"
+	serverVersion = "7.2.0"
+
+	// cronInterval is how often background maintenance runs, like Redis'
+	// default hz of 10.
+	cronInterval = 100 * time.Millisecond
+	// rehashBudget caps the time one cron run spends moving buckets.
+	rehashBudget = time.Millisecond
+	// rehashBatch is the number of buckets moved per shard lock acquisition.
+	rehashBatch = 100
+
+	// storeShards is the number of independently locked parts of the
+	// keyspace.
+	storeShards = 16
+
+	// execQueueSize is how many commands can wait for the single executor
+	// before connection goroutines block handing them over.
+	execQueueSize = 256
 )
 
 type RedisServer struct {
-	data  *kvstore.HashTable
-	mutex sync.RWMutex
+	data         *kvstore.Store[object]
+	limits       resp.Limits
+	nextClientID atomic.Int64
+	requests     chan execRequest // Feeds the executor in ExecSingle mode; nil otherwise
+	blocked      blockedKeys      // Clients blocked on list keys
+	hashLimits   hashLimits       // When hashes convert from listpacks to hash tables
 }
 
-func NewRedisServer() *RedisServer {
-	return &RedisServer{
-		data:  kvstore.NewHashTable(),
-		mutex: sync.RWMutex{},
-	}
+// ServerOptions configures a RedisServer. The zero value selects the
+// defaults.
+type ServerOptions struct {
+	Exec ExecMode // How commands are executed; ExecLocking by default
+
+	// HashMaxListpackEntries and HashMaxListpackValue are the largest number
+	// of fields, and the longest field or value, of a hash stored as a
+	// listpack, like Redis' hash-max-listpack-entries (128 by default) and
+	// hash-max-listpack-value (64 by default). Nil selects the default; 0
+	// is a valid limit, so a zero HashMaxListpackEntries stores every
+	// hash as a hash table.
+	HashMaxListpackEntries *int
+	HashMaxListpackValue   *int
 }
 
-func (rs *RedisServer) sendError(writer *bufio.Writer, errorStr string) {
-	errResp := resp.Error{Value: errorStr}
-	_, err := writer.Write(resp.Serialize(errResp))
-	if err != nil {
-		log.Printf("Error sending error: %v", err)
-		return
+func NewRedisServer(opts ...ServerOptions) *RedisServer {
+	rs := &RedisServer{
+		data:   kvstore.NewStore[object](storeShards, kvstore.SeededHash),
+		limits: resp.DefaultLimits,
+		hashLimits: hashLimits{
+			maxEntries: defaultHashMaxListpackEntries,
+			maxValue:   defaultHashMaxListpackValue,
+		},
 	}
-	writer.Flush()
+	if len(opts) > 0 {
+		if opts[0].HashMaxListpackEntries != nil {
+			rs.hashLimits.maxEntries = *opts[0].HashMaxListpackEntries
+		}
+		if opts[0].HashMaxListpackValue != nil {
+			rs.hashLimits.maxValue = *opts[0].HashMaxListpackValue
+		}
+	}
+	if len(opts) > 0 && opts[0].Exec == ExecSingle {
+		rs.requests = make(chan execRequest, execQueueSize)
+		go rs.executor()
+	}
+	return rs
 }
 
-func (rs *RedisServer) handlePing(writer *bufio.Writer) {
-	pong := resp.SimpleString{Value: "PONG"}
-	_, err := writer.Write(resp.Serialize(pong))
-	if err != nil {
-		log.Printf("Error sending pong: %v", err)
-		return
+// cron runs background maintenance until the process exits: it deletes
+// expired keys nobody reads and finishes incremental rehashes that client
+// commands alone would leave half done while the server is idle.
+func (rs *RedisServer) cron() {
+	ticker := time.NewTicker(cronInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		rs.runTask(func() {
+			rs.activeExpireCycle()
+			rs.rehashCycle()
+		})
 	}
 }
 
-func (rs *RedisServer) handleEcho(writer *bufio.Writer, parts []string) {
-	var echo resp.BulkString
-	if len(parts) > 1 {
-		echo = resp.BulkString{Value: strings.Join(parts[1:], " ")}
-	} else {
-		echo = resp.BulkString{Value: ""}
+// rehashCycle moves buckets of an ongoing rehash in small batches, locking one
+// shard at a time, until it is done or the time budget runs out.
+func (rs *RedisServer) rehashCycle() {
+	deadline := time.Now().Add(rehashBudget)
+	for time.Now().Before(deadline) {
+		if !rs.data.Rehash(rehashBatch) {
+			return
+		}
 	}
-	_, err := writer.Write(resp.Serialize(echo))
-	if err != nil {
-		log.Printf("Error sending pong: %v", err)
+}
+
+func (rs *RedisServer) handlePing(c *client, args [][]byte) {
+	if len(args) == 2 {
+		c.writeBulk(args[1])
 		return
 	}
+	c.writeValue(resp.SimpleString{Value: "PONG"})
 }
 
-func (rs *RedisServer) handleGetCommand(writer *bufio.Writer, parts []string) {
-	rs.mutex.RLock()
-	defer rs.mutex.RUnlock()
+func (rs *RedisServer) handleEcho(c *client, args [][]byte) {
+	c.writeBulk(args[1])
+}
 
-	if len(parts) != 2 {
-		rs.sendError(writer, "ERR wrong number of arguments for 'get' command")
-		return
-	}
+// handleHello implements HELLO [protover [AUTH username password] [SETNAME clientname]].
+// Options are validated before anything is applied, so a failing HELLO leaves
+// the connection as it was.
+func (rs *RedisServer) handleHello(c *client, args [][]byte) {
+	proto := c.out.Protocol()
+	name := c.name
+	setName := false
 
-	value, ok := rs.data.Get(parts[1])
-	if !ok {
-		serverResp := resp.BulkString{IsNull: true}
-		_, err := writer.Write(resp.Serialize(serverResp))
+	if len(args) > 1 {
+		ver, err := strconv.Atoi(string(args[1]))
 		if err != nil {
-			log.Printf("Error sending OK response")
+			c.writeError("ERR Protocol version is not an integer or out of range")
 			return
 		}
+		if ver != resp.RESP2 && ver != resp.RESP3 {
+			c.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = ver
+
+		for i := 2; i < len(args); i++ {
+			remaining := len(args) - i - 1
+			switch strings.ToUpper(string(args[i])) {
+			case "AUTH":
+				if remaining < 2 {
+					c.writeError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i]))
+					return
+				}
+				// There are no users besides the password-less default one.
+				if string(args[i+1]) != "default" {
+					c.writeError("WRONGPASS invalid username-password pair or user is disabled.")
+					return
+				}
+				i += 2
+			case "SETNAME":
+				if remaining < 1 {
+					c.writeError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i]))
+					return
+				}
+				if !validClientName(args[i+1]) {
+					c.writeError("ERR Client names cannot contain spaces, newlines or special characters.")
+					return
+				}
+				name = string(args[i+1])
+				setName = true
+				i++
+			default:
+				c.writeError(fmt.Sprintf("ERR Syntax error in HELLO option '%s'", args[i]))
+				return
+			}
+		}
 	}
 
-	serverResp := resp.BulkString{Value: value.(string), IsNull: false}
-	_, err := writer.Write(resp.Serialize(serverResp))
-	if err != nil {
-		log.Printf("Error sending OK response")
-		return
-	}
-}
-
-func (rs *RedisServer) handleSetCommand(writer *bufio.Writer, parts []string) {
-	
-
-	if len(parts) != 3 {
-		rs.sendError(writer, "ERR syntax error")
-		return
+	c.out.SetProtocol(proto)
+	if setName {
+		c.name = name
 	}
 
-	rs.mutex.Lock()	
-	rs.data.Insert(parts[1], parts[2])
-	rs.mutex.Unlock()
-
-	
-	serverResp := resp.SimpleString{Value: "OK"}
-	_, err := writer.Write(resp.Serialize(serverResp))
-	if err != nil {
-		log.Printf("Error sending OK response")
-		return
-	}
+	c.writeValue(resp.Map{Entries: []resp.MapEntry{
+		{Key: resp.NewBulkString("server"), Value: resp.NewBulkString(serverName)},
+		{Key: resp.NewBulkString("version"), Value: resp.NewBulkString(serverVersion)},
+		{Key: resp.NewBulkString("proto"), Value: resp.Integer{Value: int64(proto)}},
+		{Key: resp.NewBulkString("id"), Value: resp.Integer{Value: c.id}},
+		{Key: resp.NewBulkString("mode"), Value: resp.NewBulkString("standalone")},
+		{Key: resp.NewBulkString("role"), Value: resp.NewBulkString("master")},
+		{Key: resp.NewBulkString("modules"), Value: resp.Array{Values: []resp.Value{}}},
+	}})
 }
 
-func (rs *RedisServer) handleHelp(writer *bufio.Writer) {
-	help := resp.BulkString{Value: "PING: Returns PONG\nECHO <message>: Returns the provided message\nGET <key>: Returns the value associated with the key\nSET <key> <value>: Sets the value for the given key"}
-	_, err := writer.Write(resp.Serialize(help))
-	if err != nil {
-		log.Printf("Error sending help: %v", err)
-		return
+// validClientName reports whether name only contains printable characters
+// other than space, as Redis requires for client names.
+func validClientName(name []byte) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
 	}
+	return true
 }
 
 func (rs *RedisServer) handleConnection(conn net.Conn) {
 	defer conn.Close()
 	log.Printf("Accepted connection from %s", conn.RemoteAddr().String())
 
-	reader := bufio.NewReader(conn)
-	writer := bufio.NewWriter(conn)
+	c := newClient(rs.nextClientID.Add(1), conn)
 
 	for {
-		input, err := resp.Deserialize(reader)
+		input, err := resp.ReadCommand(c.reader, rs.limits)
 		if err != nil {
+			// Malformed or oversized input leaves the stream at an unknown
+			// position, so report it the way Redis does and hang up.
+			if errors.Is(err, resp.ErrProtocol) || errors.Is(err, resp.ErrTooLarge) {
+				c.writeError("ERR " + err.Error())
+				c.flush()
+			}
 			log.Printf("Connection closed: %v", err)
 			return
 		}
@@ -132,59 +223,30 @@ func (rs *RedisServer) handleConnection(conn net.Conn) {
 		// array length cannot be zero. There has to be something in there right?
 		clientArray, ok := input.(resp.Array)
 		if !ok || len(clientArray.Values) == 0 {
-			errResp := resp.Error{Value: "ERR invalid command format"}
-			_, err = writer.Write(resp.Serialize(errResp))
-			if err != nil {
-				log.Printf("Error sending error: %v", err)
-				return
-			}
-			writer.Flush()
+			c.writeError("ERR invalid command format")
+			c.flushIfIdle()
 			continue
 		}
 
 		// Get the command
-		command, ok := clientArray.Values[0].(resp.BulkString)
-		if !ok {
-			errResp := resp.Error{Value: "ERR invalid command format"}
-			_, err = writer.Write(resp.Serialize(errResp))
-			if err != nil {
-				log.Printf("Error sending error: %v", err)
-				return
-			}
-			writer.Flush()
+		if _, ok := clientArray.Values[0].(resp.BulkString); !ok {
+			c.writeError("ERR invalid command format")
+			c.flushIfIdle()
 			continue
 		}
 
-		commandStr := strings.ToUpper(command.Value)
-		parts := make([]string, len(clientArray.Values))
+		args := make([][]byte, len(clientArray.Values))
 		for i, val := range clientArray.Values {
 			if bulk, ok := val.(resp.BulkString); ok {
-				parts[i] = bulk.Value
-			} else {
-				parts[i] = ""
+				args[i] = bulk.Value
 			}
 		}
 
-		switch commandStr {
-		case "PING":
-			rs.handlePing(writer)
-		case "ECHO":
-			rs.handleEcho(writer, parts)
-		case "GET":
-			rs.handleGetCommand(writer, parts)
-		case "SET":
-			rs.handleSetCommand(writer, parts)
-		case "HELP":
-			rs.handleHelp(writer)
-		default:
-			errResp := resp.Error{Value: fmt.Sprintf("ERR unknown command '%s'", commandStr)}
-			_, err = writer.Write(resp.Serialize(errResp))
-			if err != nil {
-				log.Printf("Error sending error: %v", err)
-				return
-			}
+		rs.execute(c, args)
+		if c.blocked != nil && !rs.waitUnblocked(c) {
+			log.Printf("Connection closed while blocked")
+			return
 		}
-
-		writer.Flush()
+		c.flushIfIdle()
 	}
 }
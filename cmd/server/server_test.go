@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"redis-lite/resp"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testConn is a client connected to an in-process RedisServer over a pipe.
+type testConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func newTestConn(t *testing.T, rs *RedisServer) *testConn {
+	t.Helper()
+	serverSide, clientSide := net.Pipe()
+	go rs.handleConnection(serverSide)
+	t.Cleanup(func() { clientSide.Close() })
+	return &testConn{t: t, conn: clientSide, reader: bufio.NewReader(clientSide)}
+}
+
+// do sends a command as a RESP array of bulk strings and returns the reply.
+func (tc *testConn) do(args ...string) resp.Value {
+	tc.t.Helper()
+	tc.send(args...)
+	return tc.read()
+}
+
+// send sends a command without waiting for the reply.
+func (tc *testConn) send(args ...string) {
+	tc.t.Helper()
+	cmd := resp.Array{Values: make([]resp.Value, len(args))}
+	for i, arg := range args {
+		cmd.Values[i] = resp.NewBulkString(arg)
+	}
+	if _, err := tc.conn.Write(resp.Serialize(cmd)); err != nil {
+		tc.t.Fatalf("write %v: %v", args, err)
+	}
+}
+
+func (tc *testConn) read() resp.Value {
+	tc.t.Helper()
+	reply, err := resp.Deserialize(tc.reader)
+	if err != nil {
+		tc.t.Fatalf("read reply: %v", err)
+	}
+	return reply
+}
+
+func assertReply(t *testing.T, got, want resp.Value) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reply = %#v; want %#v", got, want)
+	}
+}
+
+func TestHello_ProtocolNegotiation(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	// RESP2 is the default: nulls are null bulk strings.
+	assertReply(t, tc.do("GET", "missing"), resp.BulkString{IsNull: true})
+
+	reply, ok := tc.do("HELLO", "3", "SETNAME", "worker-1").(resp.Map)
+	if !ok {
+		t.Fatalf("HELLO 3 reply is %T; want resp.Map", reply)
+	}
+	fields := map[string]resp.Value{}
+	for _, e := range reply.Entries {
+		fields[e.Key.String()] = e.Value
+	}
+	assertReply(t, fields["proto"], resp.Integer{Value: 3})
+	assertReply(t, fields["server"], resp.BulkString{Value: []byte("redis")})
+
+	assertReply(t, tc.do("GET", "missing"), resp.Null{})
+
+	// Switching back flattens the info map into an array.
+	flat, ok := tc.do("HELLO", "2").(resp.Array)
+	if !ok || len(flat.Values) != 2*len(reply.Entries) {
+		t.Fatalf("HELLO 2 reply = %#v; want flat array of %d elements", flat, 2*len(reply.Entries))
+	}
+	assertReply(t, tc.do("GET", "missing"), resp.BulkString{IsNull: true})
+}
+
+func TestHello_Errors(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("HELLO", "4"), resp.Error{Value: "NOPROTO unsupported protocol version"})
+	assertReply(t, tc.do("HELLO", "three"), resp.Error{Value: "ERR Protocol version is not an integer or out of range"})
+	assertReply(t, tc.do("HELLO", "3", "SETNAME"), resp.Error{Value: "ERR Syntax error in HELLO option 'SETNAME'"})
+	assertReply(t, tc.do("HELLO", "3", "SETNAME", "bad name"), resp.Error{Value: "ERR Client names cannot contain spaces, newlines or special characters."})
+	assertReply(t, tc.do("HELLO", "3", "AUTH", "alice", "secret"), resp.Error{Value: "WRONGPASS invalid username-password pair or user is disabled."})
+
+	// None of the failed attempts may have switched the protocol.
+	assertReply(t, tc.do("GET", "missing"), resp.BulkString{IsNull: true})
+}
+
+func TestProtocolError_ClosesConnection(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	if _, err := tc.conn.Write([]byte("*1\r\n$abc\r\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	assertReply(t, tc.read(), resp.Error{Value: "ERR Protocol error: invalid bulk length"})
+
+	if _, err := resp.Deserialize(tc.reader); err == nil {
+		t.Errorf("connection still open after protocol error")
+	}
+}
+
+func TestInlineCommands(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	if _, err := tc.conn.Write([]byte("SET greeting \"hello world\"\nGET greeting\r\nPING\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	assertReply(t, tc.read(), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.read(), resp.BulkString{Value: []byte("hello world")})
+	assertReply(t, tc.read(), resp.SimpleString{Value: "PONG"})
+}
+
+func TestSetGet_BinarySafe(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	payload := []byte{0x00, 0xff, '\r', '\n', 0x80, '$', '-', '1'}
+
+	cmd := resp.Array{Values: []resp.Value{
+		resp.NewBulkString("SET"),
+		resp.NewBulkString("blob"),
+		resp.BulkString{Value: payload},
+	}}
+	if _, err := tc.conn.Write(resp.Serialize(cmd)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	assertReply(t, tc.read(), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("GET", "blob"), resp.BulkString{Value: payload})
+}
+
+func TestDispatch_Errors(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("SET", "onlykey"), resp.Error{Value: "ERR wrong number of arguments for 'set' command"})
+	assertReply(t, tc.do("get"), resp.Error{Value: "ERR wrong number of arguments for 'get' command"})
+	assertReply(t, tc.do("ECHO"), resp.Error{Value: "ERR wrong number of arguments for 'echo' command"})
+	assertReply(t, tc.do("ECHO", "a", "b"), resp.Error{Value: "ERR wrong number of arguments for 'echo' command"})
+	assertReply(t, tc.do("PING", "a", "b"), resp.Error{Value: "ERR wrong number of arguments for 'ping' command"})
+	assertReply(t, tc.do("ECHO", "hi there"), resp.BulkString{Value: []byte("hi there")})
+	assertReply(t, tc.do("PING", "hi"), resp.BulkString{Value: []byte("hi")})
+	assertReply(t, tc.do("NOPE", "a", "b"), resp.Error{Value: "ERR unknown command 'NOPE', with args beginning with: 'a' 'b' "})
+	assertReply(t, tc.do("SET", "k", "v", "bogus"), resp.Error{Value: "ERR syntax error"})
+}
+
+func TestCommand_Introspection(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	assertReply(t, tc.do("COMMAND", "COUNT"), resp.Integer{Value: int64(len(commandTable))})
+
+	all, ok := tc.do("COMMAND").(resp.Array)
+	if !ok || len(all.Values) != len(commandTable) {
+		t.Fatalf("COMMAND returned %d entries; want %d", len(all.Values), len(commandTable))
+	}
+
+	info, ok := tc.do("COMMAND", "INFO", "get", "nosuchcommand").(resp.Array)
+	if !ok || len(info.Values) != 2 {
+		t.Fatalf("COMMAND INFO reply = %#v", info)
+	}
+	get := info.Values[0].(resp.Array)
+	assertReply(t, get.Values[0], resp.BulkString{Value: []byte("get")})
+	assertReply(t, get.Values[1], resp.Integer{Value: 2})
+	// RESP2 connection: the flag set arrives as an array.
+	assertReply(t, get.Values[2], resp.Array{Values: []resp.Value{resp.SimpleString{Value: "readonly"}, resp.SimpleString{Value: "fast"}}})
+	assertReply(t, get.Values[3], resp.Integer{Value: 1})
+	assertReply(t, info.Values[1], resp.BulkString{IsNull: true})
+
+	tc.do("HELLO", "3")
+	docs, ok := tc.do("COMMAND", "DOCS", "set").(resp.Map)
+	if !ok || len(docs.Entries) != 1 {
+		t.Fatalf("COMMAND DOCS reply = %#v", docs)
+	}
+	assertReply(t, docs.Entries[0].Key, resp.BulkString{Value: []byte("set")})
+
+	assertReply(t, tc.do("COMMAND", "BOGUS"), resp.Error{Value: "ERR unknown subcommand or wrong number of arguments for 'BOGUS'. Try COMMAND HELP."})
+}
+
+func TestHelp_ListsCommandTable(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+
+	help, ok := tc.do("HELP").(resp.BulkString)
+	if !ok {
+		t.Fatalf("HELP reply is %T; want bulk string", help)
+	}
+	for name := range commandTable {
+		if !bytes.Contains(help.Value, []byte(strings.ToUpper(name))) {
+			t.Errorf("HELP output does not mention %s", strings.ToUpper(name))
+		}
+	}
+}
+
+func TestRehashCycle_FinishesRehash(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+
+	// Enough keys that every shard grows past its initial capacity.
+	for i := 0; i < 5000; i++ {
+		tc.do("SET", "key:"+strconv.Itoa(i), "v")
+	}
+	// Rehash(0) moves nothing and only reports whether a rehash is still in
+	// progress; each cycle has a small time budget, so repeat until done.
+	for rs.data.Rehash(0) {
+		rs.rehashCycle()
+	}
+	assertReply(t, tc.do("DBSIZE"), resp.Integer{Value: 5000})
+	assertReply(t, tc.do("GET", "key:4999"), resp.BulkString{Value: []byte("v")})
+}
+
+// countingConn counts the writes made on a connection.
+type countingConn struct {
+	net.Conn
+	writes atomic.Int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.writes.Add(1)
+	return c.Conn.Write(b)
+}
+
+// Hundreds of commands sent in a single write must be answered in order, and
+// with far fewer writes than commands.
+func TestPipelining(t *testing.T) {
+	for _, mode := range []ExecMode{ExecLocking, ExecSingle} {
+		t.Run(mode.String(), func(t *testing.T) {
+			const n = 500
+			serverSide, clientSide := net.Pipe()
+			counted := &countingConn{Conn: serverSide}
+			go NewRedisServer(ServerOptions{Exec: mode}).handleConnection(counted)
+			t.Cleanup(func() { clientSide.Close() })
+			tc := &testConn{t: t, conn: clientSide, reader: bufio.NewReader(clientSide)}
+
+			var batch []byte
+			for i := 0; i < n; i++ {
+				batch = resp.Array{Values: []resp.Value{
+					resp.NewBulkString("SET"), resp.NewBulkString("key:" + strconv.Itoa(i)), resp.NewBulkString(strconv.Itoa(i)),
+				}}.AppendTo(batch)
+				batch = resp.Array{Values: []resp.Value{
+					resp.NewBulkString("GET"), resp.NewBulkString("key:" + strconv.Itoa(i)),
+				}}.AppendTo(batch)
+			}
+			// An inline command at the end of the pipeline.
+			batch = append(batch, "DBSIZE\r\n"...)
+
+			// net.Pipe is unbuffered, so write while the replies are read.
+			go clientSide.Write(batch)
+			for i := 0; i < n; i++ {
+				assertReply(t, tc.read(), resp.SimpleString{Value: "OK"})
+				assertReply(t, tc.read(), resp.BulkString{Value: []byte(strconv.Itoa(i))})
+			}
+			assertReply(t, tc.read(), resp.Integer{Value: n})
+
+			if writes := counted.writes.Load(); writes > n/10 {
+				t.Errorf("%d commands were answered with %d writes; want at most %d", 2*n+1, writes, n/10)
+			}
+		})
+	}
+}
+
+// Replies larger than the flush threshold are sent as they pile up, without
+// waiting for the rest of the pipeline.
+func TestPipelining_LargeReplies(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	value := strings.Repeat("x", replyFlushThreshold/4)
+	tc.do("SET", "big", value)
+
+	var batch []byte
+	for i := 0; i < 100; i++ {
+		batch = append(batch, "GET big\r\n"...)
+	}
+	go tc.conn.Write(batch)
+	for i := 0; i < 100; i++ {
+		assertReply(t, tc.read(), resp.BulkString{Value: []byte(value)})
+	}
+	assertReply(t, tc.do("PING"), resp.SimpleString{Value: "PONG"})
+}
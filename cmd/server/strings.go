@@ -0,0 +1,770 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"redis-lite/kvstore"
+	"redis-lite/resp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	keyed := func(c *command) *command {
+		c.firstKey, c.lastKey, c.keyStep = 1, 1, 1
+		c.group = "string"
+		return c
+	}
+	registerCommands(
+		keyed(&command{name: "get", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "1.0.0", args: "<key>",
+			summary: "Returns the value associated with the key",
+			handler: (*RedisServer).handleGetCommand}),
+		keyed(&command{name: "set", arity: -3, flags: []string{flagWrite, flagDenyOOM},
+			since: "1.0.0", args: "<key> <value> [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]",
+			summary: "Sets the value for the given key, optionally with an expiry",
+			handler: (*RedisServer).handleSetCommand}),
+		keyed(&command{name: "setnx", arity: 3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key> <value>",
+			summary: "Sets the value of a key only when the key doesn't exist",
+			handler: (*RedisServer).handleSetNX}),
+		keyed(&command{name: "setex", arity: 4, flags: []string{flagWrite, flagDenyOOM},
+			since: "2.0.0", args: "<key> <seconds> <value>",
+			summary: "Sets the value and expiration time in seconds of a key",
+			handler: (*RedisServer).handleSetEx}),
+		keyed(&command{name: "psetex", arity: 4, flags: []string{flagWrite, flagDenyOOM},
+			since: "2.6.0", args: "<key> <milliseconds> <value>",
+			summary: "Sets the value and expiration time in milliseconds of a key",
+			handler: (*RedisServer).handleSetEx}),
+		keyed(&command{name: "getset", arity: 3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key> <value>",
+			summary: "Sets a new value for a key and returns the previous one",
+			handler: (*RedisServer).handleGetSet}),
+		keyed(&command{name: "getdel", arity: 2, flags: []string{flagWrite, flagFast},
+			since: "6.2.0", args: "<key>",
+			summary: "Returns the value of a key and deletes the key",
+			handler: (*RedisServer).handleGetDel}),
+		keyed(&command{name: "getex", arity: -2, flags: []string{flagWrite, flagFast},
+			since: "6.2.0", args: "<key> [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]",
+			summary: "Returns the value of a key and optionally changes its expiration",
+			handler: (*RedisServer).handleGetEx}),
+		keyed(&command{name: "incr", arity: 2, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key>",
+			summary: "Increments the integer value of a key by one",
+			handler: (*RedisServer).handleIncr}),
+		keyed(&command{name: "decr", arity: 2, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key>",
+			summary: "Decrements the integer value of a key by one",
+			handler: (*RedisServer).handleIncr}),
+		keyed(&command{name: "incrby", arity: 3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key> <increment>",
+			summary: "Increments the integer value of a key by a number",
+			handler: (*RedisServer).handleIncr}),
+		keyed(&command{name: "decrby", arity: 3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "1.0.0", args: "<key> <decrement>",
+			summary: "Decrements the integer value of a key by a number",
+			handler: (*RedisServer).handleIncr}),
+		keyed(&command{name: "incrbyfloat", arity: 3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.6.0", args: "<key> <increment>",
+			summary: "Increments the floating point value of a key by a number",
+			handler: (*RedisServer).handleIncrByFloat}),
+		keyed(&command{name: "append", arity: 3, flags: []string{flagWrite, flagDenyOOM, flagFast},
+			since: "2.0.0", args: "<key> <value>",
+			summary: "Appends a string to the value of a key, creating the key if needed",
+			handler: (*RedisServer).handleAppend}),
+		keyed(&command{name: "strlen", arity: 2, flags: []string{flagReadonly, flagFast},
+			since: "2.2.0", args: "<key>",
+			summary: "Returns the length of a string value",
+			handler: (*RedisServer).handleStrlen}),
+		keyed(&command{name: "getrange", arity: 4, flags: []string{flagReadonly},
+			since: "2.4.0", args: "<key> <start> <end>",
+			summary: "Returns a substring of the string stored at a key",
+			handler: (*RedisServer).handleGetRange}),
+		keyed(&command{name: "substr", arity: 4, flags: []string{flagReadonly},
+			since: "1.0.0", args: "<key> <start> <end>",
+			summary: "Returns a substring of the string stored at a key",
+			handler: (*RedisServer).handleGetRange}),
+		keyed(&command{name: "setrange", arity: 4, flags: []string{flagWrite, flagDenyOOM},
+			since: "2.2.0", args: "<key> <offset> <value>",
+			summary: "Overwrites part of a string at an offset, padding it with zero bytes if needed",
+			handler: (*RedisServer).handleSetRange}),
+		&command{name: "mget", arity: -2, flags: []string{flagReadonly, flagFast},
+			firstKey: 1, lastKey: -1, keyStep: 1,
+			group: "string", since: "1.0.0", args: "<key> [key ...]",
+			summary: "Returns the values of one or more keys",
+			handler: (*RedisServer).handleMGet},
+		&command{name: "mset", arity: -3, flags: []string{flagWrite, flagDenyOOM},
+			firstKey: 1, lastKey: -1, keyStep: 2,
+			group: "string", since: "1.0.1", args: "<key> <value> [key value ...]",
+			summary: "Atomically sets the values of one or more keys",
+			handler: (*RedisServer).handleMSet},
+		&command{name: "msetnx", arity: -3, flags: []string{flagWrite, flagDenyOOM},
+			firstKey: 1, lastKey: -1, keyStep: 2,
+			group: "string", since: "1.0.1", args: "<key> <value> [key value ...]",
+			summary: "Atomically sets the values of one or more keys only when none of them exist",
+			handler: (*RedisServer).handleMSet},
+		&command{name: "lcs", arity: -3, flags: []string{flagReadonly},
+			firstKey: 1, lastKey: 2, keyStep: 1,
+			group: "string", since: "7.0.0", args: "<key1> <key2> [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN]",
+			summary: "Finds the longest common substring of two strings",
+			handler: (*RedisServer).handleLCS},
+	)
+}
+
+// errStringTooLong is the reply to a command that would make a string longer
+// than the largest accepted bulk string, Redis' proto-max-bulk-len.
+const errStringTooLong = "ERR string exceeds maximum allowed size (proto-max-bulk-len)"
+
+// stringOptions holds the options shared by SET and GETEX.
+type stringOptions struct {
+	expireAt int64 // Absolute expiry in Unix milliseconds; 0 for none
+	keepTTL  bool  // SET: keep the current expiry
+	persist  bool  // GETEX: remove the expiry
+	nx, xx   bool  // SET: only set if the key does not / does exist
+	get      bool  // SET: reply with the previous value
+}
+
+// parseStringOptions parses the options following the key (and value) of
+// SET, when isSet is true, or GETEX. Like Redis, each command only accepts
+// its own options and at most one way of setting the expiry. On failure it
+// returns the error reply to send.
+func parseStringOptions(args [][]byte, name string, isSet bool) (opts stringOptions, errMsg string) {
+	hasExpire := false
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch {
+		case opt == "NX" && isSet && !opts.xx:
+			opts.nx = true
+		case opt == "XX" && isSet && !opts.nx:
+			opts.xx = true
+		case opt == "GET" && isSet:
+			opts.get = true
+		case opt == "KEEPTTL" && isSet && !hasExpire:
+			opts.keepTTL = true
+		case opt == "PERSIST" && !isSet && !hasExpire:
+			opts.persist = true
+		case (opt == "EX" || opt == "PX" || opt == "EXAT" || opt == "PXAT") &&
+			!hasExpire && !opts.keepTTL && !opts.persist && i+1 < len(args):
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return opts, "ERR value is not an integer or out of range"
+			}
+			at, ok := expireDeadline(n, opt[0] == 'P', strings.HasSuffix(opt, "AT"), nowMs())
+			if n <= 0 || !ok {
+				return opts, fmt.Sprintf("ERR invalid expire time in '%s' command", name)
+			}
+			opts.expireAt = at
+			hasExpire = true
+		default:
+			return opts, "ERR syntax error"
+		}
+	}
+	return opts, ""
+}
+
+// set stores value under key according to opts and returns the previous
+// value, if any, and whether the value was stored. SET overwrites values of
+// any type, but with the GET option the previous value must be a string;
+// otherwise nothing is stored and errMsg is the error reply to send.
+func (rs *RedisServer) set(key string, value []byte, opts stringOptions) (old []byte, existed, stored bool, errMsg string) {
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	prev, existed := tx.Get(key)
+	if existed && opts.get {
+		if prev.typ != objString {
+			return nil, existed, false, errWrongType
+		}
+		old = prev.bytes()
+	}
+	if (opts.nx && existed) || (opts.xx && !existed) {
+		return old, existed, false, ""
+	}
+
+	expireAt := opts.expireAt
+	if opts.keepTTL {
+		expireAt, _ = tx.ExpireAt(key)
+	}
+	// The argument was freshly allocated by the decoder, so it is stored as
+	// is rather than copied.
+	tx.Insert(key, newStringObject(value))
+	if expireAt != 0 {
+		tx.SetExpire(key, expireAt)
+	}
+	return old, existed, true, ""
+}
+
+// getString returns the string stored under key, whose shard tx must hold.
+// errMsg is set if the key holds another type.
+func getString(tx kvstore.Tx[object], key string) (value []byte, ok bool, errMsg string) {
+	obj, ok := tx.Get(key)
+	if ok && obj.typ != objString {
+		return nil, false, errWrongType
+	}
+	return obj.bytes(), ok, ""
+}
+
+func (rs *RedisServer) handleGetCommand(c *client, args [][]byte) {
+	// Get deletes the key if it expired, so the shard is locked for writing.
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	value, ok, errMsg := getString(tx, key)
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !ok:
+		c.writeValue(resp.Null{})
+	default:
+		// Stored values are never modified in place, so the slice can be
+		// written out after the lock is released.
+		c.writeBulk(value)
+	}
+}
+
+// handleSetCommand implements SET key value [NX | XX] [GET] [EX seconds |
+// PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds |
+// KEEPTTL].
+func (rs *RedisServer) handleSetCommand(c *client, args [][]byte) {
+	opts, errMsg := parseStringOptions(args[3:], "set", true)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+
+	old, existed, stored, errMsg := rs.set(string(args[1]), args[2], opts)
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case opts.get && existed:
+		c.writeBulk(old)
+	case opts.get || !stored:
+		c.writeValue(resp.Null{})
+	default:
+		c.writeValue(resp.SimpleString{Value: "OK"})
+	}
+}
+
+func (rs *RedisServer) handleSetNX(c *client, args [][]byte) {
+	if _, _, stored, _ := rs.set(string(args[1]), args[2], stringOptions{nx: true}); stored {
+		c.writeValue(resp.Integer{Value: 1})
+	} else {
+		c.writeValue(resp.Integer{Value: 0})
+	}
+}
+
+// handleSetEx implements SETEX key seconds value and PSETEX key milliseconds
+// value.
+func (rs *RedisServer) handleSetEx(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+	at, ok := expireDeadline(n, name == "psetex", false, nowMs())
+	if n <= 0 || !ok {
+		c.writeError(fmt.Sprintf("ERR invalid expire time in '%s' command", name))
+		return
+	}
+
+	rs.set(string(args[1]), args[3], stringOptions{expireAt: at})
+	c.writeValue(resp.SimpleString{Value: "OK"})
+}
+
+func (rs *RedisServer) handleGetSet(c *client, args [][]byte) {
+	old, existed, _, errMsg := rs.set(string(args[1]), args[2], stringOptions{get: true})
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !existed:
+		c.writeValue(resp.Null{})
+	default:
+		c.writeBulk(old)
+	}
+}
+
+func (rs *RedisServer) handleGetDel(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	value, ok, errMsg := getString(tx, key)
+	if ok {
+		tx.Delete(key)
+	}
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !ok:
+		c.writeValue(resp.Null{})
+	default:
+		c.writeBulk(value)
+	}
+}
+
+// handleGetEx implements GETEX key [EX seconds | PX milliseconds |
+// EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST].
+func (rs *RedisServer) handleGetEx(c *client, args [][]byte) {
+	opts, errMsg := parseStringOptions(args[2:], "getex", false)
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	value, ok, errMsg := getString(tx, key)
+	if ok {
+		switch {
+		case opts.expireAt != 0:
+			tx.SetExpire(key, opts.expireAt)
+		case opts.persist:
+			tx.Persist(key)
+		}
+	}
+	tx.Unlock()
+
+	switch {
+	case errMsg != "":
+		c.writeError(errMsg)
+	case !ok:
+		c.writeValue(resp.Null{})
+	default:
+		c.writeBulk(value)
+	}
+}
+
+// handleIncr implements INCR, DECR, INCRBY and DECRBY. The counter keeps its
+// expiry and is stored int-encoded.
+func (rs *RedisServer) handleIncr(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	delta := int64(1)
+	if len(args) == 3 {
+		n, ok := parseInt64(args[2])
+		if !ok {
+			c.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		delta = n
+	}
+	if name == "decr" || name == "decrby" {
+		if delta == math.MinInt64 {
+			c.writeError("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	obj, exists := tx.Get(key)
+	var current int64
+	if exists {
+		if obj.typ != objString {
+			c.writeError(errWrongType)
+			return
+		}
+		n, ok := obj.int64Value()
+		if !ok {
+			c.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		current = n
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		c.writeError("ERR increment or decrement would overflow")
+		return
+	}
+
+	current += delta
+	if exists {
+		tx.Update(key, newIntObject(current))
+	} else {
+		tx.Insert(key, newIntObject(current))
+	}
+	c.writeValue(resp.Integer{Value: current})
+}
+
+// handleIncrByFloat implements INCRBYFLOAT key increment. The result is
+// stored as a string, formatted like Redis without an exponent or trailing
+// zeros. Redis computes in long double where available; this uses float64,
+// so results can differ in the last digits.
+func (rs *RedisServer) handleIncrByFloat(c *client, args [][]byte) {
+	incr, ok := parseFloat(args[2])
+	if !ok {
+		c.writeError("ERR value is not a valid float")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	obj, exists := tx.Get(key)
+	var current float64
+	if exists {
+		if obj.typ != objString {
+			c.writeError(errWrongType)
+			return
+		}
+		if obj.enc == encInt {
+			current = float64(obj.num)
+		} else if current, ok = parseFloat(obj.str); !ok {
+			c.writeError("ERR value is not a valid float")
+			return
+		}
+	}
+
+	result := current + incr
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		c.writeError("ERR increment would produce NaN or Infinity")
+		return
+	}
+
+	value := strconv.AppendFloat(nil, result, 'f', -1, 64)
+	if exists {
+		tx.Update(key, newStringObject(value))
+	} else {
+		tx.Insert(key, newStringObject(value))
+	}
+	c.writeBulk(value)
+}
+
+// parseFloat parses b as a float the way Redis parses float arguments:
+// surrounding spaces are rejected and NaN is not a valid number.
+func parseFloat(b []byte) (float64, bool) {
+	if len(b) == 0 || b[0] == ' ' || b[len(b)-1] == ' ' {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false
+	}
+	return f, true
+}
+
+func (rs *RedisServer) handleAppend(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	obj, exists := tx.Get(key)
+	if !exists {
+		tx.Insert(key, newStringObject(args[2]))
+		c.writeValue(resp.Integer{Value: int64(len(args[2]))})
+		return
+	}
+	if obj.typ != objString {
+		c.writeError(errWrongType)
+		return
+	}
+	old := obj.bytes()
+	if int64(len(old))+int64(len(args[2])) > rs.limits.MaxBulkLength {
+		c.writeError(errStringTooLong)
+		return
+	}
+
+	// A stored string owns the spare capacity of its slice, so it grows in
+	// place when there is room. Readers of the old value only see bytes up
+	// to its length, which are left untouched.
+	value := append(old, args[2]...)
+	tx.Update(key, newRawStringObject(value))
+	c.writeValue(resp.Integer{Value: int64(len(value))})
+}
+
+func (rs *RedisServer) handleStrlen(c *client, args [][]byte) {
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	value, _, errMsg := getString(tx, key)
+	tx.Unlock()
+
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	c.writeValue(resp.Integer{Value: int64(len(value))})
+}
+
+// handleGetRange implements GETRANGE and SUBSTR key start end. Negative
+// offsets count from the end of the string and out of range offsets are
+// clamped, so the reply is an empty string rather than an error.
+func (rs *RedisServer) handleGetRange(c *client, args [][]byte) {
+	start, ok := parseInt64(args[2])
+	end, ok2 := parseInt64(args[3])
+	if !ok || !ok2 {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	value, _, errMsg := getString(tx, key)
+	tx.Unlock()
+
+	if errMsg != "" {
+		c.writeError(errMsg)
+		return
+	}
+	n := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		c.writeBulk(nil)
+		return
+	}
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if end < 0 {
+		end = max(n+end, 0)
+	}
+	end = min(end, n-1)
+	if n == 0 || start > end {
+		c.writeBulk(nil)
+		return
+	}
+	c.writeBulk(value[start : end+1])
+}
+
+// handleSetRange implements SETRANGE key offset value. A missing key is
+// created, and the string is padded with zero bytes up to offset.
+func (rs *RedisServer) handleSetRange(c *client, args [][]byte) {
+	offset, ok := parseInt64(args[2])
+	if !ok {
+		c.writeError("ERR value is not an integer or out of range")
+		return
+	}
+	if offset < 0 {
+		c.writeError("ERR offset is out of range")
+		return
+	}
+	patch := args[3]
+
+	key := string(args[1])
+	tx := rs.data.Lock(key)
+	defer tx.Unlock()
+
+	obj, exists := tx.Get(key)
+	if exists && obj.typ != objString {
+		c.writeError(errWrongType)
+		return
+	}
+	var old []byte
+	if exists {
+		old = obj.bytes()
+	}
+	// An empty value changes nothing, and does not create the key.
+	if len(patch) == 0 {
+		c.writeValue(resp.Integer{Value: int64(len(old))})
+		return
+	}
+	if offset > rs.limits.MaxBulkLength-int64(len(patch)) {
+		c.writeError(errStringTooLong)
+		return
+	}
+
+	value := make([]byte, max(int64(len(old)), offset+int64(len(patch))))
+	copy(value, old)
+	copy(value[offset:], patch)
+	if exists {
+		tx.Update(key, newRawStringObject(value))
+	} else {
+		tx.Insert(key, newRawStringObject(value))
+	}
+	c.writeValue(resp.Integer{Value: int64(len(value))})
+}
+
+// handleMGet implements MGET key [key ...]. Missing keys and keys holding
+// other types yield nulls.
+func (rs *RedisServer) handleMGet(c *client, args [][]byte) {
+	keys := stringKeys(args[1:])
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+	tx := rs.data.Lock(keys...)
+	for i, key := range keys {
+		if obj, ok := tx.Get(key); ok && obj.typ == objString {
+			values[i], found[i] = obj.bytes(), true
+		}
+	}
+	tx.Unlock()
+
+	c.writeArrayHeader(len(keys))
+	for i, value := range values {
+		if found[i] {
+			c.writeBulk(value)
+		} else {
+			c.writeValue(resp.Null{})
+		}
+	}
+}
+
+// handleMSet implements MSET and MSETNX key value [key value ...]. All keys
+// are set at once, and MSETNX sets none if any of them exists. Like SET,
+// the keys lose their expiry.
+func (rs *RedisServer) handleMSet(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	if len(args)%2 == 0 {
+		c.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	keys := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+
+	tx := rs.data.Lock(keys...)
+	if name == "msetnx" {
+		for _, key := range keys {
+			if _, exists := tx.Get(key); exists {
+				tx.Unlock()
+				c.writeValue(resp.Integer{Value: 0})
+				return
+			}
+		}
+	}
+	for i, key := range keys {
+		// Look the key up first so that overwriting it counts as an access.
+		tx.Get(key)
+		tx.Insert(key, newStringObject(args[2*i+2]))
+	}
+	tx.Unlock()
+
+	if name == "msetnx" {
+		c.writeValue(resp.Integer{Value: 1})
+	} else {
+		c.writeValue(resp.SimpleString{Value: "OK"})
+	}
+}
+
+// handleLCS implements LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len]
+// [WITHMATCHLEN], following Redis' dynamic programming algorithm. Missing
+// keys count as empty strings.
+func (rs *RedisServer) handleLCS(c *client, args [][]byte) {
+	key1, key2 := string(args[1]), string(args[2])
+	tx := rs.data.Lock(key1, key2)
+	a, _, errMsg := getString(tx, key1)
+	b, _, errMsg2 := getString(tx, key2)
+	tx.Unlock()
+	if errMsg != "" || errMsg2 != "" {
+		c.writeError("ERR The specified keys must contain string values")
+		return
+	}
+
+	var getLen, getIdx, withMatchLen bool
+	var minMatchLen int64
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); {
+		case opt == "LEN":
+			getLen = true
+		case opt == "IDX":
+			getIdx = true
+		case opt == "WITHMATCHLEN":
+			withMatchLen = true
+		case opt == "MINMATCHLEN" && i+1 < len(args):
+			i++
+			n, ok := parseInt64(args[i])
+			if !ok {
+				c.writeError("ERR value is not an integer or out of range")
+				return
+			}
+			minMatchLen = max(n, 0)
+		default:
+			c.writeError("ERR syntax error")
+			return
+		}
+	}
+	if getLen && getIdx {
+		c.writeError("ERR If you want both the length and indexes, please just use IDX.")
+		return
+	}
+	if (int64(len(a))+1)*(int64(len(b))+1)*4 > rs.limits.MaxBulkLength {
+		c.writeError("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+		return
+	}
+
+	// lcs[i*(len(b)+1)+j] is the length of the LCS of a[:i] and b[:j].
+	width := len(b) + 1
+	lcs := make([]uint32, (len(a)+1)*width)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				lcs[i*width+j] = lcs[(i-1)*width+j-1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i-1)*width+j], lcs[i*width+j-1])
+			}
+		}
+	}
+	total := lcs[len(a)*width+len(b)]
+	if getLen {
+		c.writeValue(resp.Integer{Value: int64(total)})
+		return
+	}
+
+	// Walk back from the end, collecting the common string and, for IDX, the
+	// ranges of contiguous matches, last one first.
+	result := make([]byte, total)
+	var matches []resp.Value
+	idx := total
+	i, j := len(a), len(b)
+	aStart, aEnd, bStart, bEnd := len(a), 0, 0, 0 // aStart == len(a) means no open range
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			switch {
+			case aStart == len(a):
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			case aStart == i && bStart == j:
+				// The match extends the current range backwards.
+				aStart--
+				bStart--
+			default:
+				emit = true
+			}
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if lcs[(i-1)*width+j] > lcs[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			if aStart != len(a) {
+				emit = true
+			}
+		}
+
+		if emit {
+			if matchLen := int64(aEnd - aStart + 1); getIdx && (minMatchLen == 0 || matchLen >= minMatchLen) {
+				match := []resp.Value{
+					resp.Array{Values: []resp.Value{resp.Integer{Value: int64(aStart)}, resp.Integer{Value: int64(aEnd)}}},
+					resp.Array{Values: []resp.Value{resp.Integer{Value: int64(bStart)}, resp.Integer{Value: int64(bEnd)}}},
+				}
+				if withMatchLen {
+					match = append(match, resp.Integer{Value: matchLen})
+				}
+				matches = append(matches, resp.Array{Values: match})
+			}
+			aStart = len(a)
+		}
+	}
+
+	if !getIdx {
+		c.writeBulk(result)
+		return
+	}
+	if matches == nil {
+		matches = []resp.Value{}
+	}
+	c.writeValue(resp.Map{Entries: []resp.MapEntry{
+		{Key: resp.NewBulkString("matches"), Value: resp.Array{Values: matches}},
+		{Key: resp.NewBulkString("len"), Value: resp.Integer{Value: int64(total)}},
+	}})
+}
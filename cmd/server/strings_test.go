@@ -0,0 +1,360 @@
+package main
+
+import (
+	"redis-lite/resp"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSet_Conditions(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	null := resp.BulkString{IsNull: true}
+	ok := resp.SimpleString{Value: "OK"}
+
+	// The distributed lock pattern: only the first NX wins.
+	assertReply(t, tc.do("SET", "lock", "a", "NX", "PX", "30000"), ok)
+	assertReply(t, tc.do("SET", "lock", "b", "NX", "PX", "30000"), null)
+	assertReply(t, tc.do("GET", "lock"), resp.BulkString{Value: []byte("a")})
+
+	assertReply(t, tc.do("SET", "missing", "v", "XX"), null)
+	assertReply(t, tc.do("GET", "missing"), null)
+	assertReply(t, tc.do("SET", "lock", "c", "XX", "KEEPTTL"), ok)
+	if ttl := tc.do("PTTL", "lock").(resp.Integer).Value; ttl <= 0 {
+		t.Errorf("PTTL after SET KEEPTTL = %d; want the lock's expiry", ttl)
+	}
+
+	// GET swaps and replies with the previous value, even when NX or XX
+	// prevents the write.
+	assertReply(t, tc.do("SET", "k", "1", "GET"), null)
+	assertReply(t, tc.do("SET", "k", "2", "GET"), resp.BulkString{Value: []byte("1")})
+	assertReply(t, tc.do("SET", "k", "3", "NX", "GET"), resp.BulkString{Value: []byte("2")})
+	assertReply(t, tc.do("GET", "k"), resp.BulkString{Value: []byte("2")})
+}
+
+func TestSet_OptionErrors(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	syntax := resp.Error{Value: "ERR syntax error"}
+
+	assertReply(t, tc.do("SET", "k", "v", "NX", "XX"), syntax)
+	assertReply(t, tc.do("SET", "k", "v", "XX", "NX"), syntax)
+	assertReply(t, tc.do("SET", "k", "v", "KEEPTTL", "EX", "10"), syntax)
+	assertReply(t, tc.do("SET", "k", "v", "PERSIST"), syntax)
+	assertReply(t, tc.do("GETEX", "k", "NX"), syntax)
+	assertReply(t, tc.do("GETEX", "k", "EX", "10", "PERSIST"), syntax)
+	assertReply(t, tc.do("GETEX", "k", "PX", "-5"), resp.Error{Value: "ERR invalid expire time in 'getex' command"})
+	assertReply(t, tc.do("SETEX", "k", "0", "v"), resp.Error{Value: "ERR invalid expire time in 'setex' command"})
+	assertReply(t, tc.do("PSETEX", "k", "x", "v"), resp.Error{Value: "ERR value is not an integer or out of range"})
+}
+
+func TestStringCompanionCommands(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	null := resp.BulkString{IsNull: true}
+
+	assertReply(t, tc.do("SETNX", "k", "1"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("SETNX", "k", "2"), resp.Integer{Value: 0})
+
+	assertReply(t, tc.do("SETEX", "k", "100", "3"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 100})
+	assertReply(t, tc.do("PSETEX", "k", "100000", "4"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 100})
+
+	// GETSET replaces the value and drops the expiry.
+	assertReply(t, tc.do("GETSET", "k", "5"), resp.BulkString{Value: []byte("4")})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: -1})
+	assertReply(t, tc.do("GETSET", "new", "v"), null)
+
+	assertReply(t, tc.do("GETEX", "k", "EX", "50"), resp.BulkString{Value: []byte("5")})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 50})
+	assertReply(t, tc.do("GETEX", "k"), resp.BulkString{Value: []byte("5")})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: 50})
+	assertReply(t, tc.do("GETEX", "k", "PERSIST"), resp.BulkString{Value: []byte("5")})
+	assertReply(t, tc.do("TTL", "k"), resp.Integer{Value: -1})
+	assertReply(t, tc.do("GETEX", "missing", "EX", "10"), null)
+
+	assertReply(t, tc.do("GETDEL", "k"), resp.BulkString{Value: []byte("5")})
+	assertReply(t, tc.do("GETDEL", "k"), null)
+	assertReply(t, tc.do("GET", "k"), null)
+}
+
+func TestStrings_WrongType(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+
+	// No command creates other types yet, so store one directly.
+	rs.data.Insert("other", object{typ: objectType(255)})
+	wrongType := resp.Error{Value: errWrongType}
+
+	assertReply(t, tc.do("GET", "other"), wrongType)
+	assertReply(t, tc.do("GETDEL", "other"), wrongType)
+	assertReply(t, tc.do("GETEX", "other", "PERSIST"), wrongType)
+	assertReply(t, tc.do("GETSET", "other", "v"), wrongType)
+	assertReply(t, tc.do("SET", "other", "v", "GET"), wrongType)
+	assertReply(t, tc.do("INCR", "other"), wrongType)
+	assertReply(t, tc.do("INCRBYFLOAT", "other", "1"), wrongType)
+	assertReply(t, tc.do("TYPE", "other"), resp.SimpleString{Value: "unknown"})
+
+	// A plain SET overwrites values of any type.
+	assertReply(t, tc.do("SET", "other", "v"), resp.SimpleString{Value: "OK"})
+	assertReply(t, tc.do("GET", "other"), resp.BulkString{Value: []byte("v")})
+}
+
+func TestIncr(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+
+	assertReply(t, tc.do("INCR", "n"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("INCRBY", "n", "41"), resp.Integer{Value: 42})
+	assertReply(t, tc.do("DECR", "n"), resp.Integer{Value: 41})
+	assertReply(t, tc.do("DECRBY", "n", "-9"), resp.Integer{Value: 50})
+	assertReply(t, tc.do("GET", "n"), resp.BulkString{Value: []byte("50")})
+
+	// Counters are stored int-encoded, whether created by INCR or SET.
+	if obj, _ := rs.data.Get("n"); obj.enc != encInt || obj.num != 50 {
+		t.Errorf("counter stored as %+v; want int encoding", obj)
+	}
+	tc.do("SET", "s", "-17")
+	if obj, _ := rs.data.Get("s"); obj.enc != encInt || obj.num != -17 {
+		t.Errorf("SET of an integer stored as %+v; want int encoding", obj)
+	}
+	// Non-canonical integers must round-trip as they were written.
+	tc.do("SET", "padded", "007")
+	assertReply(t, tc.do("GET", "padded"), resp.BulkString{Value: []byte("007")})
+	assertReply(t, tc.do("INCR", "padded"), resp.Error{Value: "ERR value is not an integer or out of range"})
+
+	// The expiry survives an increment.
+	tc.do("SET", "ttl", "1", "EX", "100")
+	tc.do("INCR", "ttl")
+	assertReply(t, tc.do("TTL", "ttl"), resp.Integer{Value: 100})
+
+	notInt := resp.Error{Value: "ERR value is not an integer or out of range"}
+	tc.do("SET", "str", "abc")
+	assertReply(t, tc.do("INCR", "str"), notInt)
+	tc.do("SET", "spaced", " 1")
+	assertReply(t, tc.do("INCR", "spaced"), notInt)
+	assertReply(t, tc.do("INCRBY", "n", "1.5"), notInt)
+	assertReply(t, tc.do("INCRBY", "n", "+1"), notInt)
+	assertReply(t, tc.do("INCRBY", "n", "99999999999999999999"), notInt)
+
+	overflow := resp.Error{Value: "ERR increment or decrement would overflow"}
+	tc.do("SET", "max", "9223372036854775807")
+	assertReply(t, tc.do("INCR", "max"), overflow)
+	tc.do("SET", "min", "-9223372036854775808")
+	assertReply(t, tc.do("DECR", "min"), overflow)
+	assertReply(t, tc.do("INCRBY", "min", "-1"), overflow)
+	assertReply(t, tc.do("DECRBY", "n", "-9223372036854775808"), resp.Error{Value: "ERR decrement would overflow"})
+	assertReply(t, tc.do("GET", "max"), resp.BulkString{Value: []byte("9223372036854775807")})
+
+	// Increments from concurrent clients are atomic.
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		conn := newTestConn(t, rs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				conn.do("INCR", "shared")
+			}
+		}()
+	}
+	wg.Wait()
+	assertReply(t, tc.do("GET", "shared"), resp.BulkString{Value: []byte("400")})
+}
+
+func TestIncrByFloat(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	tc.do("SET", "f", "10.50")
+	assertReply(t, tc.do("INCRBYFLOAT", "f", "0.1"), bulk("10.6"))
+	assertReply(t, tc.do("INCRBYFLOAT", "f", "-5"), bulk("5.6"))
+	tc.do("SET", "f", "5.0e3")
+	assertReply(t, tc.do("INCRBYFLOAT", "f", "2.0e2"), bulk("5200"))
+	assertReply(t, tc.do("INCR", "f"), resp.Integer{Value: 5201})
+	assertReply(t, tc.do("INCRBYFLOAT", "new", "1.5"), bulk("1.5"))
+
+	notFloat := resp.Error{Value: "ERR value is not a valid float"}
+	assertReply(t, tc.do("INCRBYFLOAT", "f", "abc"), notFloat)
+	assertReply(t, tc.do("INCRBYFLOAT", "f", "nan"), notFloat)
+	assertReply(t, tc.do("INCRBYFLOAT", "f", " 1"), notFloat)
+	tc.do("SET", "str", "x")
+	assertReply(t, tc.do("INCRBYFLOAT", "str", "1"), notFloat)
+
+	assertReply(t, tc.do("INCRBYFLOAT", "f", "inf"), resp.Error{Value: "ERR increment would produce NaN or Infinity"})
+	tc.do("SET", "huge", "1.7e308")
+	assertReply(t, tc.do("INCRBYFLOAT", "huge", "1.7e308"), resp.Error{Value: "ERR increment would produce NaN or Infinity"})
+}
+
+func TestStringRangeCommands(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+	notInt := resp.Error{Value: "ERR value is not an integer or out of range"}
+
+	assertReply(t, tc.do("APPEND", "s", "Hello"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("APPEND", "s", " World"), resp.Integer{Value: 11})
+	assertReply(t, tc.do("GET", "s"), bulk("Hello World"))
+	assertReply(t, tc.do("STRLEN", "s"), resp.Integer{Value: 11})
+	assertReply(t, tc.do("STRLEN", "missing"), resp.Integer{Value: 0})
+	tc.do("SET", "n", "-123")
+	assertReply(t, tc.do("STRLEN", "n"), resp.Integer{Value: 4})
+	assertReply(t, tc.do("APPEND", "n", "4"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("INCR", "n"), resp.Integer{Value: -1233})
+
+	tc.do("SET", "r", "This is a string")
+	for _, tt := range []struct {
+		start, end, want string
+	}{
+		{"0", "3", "This"},
+		{"-3", "-1", "ing"},
+		{"0", "-1", "This is a string"},
+		{"10", "100", "string"},
+		{"5", "3", ""},
+		{"-1", "-5", ""},
+		{"-100", "3", "This"},
+		{"100", "200", ""},
+	} {
+		assertReply(t, tc.do("GETRANGE", "r", tt.start, tt.end), bulk(tt.want))
+	}
+	assertReply(t, tc.do("SUBSTR", "r", "0", "3"), bulk("This"))
+	assertReply(t, tc.do("GETRANGE", "missing", "0", "-1"), bulk(""))
+	assertReply(t, tc.do("GETRANGE", "r", "a", "1"), notInt)
+
+	tc.do("SET", "k", "Hello World")
+	assertReply(t, tc.do("SETRANGE", "k", "6", "Redis"), resp.Integer{Value: 11})
+	assertReply(t, tc.do("GET", "k"), bulk("Hello Redis"))
+	assertReply(t, tc.do("SETRANGE", "pad", "3", "ab"), resp.Integer{Value: 5})
+	assertReply(t, tc.do("GET", "pad"), bulk("\x00\x00\x00ab"))
+	assertReply(t, tc.do("SETRANGE", "k", "100", ""), resp.Integer{Value: 11})
+	assertReply(t, tc.do("SETRANGE", "none", "5", ""), resp.Integer{Value: 0})
+	assertReply(t, tc.do("EXISTS", "none"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("SETRANGE", "k", "-1", "x"), resp.Error{Value: "ERR offset is out of range"})
+	assertReply(t, tc.do("SETRANGE", "k", "x", "x"), notInt)
+	// The 512MB limit is checked before anything is allocated.
+	assertReply(t, tc.do("SETRANGE", "k", "536870911", "xx"), resp.Error{Value: errStringTooLong})
+	tc.do("DEL", "k")
+
+	rs.data.Insert("other", object{typ: objectType(255)})
+	wrongType := resp.Error{Value: errWrongType}
+	assertReply(t, tc.do("APPEND", "other", "x"), wrongType)
+	assertReply(t, tc.do("STRLEN", "other"), wrongType)
+	assertReply(t, tc.do("GETRANGE", "other", "0", "1"), wrongType)
+	assertReply(t, tc.do("SETRANGE", "other", "0", "x"), wrongType)
+}
+
+// APPEND grows strings in place, which must never show through other keys
+// sharing the same bytes.
+func TestAppend_SharedValues(t *testing.T) {
+	tc := newTestConn(t, NewRedisServer())
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	// Both values arrive in one command, likely in one buffer.
+	tc.do("MSET", "a", "x", "b", "y")
+	tc.do("APPEND", "a", "1")
+	assertReply(t, tc.do("MGET", "a", "b"), resp.Array{Values: []resp.Value{bulk("x1"), bulk("y")}})
+
+	tc.do("APPEND", "a", "2")
+	tc.do("COPY", "a", "c")
+	tc.do("APPEND", "a", "A")
+	tc.do("APPEND", "c", "C")
+	assertReply(t, tc.do("MGET", "a", "c"), resp.Array{Values: []resp.Value{bulk("x12A"), bulk("x12C")}})
+}
+
+func TestMultiKeyStrings(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+
+	assertReply(t, tc.do("MSET", "a", "1", "b", "2", "a", "3"), resp.SimpleString{Value: "OK"})
+	rs.data.Insert("other", object{typ: objectType(255)})
+	assertReply(t, tc.do("MGET", "a", "b", "missing", "other"), resp.Array{Values: []resp.Value{
+		bulk("3"), bulk("2"), resp.BulkString{IsNull: true}, resp.BulkString{IsNull: true},
+	}})
+	assertReply(t, tc.do("MSET", "a", "1", "b"), resp.Error{Value: "ERR wrong number of arguments for 'mset' command"})
+
+	// MSETNX sets nothing if any key exists.
+	assertReply(t, tc.do("MSETNX", "c", "1", "a", "x"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("EXISTS", "c"), resp.Integer{Value: 0})
+	assertReply(t, tc.do("MSETNX", "c", "1", "d", "2"), resp.Integer{Value: 1})
+	assertReply(t, tc.do("MGET", "c", "d"), resp.Array{Values: []resp.Value{bulk("1"), bulk("2")}})
+
+	// MSET clears expiries, like SET.
+	tc.do("EXPIRE", "c", "100")
+	tc.do("MSET", "c", "2")
+	assertReply(t, tc.do("TTL", "c"), resp.Integer{Value: -1})
+}
+
+// Concurrent MSETs of the same keys must never interleave: every MGET sees
+// all keys from the same MSET.
+func TestMSet_Atomic(t *testing.T) {
+	rs := NewRedisServer()
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		tc := newTestConn(t, rs)
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			args := []string{"MSET"}
+			for _, key := range keys {
+				args = append(args, key, strconv.Itoa(w))
+			}
+			for i := 0; i < 50; i++ {
+				tc.do(args...)
+			}
+		}(w)
+	}
+
+	tc := newTestConn(t, rs)
+	for i := 0; i < 50; i++ {
+		reply := tc.do(append([]string{"MGET"}, keys...)...).(resp.Array)
+		for _, v := range reply.Values[1:] {
+			if !reflect.DeepEqual(v, reply.Values[0]) {
+				t.Fatalf("MGET saw a partial MSET: %v", reply.Values)
+			}
+		}
+	}
+	wg.Wait()
+}
+
+func TestLCS(t *testing.T) {
+	rs := NewRedisServer()
+	tc := newTestConn(t, rs)
+	bulk := func(s string) resp.Value { return resp.BulkString{Value: []byte(s)} }
+	ints := func(a, b int64) resp.Value {
+		return resp.Array{Values: []resp.Value{resp.Integer{Value: a}, resp.Integer{Value: b}}}
+	}
+
+	tc.do("MSET", "key1", "ohmytext", "key2", "mynewtext")
+	assertReply(t, tc.do("LCS", "key1", "key2"), bulk("mytext"))
+	assertReply(t, tc.do("LCS", "key1", "key2", "LEN"), resp.Integer{Value: 6})
+	assertReply(t, tc.do("LCS", "key1", "missing"), bulk(""))
+
+	// RESP2 flattens the map into an array.
+	assertReply(t, tc.do("LCS", "key1", "key2", "IDX"), resp.Array{Values: []resp.Value{
+		bulk("matches"), resp.Array{Values: []resp.Value{
+			resp.Array{Values: []resp.Value{ints(4, 7), ints(5, 8)}},
+			resp.Array{Values: []resp.Value{ints(2, 3), ints(0, 1)}},
+		}},
+		bulk("len"), resp.Integer{Value: 6},
+	}})
+	tc.do("HELLO", "3")
+	assertReply(t, tc.do("LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"), resp.Map{Entries: []resp.MapEntry{
+		{Key: bulk("matches"), Value: resp.Array{Values: []resp.Value{
+			resp.Array{Values: []resp.Value{ints(4, 7), ints(5, 8), resp.Integer{Value: 4}}},
+		}}},
+		{Key: bulk("len"), Value: resp.Integer{Value: 6}},
+	}})
+
+	assertReply(t, tc.do("LCS", "key1", "key2", "LEN", "IDX"), resp.Error{Value: "ERR If you want both the length and indexes, please just use IDX."})
+	assertReply(t, tc.do("LCS", "key1", "key2", "FOO"), resp.Error{Value: "ERR syntax error"})
+	tc.do("SET", "num", "1234")
+	assertReply(t, tc.do("LCS", "num", "key1"), bulk(""))
+	rs.data.Insert("other", object{typ: objectType(255)})
+	assertReply(t, tc.do("LCS", "key1", "other"), resp.Error{Value: "ERR The specified keys must contain string values"})
+}
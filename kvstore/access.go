@@ -0,0 +1,71 @@
+package kvstore
+
+import "math/rand/v2"
+
+// Every key carries the access metadata Redis keeps for its eviction
+// policies: the time of its last access, as used by LRU, and an access
+// frequency counter, as used by LFU. The counter is logarithmic, so it can
+// tell apart keys accessed a handful of times from ones accessed millions of
+// times in 8 bits, and it decays while the key is not accessed, so keys that
+// were popular long ago lose their standing.
+
+const (
+	// lfuInitValue is the counter of a new key, so it is not immediately
+	// the least frequently used one.
+	lfuInitValue = 5
+	// lfuLogFactor is Redis' lfu-log-factor: the higher it is, the more
+	// accesses it takes to increment the counter.
+	lfuLogFactor = 10
+	// lfuDecayTime is Redis' lfu-decay-time: the counter is decremented once
+	// per this many minutes without access.
+	lfuDecayTime = 1
+)
+
+func (ht *Table[K, V]) initAccess(n *node[K, V]) {
+	now := ht.now()
+	n.accessedAt = now
+	n.freq = lfuInitValue
+	n.freqTime = uint16(now / 60000)
+}
+
+// touch records an access to n.
+func (ht *Table[K, V]) touch(n *node[K, V]) {
+	now := ht.now()
+	n.accessedAt = now
+	n.freq = logIncr(decayedFreq(n, now))
+	n.freqTime = uint16(now / 60000)
+}
+
+// decayedFreq returns the counter of n after the decay due at time now.
+func decayedFreq[K comparable, V any](n *node[K, V], now int64) uint8 {
+	// Minutes are kept modulo 2^16, so the subtraction wraps like them.
+	periods := int(uint16(now/60000)-n.freqTime) / lfuDecayTime
+	if periods >= int(n.freq) {
+		return 0
+	}
+	return n.freq - uint8(periods)
+}
+
+// logIncr increments counter with a probability that falls as the counter
+// grows, as in Redis' LFULogIncr.
+func logIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := max(float64(counter)-lfuInitValue, 0)
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// Access returns the number of milliseconds since key was last accessed and
+// its access frequency counter, without counting as an access itself.
+func (ht *Table[K, V]) Access(key K) (idle int64, freq uint8, ok bool) {
+	node := ht.lookup(key)
+	if node == nil {
+		return 0, 0, false
+	}
+	now := ht.now()
+	return max(now-node.accessedAt, 0), decayedFreq(node, now), true
+}
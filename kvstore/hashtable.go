@@ -0,0 +1,39 @@
+package kvstore
+
+import "hash/maphash"
+
+// HashTable is a Table of string keys and values of any type. It predates
+// Table and is kept as a thin wrapper for existing callers; new code should
+// use a Table with a concrete value type.
+type HashTable struct {
+	*Table[string, any]
+}
+
+// Node is a key-value pair stored in a HashTable.
+type Node = node[string, any]
+
+// Hasher maps a key to a 64-bit hash code.
+type Hasher func(key string) uint64
+
+// seed is chosen at random when the process starts.
+var seed = maphash.MakeSeed()
+
+// SeededHash hashes key with a keyed hash function seeded randomly per
+// process. Unlike an unseeded hash such as FNV, clients cannot compute which
+// keys share a bucket, so they cannot craft keys that turn a bucket chain
+// into a long list (hash flooding).
+func SeededHash(key string) uint64 {
+	return maphash.String(seed, key)
+}
+
+// NewHashTable returns an empty table that hashes keys with SeededHash,
+// configured by opts if given.
+func NewHashTable(opts ...Options) *HashTable {
+	return NewHashTableWithHasher(SeededHash, opts...)
+}
+
+// NewHashTableWithHasher is like NewHashTable but hashes keys with hash, so
+// tests and benchmarks can plug in a deterministic function.
+func NewHashTableWithHasher(hash Hasher, opts ...Options) *HashTable {
+	return &HashTable{NewTable[string, any](hash, opts...)}
+}
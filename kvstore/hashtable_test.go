@@ -1,8 +1,10 @@
 package kvstore // Use the same package name as your hashtable.go
 
 import (
-	"fmt"     // Needed for collision test keys
-	"reflect" // Needed for comparing slices/maps robustly
+	"fmt"      // Needed for collision test keys
+	"hash/fnv" // Needed to craft hash-flooding keys
+	"reflect"  // Needed for comparing slices/maps robustly
+	"sync"
 	"testing"
 )
 
@@ -208,3 +210,566 @@ func TestHashTable_NilValue(t *testing.T) {
 // 1. Test that resizing triggers at the correct load factor.
 // 2. Test that all elements are correctly rehashed and retrievable after resizing.
 // 3. Test insert/get/delete operations immediately after a resize occurs.
+
+// Test key expiry, both lazy (on access) and active (sampling)
+func TestHashTable_Expiry(t *testing.T) {
+	ht := NewHashTable()
+	clock := int64(1_000_000)
+	ht.now = func() int64 { return clock }
+
+	t.Run("Set And Read Expiry", func(t *testing.T) {
+		ht.Insert("session", "abc")
+		if !ht.SetExpire("session", clock+5000) {
+			t.Fatalf("SetExpire on existing key returned false")
+		}
+		if at, ok := ht.ExpireAt("session"); !ok || at != clock+5000 {
+			t.Errorf("ExpireAt = %d, %v; want %d, true", at, ok, clock+5000)
+		}
+		if ht.SetExpire("missing", clock+5000) {
+			t.Errorf("SetExpire on missing key returned true")
+		}
+	})
+
+	t.Run("Lazy Expiry On Access", func(t *testing.T) {
+		clock += 5000
+		assertGetValue(t, ht, "session", nil, false)
+		if ht.size != 0 || ht.volatile != 0 {
+			t.Errorf("After lazy expiry size = %d, volatile = %d; want 0, 0", ht.size, ht.volatile)
+		}
+	})
+
+	t.Run("Insert Clears Expiry, Update Keeps It", func(t *testing.T) {
+		ht.Insert("a", 1)
+		ht.SetExpire("a", clock+1000)
+		ht.Update("a", 2)
+		if at, _ := ht.ExpireAt("a"); at != clock+1000 {
+			t.Errorf("ExpireAt after Update = %d; want %d", at, clock+1000)
+		}
+		ht.Insert("a", 3)
+		if at, _ := ht.ExpireAt("a"); at != 0 {
+			t.Errorf("ExpireAt after Insert = %d; want 0", at)
+		}
+		if ht.Persist("a") {
+			t.Errorf("Persist on key without expiry returned true")
+		}
+	})
+
+	t.Run("Past Deadline Deletes", func(t *testing.T) {
+		ht.Insert("old", "x")
+		ht.SetExpire("old", clock-1)
+		assertGetValue(t, ht, "old", nil, false)
+	})
+
+	t.Run("Active Expiry", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("temp_%d", i)
+			ht.Insert(key, i)
+			ht.SetExpire(key, clock+10)
+		}
+		ht.Insert("keep", "forever")
+		clock += 10
+
+		total := 0
+		for i := 0; i < 100 && ht.volatile > 0; i++ {
+			_, expired := ht.ActiveExpire(20)
+			total += expired
+		}
+		if total != 100 || ht.volatile != 0 {
+			t.Errorf("ActiveExpire removed %d keys, %d volatile left; want 100, 0", total, ht.volatile)
+		}
+		// Only the persistent keys survive.
+		if ht.size != 2 {
+			t.Errorf("Size after active expiry = %d; want 2", ht.size)
+		}
+		assertGetValue(t, ht, "keep", "forever", true)
+	})
+}
+
+// Test Len, Delete's result, RandomKey and Clear
+func TestHashTable_KeyspaceHelpers(t *testing.T) {
+	ht := NewHashTable()
+	clock := int64(1_000_000)
+	ht.now = func() int64 { return clock }
+
+	if _, ok := ht.RandomKey(); ok {
+		t.Errorf("RandomKey on empty table returned a key")
+	}
+
+	for i := 0; i < 10; i++ {
+		ht.Insert(fmt.Sprintf("key_%d", i), i)
+	}
+	if ht.Len() != 10 {
+		t.Errorf("Len = %d; want 10", ht.Len())
+	}
+	if !ht.Delete("key_0") || ht.Delete("key_0") {
+		t.Errorf("Delete should report true once, then false")
+	}
+
+	t.Run("Random Key Covers Table", func(t *testing.T) {
+		seen := map[string]bool{}
+		for i := 0; i < 1000; i++ {
+			key, ok := ht.RandomKey()
+			if !ok {
+				t.Fatalf("RandomKey returned no key from a non-empty table")
+			}
+			seen[key] = true
+		}
+		if len(seen) != 9 {
+			t.Errorf("RandomKey returned %d distinct keys; want 9", len(seen))
+		}
+	})
+
+	t.Run("Random Key Skips Expired", func(t *testing.T) {
+		for i := 1; i < 9; i++ {
+			ht.SetExpire(fmt.Sprintf("key_%d", i), clock+1)
+		}
+		clock++
+		for i := 0; i < 20; i++ {
+			if key, _ := ht.RandomKey(); key != "key_9" {
+				t.Fatalf("RandomKey = %q; want the only live key key_9", key)
+			}
+		}
+	})
+
+	ht.Clear()
+	if ht.Len() != 0 || ht.capacity != initialCapacity || ht.volatile != 0 {
+		t.Errorf("After Clear Len = %d, capacity = %d, volatile = %d", ht.Len(), ht.capacity, ht.volatile)
+	}
+}
+
+// Test that Scan returns every key present for the whole iteration, even when
+// the table grows between calls
+func TestHashTable_ScanAcrossResize(t *testing.T) {
+	ht := NewHashTable()
+	original := 100
+	for i := 0; i < original; i++ {
+		ht.Insert(fmt.Sprintf("orig_%d", i), i)
+	}
+
+	seen := map[string]bool{}
+	collect := func(key string, value any) { seen[key] = true }
+
+	cursor := ht.Scan(0, collect)
+	for steps := 1; cursor != 0; steps++ {
+		if steps%10 == 0 && steps <= 30 {
+			// Grow the table a few times mid-iteration.
+			for i := 0; i < 200; i++ {
+				ht.Insert(fmt.Sprintf("added_%d_%d", steps, i), i)
+			}
+		}
+		cursor = ht.Scan(cursor, collect)
+	}
+
+	if ht.capacity <= initialCapacity {
+		t.Fatalf("capacity = %d; the test needs the table to resize", ht.capacity)
+	}
+	for i := 0; i < original; i++ {
+		if key := fmt.Sprintf("orig_%d", i); !seen[key] {
+			t.Errorf("Scan never returned %q", key)
+		}
+	}
+}
+
+// Test that ForEach visits every live key and stops early on request
+func TestHashTable_ForEach(t *testing.T) {
+	ht := NewHashTable()
+	clock := int64(1_000_000)
+	ht.now = func() int64 { return clock }
+
+	for i := 0; i < 50; i++ {
+		ht.Insert(fmt.Sprintf("key_%d", i), i)
+	}
+	ht.SetExpire("key_0", clock+1)
+	clock++
+
+	visited := 0
+	ht.ForEach(func(key string, value any) bool {
+		if key == "key_0" {
+			t.Errorf("ForEach visited the expired key")
+		}
+		visited++
+		return true
+	})
+	if visited != 49 {
+		t.Errorf("ForEach visited %d keys; want 49", visited)
+	}
+
+	visited = 0
+	ht.ForEach(func(key string, value any) bool {
+		visited++
+		return visited < 5
+	})
+	if visited != 5 {
+		t.Errorf("ForEach visited %d keys after stopping; want 5", visited)
+	}
+}
+
+// Test that growing the table moves keys incrementally and that every
+// operation sees keys in both bucket arrays meanwhile
+func TestHashTable_IncrementalRehash(t *testing.T) {
+	ht := NewHashTable()
+	// Insert until crossing the load factor starts a rehash; threshold is
+	// the index of the last key.
+	threshold := -1
+	for !ht.rehashing() {
+		threshold++
+		ht.Insert(fmt.Sprintf("key_%d", threshold), threshold)
+	}
+	if float64(threshold)/float64(initialCapacity) < loadFactorLimit {
+		t.Fatalf("rehash started at %d keys, below the load factor", threshold+1)
+	}
+	if ht.capacity != initialCapacity || len(ht.rehashBuckets) != initialCapacity*2 {
+		t.Fatalf("capacity = %d, new array = %d; want %d and %d", ht.capacity, len(ht.rehashBuckets), initialCapacity, initialCapacity*2)
+	}
+	// One Insert moves a single bucket, not the whole table.
+	if ht.rehashIndex > 1+rehashEmptyVisits {
+		t.Errorf("rehashIndex = %d after one insert; want at most %d", ht.rehashIndex, 1+rehashEmptyVisits)
+	}
+
+	t.Run("Operations During Rehash", func(t *testing.T) {
+		for i := 0; i <= threshold; i++ {
+			assertGetValue(t, ht, fmt.Sprintf("key_%d", i), i, true)
+		}
+		ht.Insert("key_0", "updated")
+		assertGetValue(t, ht, "key_0", "updated", true)
+		if !ht.Delete(fmt.Sprintf("key_%d", threshold)) {
+			t.Errorf("Delete during rehash did not find the key")
+		}
+		if ht.size != threshold {
+			t.Errorf("size = %d; want %d", ht.size, threshold)
+		}
+	})
+
+	t.Run("Finish In Background", func(t *testing.T) {
+		for ht.Rehash(10) {
+		}
+		if ht.rehashing() || ht.capacity != initialCapacity*2 || ht.rehashBuckets != nil {
+			t.Fatalf("after Rehash: rehashing = %v, capacity = %d", ht.rehashing(), ht.capacity)
+		}
+		if ht.Rehash(10) {
+			t.Errorf("Rehash reported work left with no rehash in progress")
+		}
+		assertGetValue(t, ht, "key_0", "updated", true)
+		for i := 1; i < threshold; i++ {
+			assertGetValue(t, ht, fmt.Sprintf("key_%d", i), i, true)
+		}
+	})
+}
+
+// Test that Scan returns every key when buckets move between calls
+func TestHashTable_ScanDuringRehash(t *testing.T) {
+	ht := NewHashTable()
+	keys := 0
+	for !ht.rehashing() {
+		ht.Insert(fmt.Sprintf("key_%d", keys), keys)
+		keys++
+	}
+
+	seen := map[string]bool{}
+	cursor := ht.Scan(0, func(key string, value any) { seen[key] = true })
+	for cursor != 0 {
+		ht.Rehash(3)
+		cursor = ht.Scan(cursor, func(key string, value any) { seen[key] = true })
+	}
+	if len(seen) != keys {
+		t.Errorf("Scan returned %d distinct keys; want %d", len(seen), keys)
+	}
+}
+
+// Test Options, shrinking after bulk deletes and the resize hook
+func TestHashTable_ShrinkAndOptions(t *testing.T) {
+	var resizes [][2]int
+	ht := NewHashTable(Options{
+		InitialCapacity: 10, // Rounded up to 16
+		LoadFactor:      1,
+		OnResize: func(oldCapacity, newCapacity int) {
+			resizes = append(resizes, [2]int{oldCapacity, newCapacity})
+		},
+	})
+	if ht.capacity != 16 || ht.loadFactor != 1 {
+		t.Fatalf("capacity = %d, loadFactor = %v; want 16, 1", ht.capacity, ht.loadFactor)
+	}
+
+	finish := func() {
+		for ht.Rehash(100) {
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		ht.Insert(fmt.Sprintf("key_%d", i), i)
+	}
+	finish()
+	grown := ht.capacity
+	if grown < 1000 {
+		t.Fatalf("capacity after 1000 inserts = %d; want at least 1000", grown)
+	}
+	if len(resizes) == 0 || resizes[len(resizes)-1] != [2]int{grown / 2, grown} {
+		t.Errorf("OnResize calls = %v; want the last to be %d -> %d", resizes, grown/2, grown)
+	}
+
+	t.Run("Hysteresis", func(t *testing.T) {
+		// Dropping to half the keys must not shrink the table.
+		for i := 500; i < 1000; i++ {
+			ht.Delete(fmt.Sprintf("key_%d", i))
+		}
+		finish()
+		if ht.capacity != grown {
+			t.Errorf("capacity = %d after deleting half the keys; want %d", ht.capacity, grown)
+		}
+	})
+
+	t.Run("Shrink After Bulk Delete", func(t *testing.T) {
+		resizes = nil
+		for i := 10; i < 500; i++ {
+			ht.Delete(fmt.Sprintf("key_%d", i))
+		}
+		finish()
+		if ht.capacity >= grown || ht.capacity < 16 {
+			t.Fatalf("capacity after bulk delete = %d; want between 16 and %d", ht.capacity, grown)
+		}
+		if load := float64(ht.size) / float64(ht.capacity); load > ht.loadFactor/2 {
+			t.Errorf("load factor after shrink = %v; want at most %v", load, ht.loadFactor/2)
+		}
+		if len(resizes) == 0 {
+			t.Errorf("OnResize was not called for the shrink")
+		}
+		for _, r := range resizes {
+			if r[1] >= r[0] {
+				t.Errorf("OnResize(%d, %d) during bulk delete; want only shrinks", r[0], r[1])
+			}
+		}
+		for i := 0; i < 10; i++ {
+			assertGetValue(t, ht, fmt.Sprintf("key_%d", i), i, true)
+		}
+	})
+
+	t.Run("Never Below Initial Capacity", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			ht.Delete(fmt.Sprintf("key_%d", i))
+		}
+		finish()
+		if ht.capacity != 16 {
+			t.Errorf("capacity of empty table = %d; want 16", ht.capacity)
+		}
+	})
+}
+
+// Test that Scan returns every remaining key while the table shrinks
+func TestHashTable_ScanDuringShrink(t *testing.T) {
+	ht := NewHashTable()
+	for i := 0; i < 2000; i++ {
+		ht.Insert(fmt.Sprintf("key_%d", i), i)
+	}
+	for ht.Rehash(100) {
+	}
+
+	seen := map[string]bool{}
+	cursor := ht.Scan(0, func(key string, value any) { seen[key] = true })
+	for steps := 0; cursor != 0; steps++ {
+		if steps == 100 {
+			// Delete all but the first 50 keys, which starts a shrink.
+			for i := 50; i < 2000; i++ {
+				ht.Delete(fmt.Sprintf("key_%d", i))
+			}
+			if !ht.rehashing() {
+				t.Fatalf("the test needs a shrink in progress")
+			}
+		}
+		if steps > 100 {
+			ht.Rehash(2)
+		}
+		cursor = ht.Scan(cursor, func(key string, value any) { seen[key] = true })
+	}
+	for i := 0; i < 50; i++ {
+		if key := fmt.Sprintf("key_%d", i); !seen[key] {
+			t.Errorf("Scan never returned %q", key)
+		}
+	}
+}
+
+// fnv1a is the unseeded hash the table used before SeededHash.
+func fnv1a(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+var (
+	floodKeysOnce sync.Once
+	floodKeys     []string
+)
+
+// craftedFNVCollisions returns 1000 keys whose FNV-1a hashes end in 12 zero
+// bits, as an attacker could compute offline: with FNV they all share one
+// bucket in any table of up to 4096 buckets.
+func craftedFNVCollisions() []string {
+	floodKeysOnce.Do(func() {
+		for i := 0; len(floodKeys) < 1000; i++ {
+			key := fmt.Sprintf("flood:%d", i)
+			if fnv1a(key)&0xfff == 0 {
+				floodKeys = append(floodKeys, key)
+			}
+		}
+	})
+	return floodKeys
+}
+
+// longestChain returns the length of the longest bucket chain.
+func longestChain(ht *HashTable) int {
+	longest := 0
+	for _, buckets := range [][]*Node{ht.buckets, ht.rehashBuckets} {
+		for _, node := range buckets {
+			length := 0
+			for ; node != nil; node = node.next {
+				length++
+			}
+			longest = max(longest, length)
+		}
+	}
+	return longest
+}
+
+// Test that keys crafted to collide under FNV-1a only pile up in one bucket
+// with the unseeded hash, not with the default seeded one
+func TestHashTable_HashFlooding(t *testing.T) {
+	keys := craftedFNVCollisions()
+
+	unseeded := NewHashTableWithHasher(fnv1a)
+	seeded := NewHashTable()
+	for _, key := range keys {
+		unseeded.Insert(key, key)
+		seeded.Insert(key, key)
+	}
+	for unseeded.Rehash(100) || seeded.Rehash(100) {
+	}
+
+	if got := longestChain(unseeded); got != len(keys) {
+		t.Errorf("longest chain with FNV-1a = %d; want all %d keys in one bucket", got, len(keys))
+	}
+	if got := longestChain(seeded); got > 16 {
+		t.Errorf("longest chain with SeededHash = %d; want the crafted keys spread out", got)
+	}
+	for _, key := range keys {
+		assertGetValue(t, seeded, key, key, true)
+	}
+}
+
+func BenchmarkGet_CraftedFNVCollisions(b *testing.B) {
+	keys := craftedFNVCollisions()
+	for _, bench := range []struct {
+		name   string
+		hasher Hasher
+	}{
+		{"FNV1a", fnv1a},
+		{"Seeded", SeededHash},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ht := NewHashTableWithHasher(bench.hasher)
+			for _, key := range keys {
+				ht.Insert(key, key)
+			}
+			for ht.Rehash(100) {
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ht.Get(keys[i%len(keys)])
+			}
+		})
+	}
+}
+
+// Test a Table with non-string keys and a concrete value type
+func TestTable_Generic(t *testing.T) {
+	type point struct{ X, Y int }
+	hashInt := func(key int) uint64 { return uint64(key) * 0x9e3779b97f4a7c15 }
+	table := NewTable[int, point](hashInt)
+
+	for i := 0; i < 1000; i++ {
+		table.Insert(i, point{i, -i})
+	}
+	if table.Len() != 1000 {
+		t.Fatalf("Len = %d; want 1000", table.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if p, ok := table.Get(i); !ok || p != (point{i, -i}) {
+			t.Fatalf("Get(%d) = %v, %v; want {%d %d}, true", i, p, ok, i, -i)
+		}
+	}
+
+	// A missing key yields the zero value of V.
+	if p, ok := table.Get(-1); ok || p != (point{}) {
+		t.Errorf("Get(-1) = %v, %v; want zero value, false", p, ok)
+	}
+
+	for i := 0; i < 1000; i += 2 {
+		table.Delete(i)
+	}
+	sum := 0
+	table.ForEach(func(key int, value point) bool {
+		if key%2 == 0 || value.X != key {
+			t.Errorf("ForEach visited %d: %v", key, value)
+		}
+		sum++
+		return true
+	})
+	if sum != 500 {
+		t.Errorf("ForEach visited %d keys; want 500", sum)
+	}
+	if key, ok := table.RandomKey(); !ok || key%2 == 0 {
+		t.Errorf("RandomKey = %d, %v; want an odd key", key, ok)
+	}
+}
+
+func TestTable_AccessMetadata(t *testing.T) {
+	now := int64(1_000_000_000)
+	table := NewTable[string, int](SeededHash)
+	table.now = func() int64 { return now }
+
+	table.Insert("k", 1)
+	if idle, freq, ok := table.Access("k"); !ok || idle != 0 || freq != lfuInitValue {
+		t.Fatalf("Access of a new key = %d, %d, %v; want 0, %d, true", idle, freq, ok, lfuInitValue)
+	}
+
+	// Peek and Access do not count as accesses.
+	now += 5000
+	table.Peek("k")
+	if idle, _, _ := table.Access("k"); idle != 5000 {
+		t.Errorf("idle after Peek = %d; want 5000", idle)
+	}
+
+	// Neither is overwriting a key: the caller's lookup records the access.
+	table.Insert("k", 2)
+	table.Update("k", 3)
+	if idle, freq, _ := table.Access("k"); idle != 5000 || freq != lfuInitValue {
+		t.Errorf("Access after Insert and Update = %d, %d; want 5000, %d", idle, freq, lfuInitValue)
+	}
+
+	// At the initial value every access increments the counter.
+	table.Get("k")
+	if idle, freq, _ := table.Access("k"); idle != 0 || freq != lfuInitValue+1 {
+		t.Errorf("Access after Get = %d, %d; want 0, %d", idle, freq, lfuInitValue+1)
+	}
+
+	// Beyond it, increments get less likely as the counter grows.
+	for i := 0; i < 10000; i++ {
+		table.Get("k")
+	}
+	_, freq, _ := table.Access("k")
+	if freq < 35 || freq > 70 {
+		t.Errorf("counter after 10000 accesses = %d; want a logarithmic count, about 50", freq)
+	}
+
+	// The counter decays by one per idle minute.
+	now += 3 * 60000
+	if _, decayed, _ := table.Access("k"); decayed != freq-3 {
+		t.Errorf("counter after 3 idle minutes = %d; want %d", decayed, freq-3)
+	}
+	now += 1000 * 60000
+	if _, decayed, _ := table.Access("k"); decayed != 0 {
+		t.Errorf("counter after 1000 idle minutes = %d; want 0", decayed)
+	}
+
+	if _, _, ok := table.Access("missing"); ok {
+		t.Errorf("Access of a missing key reported ok")
+	}
+}
@@ -0,0 +1,78 @@
+package kvstore
+
+import "math/bits"
+
+// ForEach calls fn for every live key in the table, in no particular order,
+// until fn returns false. fn must not modify the table.
+func (ht *Table[K, V]) ForEach(fn func(key K, value V) bool) {
+	now := ht.now()
+	for _, buckets := range [][]*node[K, V]{ht.buckets, ht.rehashBuckets} {
+		for _, node := range buckets {
+			for ; node != nil; node = node.next {
+				if ht.expired(node, now) {
+					continue
+				}
+				if !fn(node.key, node.value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Scan calls fn for every live key in the bucket selected by cursor and
+// returns the cursor of the next bucket to visit; iteration is complete when
+// the returned cursor is 0. fn must not modify the table.
+//
+// As in Redis' dictScan, the cursor is incremented in reverse binary order
+// (its high bits first). Because the capacity is always a power of two, the
+// keys of bucket i end up in buckets i and i+capacity when the table grows,
+// and both come after i in that order, so every key present for the whole
+// iteration is returned at least once even if the table is resized between
+// calls. Keys may be returned more than once.
+func (ht *Table[K, V]) Scan(cursor uint64, fn func(key K, value V)) uint64 {
+	now := ht.now()
+	visit := func(node *node[K, V]) {
+		for ; node != nil; node = node.next {
+			if !ht.expired(node, now) {
+				fn(node.key, node.value)
+			}
+		}
+	}
+
+	if !ht.rehashing() {
+		mask := uint64(ht.capacity - 1)
+		visit(ht.buckets[cursor&mask])
+		return nextCursor(cursor, mask)
+	}
+
+	// During a rehash, visit the cursor's bucket in the smaller array and
+	// every bucket of the larger array that its keys can expand to, i.e. the
+	// buckets whose index ends with the same low bits.
+	small, large := ht.buckets, ht.rehashBuckets
+	if len(small) > len(large) {
+		small, large = large, small
+	}
+	smallMask, largeMask := uint64(len(small)-1), uint64(len(large)-1)
+
+	visit(small[cursor&smallMask])
+	for {
+		visit(large[cursor&largeMask])
+		cursor = nextCursor(cursor, largeMask)
+		// Stop once the increment carries past the bits that only the larger
+		// array uses.
+		if cursor&(smallMask^largeMask) == 0 {
+			return cursor
+		}
+	}
+}
+
+// nextCursor increments the masked bits of cursor in reverse binary order.
+func nextCursor(cursor, mask uint64) uint64 {
+	// Set the bits above the mask so that incrementing the reversed cursor
+	// carries into the masked bits only.
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
@@ -0,0 +1,192 @@
+package kvstore
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Listpack is a sequence of byte strings packed into a single buffer, like
+// Redis' listpack. Each entry costs its bytes and a few bytes of lengths, with
+// no pointers for the garbage collector to chase, but finding an entry takes
+// a linear scan, so it suits small collections, such as a small hash stored
+// as alternating fields and values.
+//
+// Each entry is packed as its length as a uvarint, the bytes themselves, and
+// the size of those two again as a "backlen" that can be decoded from its
+// last byte, so the buffer can be walked in both directions. Quicklist nodes
+// use the same format.
+//
+// Entries are never modified in place: Set and Delete build a new buffer and
+// Append only writes past the existing entries. The slices returned by Get
+// and Iter thus stay valid and unchanged after the listpack is modified, and
+// must not be modified by callers. The bytes passed in are copied.
+type Listpack struct {
+	buf   []byte
+	count int
+}
+
+// NewListpack returns an empty listpack.
+func NewListpack() *Listpack {
+	return &Listpack{}
+}
+
+// Len returns the number of entries.
+func (lp *Listpack) Len() int {
+	return lp.count
+}
+
+// Size returns the number of bytes the packed entries take.
+func (lp *Listpack) Size() int {
+	return len(lp.buf)
+}
+
+// Append adds the values after the last entry.
+func (lp *Listpack) Append(vs ...[]byte) {
+	for _, v := range vs {
+		lp.buf = appendEntry(lp.buf, v)
+	}
+	lp.count += len(vs)
+}
+
+// offsetOf returns the offset of entry i, which may be Len for the end of the
+// buffer.
+func (lp *Listpack) offsetOf(i int) int {
+	off := 0
+	for ; i > 0; i-- {
+		_, off = entryAt(lp.buf, off)
+	}
+	return off
+}
+
+// Get returns entry i.
+func (lp *Listpack) Get(i int) ([]byte, bool) {
+	if i < 0 || i >= lp.count {
+		return nil, false
+	}
+	v, _ := entryAt(lp.buf, lp.offsetOf(i))
+	return v, true
+}
+
+// Find returns the index of the first entry equal to v among entries 0, step,
+// 2*step and so on, or -1. A hash stored as fields and values looks up a
+// field with a step of 2.
+func (lp *Listpack) Find(v []byte, step int) int {
+	for i, off := 0, 0; off < len(lp.buf); i++ {
+		var e []byte
+		e, off = entryAt(lp.buf, off)
+		if i%step == 0 && bytes.Equal(e, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Set replaces entry i and reports whether it exists.
+func (lp *Listpack) Set(i int, v []byte) bool {
+	if i < 0 || i >= lp.count {
+		return false
+	}
+	off := lp.offsetOf(i)
+	_, next := entryAt(lp.buf, off)
+	buf := make([]byte, 0, len(lp.buf)-(next-off)+entrySize(len(v)))
+	buf = appendEntry(append(buf, lp.buf[:off]...), v)
+	lp.buf = append(buf, lp.buf[next:]...)
+	return true
+}
+
+// Delete removes count entries starting at entry start. Entries beyond the
+// end are ignored.
+func (lp *Listpack) Delete(start, count int) {
+	count = min(count, lp.count-start)
+	if start < 0 || count <= 0 {
+		return
+	}
+	from := lp.offsetOf(start)
+	to := from
+	for j := 0; j < count; j++ {
+		_, to = entryAt(lp.buf, to)
+	}
+	buf := make([]byte, 0, len(lp.buf)-(to-from))
+	lp.buf = append(append(buf, lp.buf[:from]...), lp.buf[to:]...)
+	lp.count -= count
+}
+
+// Iter calls fn for the entries in order until fn returns false.
+func (lp *Listpack) Iter(fn func(i int, v []byte) bool) {
+	for i, off := 0, 0; off < len(lp.buf); i++ {
+		var v []byte
+		v, off = entryAt(lp.buf, off)
+		if !fn(i, v) {
+			return
+		}
+	}
+}
+
+// Clone returns a copy of the listpack that shares no memory with it.
+func (lp *Listpack) Clone() *Listpack {
+	return &Listpack{buf: bytes.Clone(lp.buf), count: lp.count}
+}
+
+// appendEntry packs v at the end of dst.
+func appendEntry(dst, v []byte) []byte {
+	start := len(dst)
+	dst = binary.AppendUvarint(dst, uint64(len(v)))
+	dst = append(dst, v...)
+	return appendBacklen(dst, len(dst)-start)
+}
+
+// entrySize returns the packed size of an entry holding n bytes.
+func entrySize(n int) int {
+	size := uvarintLen(uint64(n)) + n
+	return size + uvarintLen(uint64(size))
+}
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// appendBacklen appends size in 7-bit groups, most significant first, with
+// the high bit set on every byte but the first. Read from the end, the set
+// bit says whether another byte follows to the left.
+func appendBacklen(dst []byte, size int) []byte {
+	n := uvarintLen(uint64(size))
+	for i := n - 1; i >= 0; i-- {
+		b := byte(size>>(7*i)) & 0x7f
+		if i != n-1 {
+			b |= 0x80
+		}
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+// entryAt decodes the entry starting at off and returns its bytes and the
+// offset of the next entry.
+func entryAt(buf []byte, off int) (v []byte, next int) {
+	n, hdr := binary.Uvarint(buf[off:])
+	start := off + hdr
+	end := start + int(n)
+	return buf[start:end:end], end + uvarintLen(uint64(end-off))
+}
+
+// entryBefore decodes the entry ending at end and returns its bytes and its
+// offset.
+func entryBefore(buf []byte, end int) (v []byte, off int) {
+	size, shift := 0, 0
+	for {
+		end--
+		size |= int(buf[end]&0x7f) << shift
+		shift += 7
+		if buf[end]&0x80 == 0 {
+			break
+		}
+	}
+	off = end - size
+	v, _ = entryAt(buf, off)
+	return v, off
+}
@@ -0,0 +1,60 @@
+package kvstore
+
+import (
+	"strconv"
+	"testing"
+)
+
+func entries(lp *Listpack) []string {
+	var got []string
+	lp.Iter(func(i int, v []byte) bool {
+		got = append(got, string(v))
+		return true
+	})
+	return got
+}
+
+func TestListpack(t *testing.T) {
+	lp := NewListpack()
+	for i := 0; i < 10; i++ {
+		lp.Append([]byte("f"+strconv.Itoa(i)), []byte("v"+strconv.Itoa(i)))
+	}
+	if lp.Len() != 20 {
+		t.Fatalf("Len = %d; want 20", lp.Len())
+	}
+	// Fields are found at even indexes only.
+	lp.Set(3, []byte("f2"))
+	if i := lp.Find([]byte("f2"), 2); i != 4 {
+		t.Errorf("Find(f2, 2) = %d; want 4", i)
+	}
+	if i := lp.Find([]byte("f2"), 1); i != 3 {
+		t.Errorf("Find(f2, 1) = %d; want 3", i)
+	}
+	if i := lp.Find([]byte("nope"), 2); i != -1 {
+		t.Errorf("Find(nope, 2) = %d; want -1", i)
+	}
+
+	// Returned entries are unaffected by later changes.
+	old, _ := lp.Get(5)
+	lp.Set(5, []byte("a much longer value than before"))
+	lp.Delete(0, 4)
+	lp.Append([]byte("tail"))
+	if string(old) != "v2" {
+		t.Errorf("entry returned before the changes = %q; want v2", old)
+	}
+	if v, _ := lp.Get(1); string(v) != "a much longer value than before" {
+		t.Errorf("Get(1) after Set and Delete = %q", v)
+	}
+
+	c := lp.Clone()
+	lp.Delete(1, 100)
+	if got := entries(lp); len(got) != 1 || got[0] != "f2" || lp.Len() != 1 {
+		t.Errorf("entries after Delete = %q, Len %d; want [f2]", got, lp.Len())
+	}
+	if c.Len() != 17 || len(entries(c)) != 17 {
+		t.Errorf("clone has %d entries; want 17", c.Len())
+	}
+	if _, ok := lp.Get(1); ok {
+		t.Errorf("Get past the end succeeded")
+	}
+}
@@ -1,104 +1,265 @@
 package kvstore
 
 import (
-	"fmt"
-	"hash/fnv"
+	"math/bits"
+	"math/rand/v2"
+	"time"
 )
 
-type Node struct {
-	key   string
-	value any
-	next  *Node
+type node[K comparable, V any] struct {
+	key      K
+	value    V
+	expireAt int64 // Unix time in milliseconds after which the key is gone; 0 if it never expires
+	next     *node[K, V]
+
+	// Access metadata; see access.go.
+	accessedAt int64  // Unix time in milliseconds of the last access
+	freqTime   uint16 // Unix time in minutes, modulo 2^16, when freq was last decayed
+	freq       uint8  // Logarithmic access counter
 }
 
-type HashTable struct {
-	buckets  []*Node
-	capacity int
-	size     int
+// Table is a chained hash table mapping keys of type K to values of type V.
+// Resizing it is incremental, as in Redis: a new bucket array is allocated
+// and keys are moved over a few buckets at a time, by every Insert, Get and
+// Delete and by calls to Rehash, so no single operation has to move every
+// key. While a rehash is in progress keys live in both arrays and lookups
+// consult both.
+//
+// The table grows when the load factor is reached and shrinks when it falls
+// below an eighth of it, so a table that just resized is far from both
+// thresholds and does not thrash.
+type Table[K comparable, V any] struct {
+	buckets  []*node[K, V] // Main bucket array; the old one during a rehash
+	capacity int           // len(buckets), always a power of two
+	size     int           // Number of keys in both bucket arrays
+
+	rehashBuckets []*node[K, V] // Bucket array keys are moving to, or nil
+	rehashIndex   int           // Next bucket of buckets to move; -1 when not rehashing
+
+	minCapacity int     // Initial capacity; the table never shrinks below it
+	loadFactor  float64 // Grow when size/capacity reaches this
+	onResize    func(oldCapacity, newCapacity int)
+	hash        func(key K) uint64
+
+	volatile     int          // Number of keys with an expiry
+	expireCursor int          // Bucket where the next active expire cycle resumes
+	now          func() int64 // Current Unix time in milliseconds
+}
+
+// Options configures a table. Zero fields take the defaults.
+type Options struct {
+	// InitialCapacity is the number of buckets to start with, rounded up to
+	// a power of two. The table never shrinks below it. Defaults to 128.
+	InitialCapacity int
+	// LoadFactor is the number of keys per bucket at which the table grows.
+	// Defaults to 0.8.
+	LoadFactor float64
+	// OnResize, if set, is called whenever a resize completes, e.g. to
+	// record it in metrics.
+	OnResize func(oldCapacity, newCapacity int)
 }
 
 const (
 	initialCapacity = 128 // 128 keys can be stored initially in the hashtable
 	loadFactorLimit = 0.8 // Resize when hashtable is filled up 80%
+
+	// shrinkDivisor sets the shrink threshold: the table shrinks when its
+	// load factor falls below loadFactor/shrinkDivisor.
+	shrinkDivisor = 8
+
+	// rehashEmptyVisits bounds how many empty buckets one rehash step may
+	// skip per bucket it is asked to move, so a step stays cheap even when
+	// the old table is sparse.
+	rehashEmptyVisits = 10
 )
 
-func NewHashTable() *HashTable {
-	return &HashTable{
-		buckets:  make([]*Node, initialCapacity),
-		capacity: initialCapacity,
-		size:     0,
+// NewTable returns an empty table that hashes keys with hash, configured by
+// opts if given. For string keys, SeededHash is the usual choice.
+func NewTable[K comparable, V any](hash func(key K) uint64, opts ...Options) *Table[K, V] {
+	var o Options
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.InitialCapacity <= 0 {
+		o.InitialCapacity = initialCapacity
+	}
+	if o.LoadFactor <= 0 {
+		o.LoadFactor = loadFactorLimit
+	}
+
+	capacity := 1 << bits.Len(uint(o.InitialCapacity-1))
+	return &Table[K, V]{
+		buckets:     make([]*node[K, V], capacity),
+		capacity:    capacity,
+		size:        0,
+		rehashIndex: -1,
+		minCapacity: capacity,
+		loadFactor:  o.LoadFactor,
+		onResize:    o.OnResize,
+		hash:        hash,
+		now:         func() int64 { return time.Now().UnixMilli() },
 	}
 }
 
-func hash(key string) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte(key))
-	return h.Sum64()
+// indexFor returns the bucket of buckets that a key with hash code h belongs
+// in. The number of buckets is a power of two.
+func indexFor[K comparable, V any](h uint64, buckets []*node[K, V]) int {
+	return int(h & uint64(len(buckets)-1))
 }
 
-func (ht *HashTable) getIndex(key string) int {
-	hashCode := hash(key)
-	index := int(hashCode % uint64(ht.capacity))
-	return index
+// rehashing reports whether keys are being moved to a new bucket array.
+func (ht *Table[K, V]) rehashing() bool {
+	return ht.rehashIndex >= 0
 }
 
-func (ht *HashTable) Insert(key string, value any) {
-	if float64(ht.size)/float64(ht.capacity) >= loadFactorLimit {
-		ht.resize()
+// Insert stores value under key, replacing any previous value together with
+// its expiry. Like Update, it does not count as an access: an overwritten key
+// keeps its access metadata, and the caller's lookup records the access.
+func (ht *Table[K, V]) Insert(key K, value V) {
+	if ht.rehashing() {
+		ht.rehashStep()
+	} else if float64(ht.size)/float64(ht.capacity) >= ht.loadFactor {
+		ht.startRehash(ht.capacity * 2)
 	}
 
-	idx := ht.getIndex(key)
-	currentNode := ht.buckets[idx]
-
-	for currentNode != nil {
-		if currentNode.key == key {
-			currentNode.value = value
-			return
-		}
-		currentNode = currentNode.next
+	if node := ht.find(key); node != nil {
+		node.value = value
+		ht.clearExpire(node)
+		return
 	}
 
-	newNode := &Node{
+	// New keys go straight to the new bucket array during a rehash, so the
+	// old one only ever shrinks.
+	buckets := ht.buckets
+	if ht.rehashing() {
+		buckets = ht.rehashBuckets
+	}
+	idx := indexFor(ht.hash(key), buckets)
+	newNode := &node[K, V]{
 		key:   key,
 		value: value,
-		next:  ht.buckets[idx],
+		next:  buckets[idx],
 	}
+	ht.initAccess(newNode)
 
-	ht.buckets[idx] = newNode
+	buckets[idx] = newNode
 	ht.size++
 }
 
-func (ht *HashTable) Get(key string) (any, bool) {
-	index := ht.getIndex(key)
-	currentNode := ht.buckets[index]
+// Get returns the value stored under key and records the access. Keys whose
+// expiry has passed are deleted on access and reported as missing, so Get
+// may modify the table.
+func (ht *Table[K, V]) Get(key K) (V, bool) {
+	node := ht.lookup(key)
+	if node == nil {
+		var zero V
+		return zero, false
+	}
+	ht.touch(node)
+	return node.value, true
+}
+
+// Peek is Get without recording an access, for lookups that only inspect a
+// key, like Redis' LOOKUP_NOTOUCH.
+func (ht *Table[K, V]) Peek(key K) (V, bool) {
+	node := ht.lookup(key)
+	if node == nil {
+		var zero V
+		return zero, false
+	}
+	return node.value, true
+}
+
+// Update replaces the value of an existing key, keeping its expiry and access
+// metadata. It reports whether the key existed.
+func (ht *Table[K, V]) Update(key K, value V) bool {
+	node := ht.lookup(key)
+	if node == nil {
+		return false
+	}
+	node.value = value
+	return true
+}
+
+// lookup returns the live node for key, lazily deleting it if it expired.
+func (ht *Table[K, V]) lookup(key K) *node[K, V] {
+	if ht.rehashing() {
+		ht.rehashStep()
+	}
+
+	node := ht.find(key)
+	if node != nil && ht.expired(node, ht.now()) {
+		ht.remove(key)
+		return nil
+	}
+	return node
+}
+
+// find returns the node for key from either bucket array, expired or not.
+func (ht *Table[K, V]) find(key K) *node[K, V] {
+	h := ht.hash(key)
+	node := findIn(ht.buckets, key, h)
+	if node == nil && ht.rehashing() {
+		node = findIn(ht.rehashBuckets, key, h)
+	}
+	return node
+}
 
+func findIn[K comparable, V any](buckets []*node[K, V], key K, h uint64) *node[K, V] {
+	currentNode := buckets[indexFor(h, buckets)]
 	for currentNode != nil {
 		if currentNode.key == key {
-			return currentNode.value, true
+			return currentNode
 		}
-
 		currentNode = currentNode.next
 	}
+	return nil
+}
 
-	return nil, false
+// Delete removes key and reports whether it existed.
+func (ht *Table[K, V]) Delete(key K) bool {
+	if ht.rehashing() {
+		ht.rehashStep()
+	}
+	if !ht.remove(key) {
+		return false
+	}
+	ht.maybeShrink()
+	return true
+}
+
+// remove deletes key without moving any buckets, so callers walking a
+// bucket chain can delete the node they are on.
+func (ht *Table[K, V]) remove(key K) bool {
+	h := ht.hash(key)
+	node := removeFrom(ht.buckets, key, h)
+	if node == nil && ht.rehashing() {
+		node = removeFrom(ht.rehashBuckets, key, h)
+	}
+	if node == nil {
+		return false
+	}
+	ht.clearExpire(node)
+	ht.size--
+	return true
 }
 
-func (ht *HashTable) Delete(key string) {
-	index := ht.getIndex(key)
-	currentNode := ht.buckets[index]
-	var previousNode *Node = nil
+// removeFrom unlinks the node for key from its chain and returns it, or nil
+// if the key is not in buckets.
+func removeFrom[K comparable, V any](buckets []*node[K, V], key K, h uint64) *node[K, V] {
+	index := indexFor(h, buckets)
+	currentNode := buckets[index]
+	var previousNode *node[K, V] = nil
 
 	for currentNode != nil {
 		if currentNode.key == key {
 			//currentNode is head
 			if previousNode == nil {
-				ht.buckets[index] = currentNode.next
+				buckets[index] = currentNode.next
 			} else {
 				previousNode.next = currentNode.next
 			}
-
-			ht.size--
-			return
+			return currentNode
 		}
 
 		previousNode = currentNode
@@ -106,24 +267,256 @@ func (ht *HashTable) Delete(key string) {
 	}
 
 	// Key not found.
+	return nil
+}
+
+// Len returns the number of keys in the table. Keys that expired but were
+// not removed yet are included.
+func (ht *Table[K, V]) Len() int {
+	return ht.size
+}
+
+// RandomKey returns a key picked at random, or false if the table is empty.
+// Expired keys met along the way are deleted.
+func (ht *Table[K, V]) RandomKey() (K, bool) {
+	now := ht.now()
+	for ht.size > 0 {
+		node := ht.randomNode()
+		if ht.expired(node, now) {
+			ht.remove(node.key)
+			continue
+		}
+		return node.key, true
+	}
+	var zero K
+	return zero, false
 }
 
-func (ht *HashTable) resize() {
-	newCapacity := ht.capacity * 2
-	newBuckets := make([]*Node, newCapacity)
+// randomNode picks a random non-empty bucket and a random node in its chain.
+// The table must not be empty.
+func (ht *Table[K, V]) randomNode() *node[K, V] {
+	// Buckets of both arrays are numbered one after the other. Buckets of the
+	// old array below rehashIndex are empty and are simply skipped.
+	total := ht.capacity + len(ht.rehashBuckets)
+	bucket := func(i int) *node[K, V] {
+		if i < ht.capacity {
+			return ht.buckets[i]
+		}
+		return ht.rehashBuckets[i-ht.capacity]
+	}
 
-	for _, headNode := range ht.buckets {
-		currentNode := headNode
+	// Random probes find a key quickly unless the table is very sparse; then
+	// walk forward from a random bucket so the search stays bounded.
+	index := rand.IntN(total)
+	for tries := 0; bucket(index) == nil; tries++ {
+		if tries < 100 {
+			index = rand.IntN(total)
+		} else {
+			index = (index + 1) % total
+		}
+	}
+
+	length := 0
+	for node := bucket(index); node != nil; node = node.next {
+		length++
+	}
+	node := bucket(index)
+	for n := rand.IntN(length); n > 0; n-- {
+		node = node.next
+	}
+	return node
+}
+
+// Clear removes every key and shrinks the table back to its initial
+// capacity.
+func (ht *Table[K, V]) Clear() {
+	ht.buckets = make([]*node[K, V], ht.minCapacity)
+	ht.capacity = ht.minCapacity
+	ht.size = 0
+	ht.rehashBuckets = nil
+	ht.rehashIndex = -1
+	ht.volatile = 0
+	ht.expireCursor = 0
+}
+
+// maybeShrink starts moving the keys to a smaller bucket array if the load
+// factor fell below the shrink threshold. The new capacity puts the load
+// factor at no more than half the growth threshold.
+func (ht *Table[K, V]) maybeShrink() {
+	if ht.rehashing() || ht.capacity <= ht.minCapacity {
+		return
+	}
+	if float64(ht.size)/float64(ht.capacity) >= ht.loadFactor/shrinkDivisor {
+		return
+	}
+
+	newCapacity := ht.capacity
+	for newCapacity > ht.minCapacity && float64(ht.size)/float64(newCapacity/2) <= ht.loadFactor/2 {
+		newCapacity /= 2
+	}
+	ht.startRehash(newCapacity)
+}
+
+// startRehash allocates a bucket array of newCapacity buckets that keys will
+// move to.
+func (ht *Table[K, V]) startRehash(newCapacity int) {
+	ht.rehashBuckets = make([]*node[K, V], newCapacity)
+	ht.rehashIndex = 0
+}
+
+// rehashStep moves one bucket, as every Insert, Get and Delete does during a
+// rehash.
+func (ht *Table[K, V]) rehashStep() {
+	ht.Rehash(1)
+}
+
+// Rehash moves up to n buckets to the new bucket array and reports whether
+// a rehash is still in progress, which includes a shrink started because
+// the one that just finished left the table underused. It returns false
+// right away if there is no rehash to do. Callers use it to finish a rehash in the background
+// while the table is idle.
+func (ht *Table[K, V]) Rehash(n int) bool {
+	if !ht.rehashing() {
+		return false
+	}
+
+	emptyVisits := n * rehashEmptyVisits
+	for ; n > 0 && ht.rehashIndex < ht.capacity; n-- {
+		for ht.buckets[ht.rehashIndex] == nil {
+			ht.rehashIndex++
+			emptyVisits--
+			if ht.rehashIndex == ht.capacity {
+				break
+			}
+			if emptyVisits == 0 {
+				return true
+			}
+		}
+		if ht.rehashIndex == ht.capacity {
+			break
+		}
+
+		currentNode := ht.buckets[ht.rehashIndex]
 		for currentNode != nil {
 			nextNode := currentNode.next
-			newIndex := int(hash(currentNode.key) % uint64(newCapacity))
-			currentNode.next = newBuckets[newIndex]
-			newBuckets[newIndex] = currentNode
+			newIndex := indexFor(ht.hash(currentNode.key), ht.rehashBuckets)
+			currentNode.next = ht.rehashBuckets[newIndex]
+			ht.rehashBuckets[newIndex] = currentNode
 			currentNode = nextNode
 		}
+		ht.buckets[ht.rehashIndex] = nil
+		ht.rehashIndex++
 	}
 
-	ht.buckets = newBuckets
-	ht.capacity = newCapacity
-	fmt.Printf("--- Resized to capacity %d ---\n", ht.capacity)
+	if ht.rehashIndex < ht.capacity {
+		return true
+	}
+
+	// Every key has moved: the new bucket array becomes the main one.
+	oldCapacity := ht.capacity
+	ht.buckets = ht.rehashBuckets
+	ht.capacity = len(ht.rehashBuckets)
+	ht.rehashBuckets = nil
+	ht.rehashIndex = -1
+	if ht.onResize != nil {
+		ht.onResize(oldCapacity, ht.capacity)
+	}
+
+	// Deletes during the rehash may have left the new array underused too.
+	ht.maybeShrink()
+	return ht.rehashing()
+}
+
+// SetExpire makes key expire at the given Unix time in milliseconds. A time
+// that has already passed deletes the key right away. It reports whether the
+// key existed.
+func (ht *Table[K, V]) SetExpire(key K, at int64) bool {
+	node := ht.lookup(key)
+	if node == nil {
+		return false
+	}
+	if at <= ht.now() {
+		ht.remove(key)
+		return true
+	}
+	if node.expireAt == 0 {
+		ht.volatile++
+	}
+	node.expireAt = at
+	return true
+}
+
+// Persist removes the expiry of key. It reports whether there was one.
+func (ht *Table[K, V]) Persist(key K) bool {
+	node := ht.lookup(key)
+	if node == nil || node.expireAt == 0 {
+		return false
+	}
+	ht.clearExpire(node)
+	return true
+}
+
+// ExpireAt returns the Unix time in milliseconds at which key expires, or 0
+// if it has no expiry. ok is false if the key does not exist.
+func (ht *Table[K, V]) ExpireAt(key K) (at int64, ok bool) {
+	node := ht.lookup(key)
+	if node == nil {
+		return 0, false
+	}
+	return node.expireAt, true
+}
+
+// ActiveExpire deletes expired keys that nobody accesses. It walks the
+// buckets from where the previous call stopped, examining up to maxSample
+// keys that have an expiry, and returns how many it examined and how many of
+// those it deleted. Callers repeat it while a large share of the sample
+// turns out to be expired.
+func (ht *Table[K, V]) ActiveExpire(maxSample int) (sampled, expired int) {
+	if ht.volatile == 0 {
+		return 0, 0
+	}
+
+	now := ht.now()
+	// Bound the walk so a sparse table doesn't turn one call into a full scan.
+	for visited := 0; visited < maxSample*16 && sampled < maxSample; visited++ {
+		// The cursor runs over the buckets of both arrays, one after the
+		// other.
+		if ht.expireCursor >= ht.capacity+len(ht.rehashBuckets) {
+			ht.expireCursor = 0
+		}
+		var currentNode *node[K, V]
+		if ht.expireCursor < ht.capacity {
+			currentNode = ht.buckets[ht.expireCursor]
+		} else {
+			currentNode = ht.rehashBuckets[ht.expireCursor-ht.capacity]
+		}
+		ht.expireCursor++
+
+		for currentNode != nil {
+			nextNode := currentNode.next
+			if currentNode.expireAt != 0 {
+				sampled++
+				if ht.expired(currentNode, now) {
+					ht.remove(currentNode.key)
+					expired++
+				}
+			}
+			currentNode = nextNode
+		}
+	}
+	if expired > 0 {
+		ht.maybeShrink()
+	}
+	return sampled, expired
+}
+
+func (ht *Table[K, V]) expired(node *node[K, V], now int64) bool {
+	return node.expireAt != 0 && node.expireAt <= now
+}
+
+func (ht *Table[K, V]) clearExpire(node *node[K, V]) {
+	if node.expireAt != 0 {
+		node.expireAt = 0
+		ht.volatile--
+	}
 }
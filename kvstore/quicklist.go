@@ -0,0 +1,406 @@
+package kvstore
+
+import (
+	"bytes"
+	"slices"
+)
+
+// maxNodeBytes is how large the packed entries of a Quicklist node may grow
+// before a new node is started, like Redis' default list-max-listpack-size
+// of -2 (8KB). An entry larger than this gets a node of its own.
+const maxNodeBytes = 8 * 1024
+
+// Quicklist is a list of byte strings, stored like Redis' quicklist: a doubly
+// linked list of nodes, each packing a run of entries into a single buffer.
+// Pushing and popping at either end is O(1), and the per-entry overhead is a
+// few bytes instead of a list element with two pointers.
+//
+// Each node packs its entries the way a Listpack does, so a node can be
+// walked in both directions.
+//
+// The bytes passed to the methods are copied, and the ones returned are
+// copies, so callers may keep and modify them. Only the slices handed to the
+// callback of Iter point into the list, and only until the callback returns.
+type Quicklist struct {
+	head, tail *qlNode
+	count      int // Number of entries
+	nodes      int // Number of nodes
+}
+
+type qlNode struct {
+	prev, next *qlNode
+	buf        []byte // Packed entries
+	count      int    // Number of entries in buf
+}
+
+// NewQuicklist returns an empty list.
+func NewQuicklist() *Quicklist {
+	return &Quicklist{}
+}
+
+// Len returns the number of entries.
+func (l *Quicklist) Len() int {
+	return l.count
+}
+
+// Nodes returns the number of nodes the entries are packed into.
+func (l *Quicklist) Nodes() int {
+	return l.nodes
+}
+
+// offsetOf returns the offset in n.buf of entry i, which may be n.count for
+// the end of the buffer. It walks from whichever end of the node is closer.
+func (n *qlNode) offsetOf(i int) int {
+	if i <= n.count/2 {
+		off := 0
+		for ; i > 0; i-- {
+			_, off = entryAt(n.buf, off)
+		}
+		return off
+	}
+	off := len(n.buf)
+	for j := n.count; j > i; j-- {
+		_, off = entryBefore(n.buf, off)
+	}
+	return off
+}
+
+// locate returns the node holding entry i, 0 <= i < l.count, and the index
+// of the entry within it. It walks from whichever end of the list is closer.
+func (l *Quicklist) locate(i int) (*qlNode, int) {
+	if i < l.count/2 {
+		n := l.head
+		for i >= n.count {
+			i -= n.count
+			n = n.next
+		}
+		return n, i
+	}
+	n, j := l.tail, l.count-1
+	for j-n.count >= i {
+		j -= n.count
+		n = n.prev
+	}
+	return n, n.count - 1 - (j - i)
+}
+
+// fits reports whether an entry of size bytes can be added to n.
+func (n *qlNode) fits(size int) bool {
+	return n.count == 0 || len(n.buf)+size <= maxNodeBytes
+}
+
+// insertNode links n into the list after prev, or at the head if prev is nil.
+func (l *Quicklist) insertNode(prev, n *qlNode) {
+	n.prev = prev
+	if prev == nil {
+		n.next = l.head
+		l.head = n
+	} else {
+		n.next = prev.next
+		prev.next = n
+	}
+	if n.next == nil {
+		l.tail = n
+	} else {
+		n.next.prev = n
+	}
+	l.nodes++
+}
+
+func (l *Quicklist) unlinkNode(n *qlNode) {
+	if n.prev == nil {
+		l.head = n.next
+	} else {
+		n.prev.next = n.next
+	}
+	if n.next == nil {
+		l.tail = n.prev
+	} else {
+		n.next.prev = n.prev
+	}
+	l.nodes--
+}
+
+// PushFront adds v at the head of the list.
+func (l *Quicklist) PushFront(v []byte) {
+	if l.head == nil || !l.head.fits(entrySize(len(v))) {
+		l.insertNode(nil, &qlNode{})
+	}
+	n := l.head
+	buf := make([]byte, 0, entrySize(len(v))+len(n.buf))
+	n.buf = append(appendEntry(buf, v), n.buf...)
+	n.count++
+	l.count++
+}
+
+// PushBack adds v at the tail of the list.
+func (l *Quicklist) PushBack(v []byte) {
+	if l.tail == nil || !l.tail.fits(entrySize(len(v))) {
+		l.insertNode(l.tail, &qlNode{})
+	}
+	n := l.tail
+	n.buf = appendEntry(n.buf, v)
+	n.count++
+	l.count++
+}
+
+// PopFront removes and returns the entry at the head of the list.
+func (l *Quicklist) PopFront() ([]byte, bool) {
+	if l.count == 0 {
+		return nil, false
+	}
+	v, _ := entryAt(l.head.buf, 0)
+	v = append([]byte(nil), v...)
+	l.Delete(0, 1)
+	return v, true
+}
+
+// PopBack removes and returns the entry at the tail of the list.
+func (l *Quicklist) PopBack() ([]byte, bool) {
+	if l.count == 0 {
+		return nil, false
+	}
+	v, _ := entryBefore(l.tail.buf, len(l.tail.buf))
+	v = append([]byte(nil), v...)
+	l.Delete(l.count-1, 1)
+	return v, true
+}
+
+// Index returns entry i, counting from 0 at the head.
+func (l *Quicklist) Index(i int) ([]byte, bool) {
+	if i < 0 || i >= l.count {
+		return nil, false
+	}
+	n, j := l.locate(i)
+	v, _ := entryAt(n.buf, n.offsetOf(j))
+	return append([]byte(nil), v...), true
+}
+
+// Set replaces entry i and reports whether it exists.
+func (l *Quicklist) Set(i int, v []byte) bool {
+	if i < 0 || i >= l.count {
+		return false
+	}
+	n, j := l.locate(i)
+	off := n.offsetOf(j)
+	_, next := entryAt(n.buf, off)
+	// Capping the capacity makes the appends build a new buffer, so the
+	// rest of the old one is still intact to be copied over.
+	old := n.buf
+	n.buf = append(appendEntry(old[:off:off], v), old[next:]...)
+	l.maybeSplit(n)
+	return true
+}
+
+// Insert adds v before entry i, so that it becomes entry i. i may be Len to
+// add v at the tail.
+func (l *Quicklist) Insert(i int, v []byte) {
+	switch {
+	case i <= 0:
+		l.PushFront(v)
+		return
+	case i >= l.count:
+		l.PushBack(v)
+		return
+	}
+
+	n, j := l.locate(i)
+	if j == 0 && n.prev != nil && n.prev.fits(entrySize(len(v))) {
+		// Entry i starts a node: appending to the previous one is cheaper.
+		n = n.prev
+		j = n.count
+	}
+	off := n.offsetOf(j)
+	old := n.buf
+	n.buf = append(appendEntry(old[:off:off], v), old[off:]...)
+	n.count++
+	l.count++
+	l.maybeSplit(n)
+}
+
+// maybeSplit splits n in two halves if it grew past maxNodeBytes and holds
+// more than one entry.
+func (l *Quicklist) maybeSplit(n *qlNode) {
+	if len(n.buf) <= maxNodeBytes || n.count < 2 {
+		return
+	}
+	half := n.count / 2
+	off := n.offsetOf(half)
+	right := &qlNode{buf: append([]byte(nil), n.buf[off:]...), count: n.count - half}
+	// Copy the left half too, so the two nodes never share spare capacity
+	// that appends to one could overwrite in the other.
+	n.buf = append([]byte(nil), n.buf[:off]...)
+	n.count = half
+	l.insertNode(n, right)
+}
+
+// Delete removes count entries starting at entry start. Entries beyond the
+// end of the list are ignored.
+func (l *Quicklist) Delete(start, count int) {
+	if start < 0 {
+		count += start
+		start = 0
+	}
+	count = min(count, l.count-start)
+	if count <= 0 {
+		return
+	}
+
+	n, j := l.locate(start)
+	before := n.prev
+	l.count -= count
+	for count > 0 {
+		next := n.next
+		k := min(count, n.count-j)
+		if k == n.count {
+			l.unlinkNode(n)
+		} else {
+			from, to := n.offsetOf(j), n.offsetOf(j+k)
+			if from == 0 {
+				// Popping from the front: reslicing avoids a copy.
+				n.buf = n.buf[to:]
+			} else {
+				n.buf = append(n.buf[:from], n.buf[to:]...)
+			}
+			n.count -= k
+		}
+		count -= k
+		n, j = next, 0
+	}
+
+	// At most two partly emptied nodes are left, right after before.
+	if before == nil {
+		before = l.head
+	}
+	l.compact(before, 4)
+}
+
+// Remove deletes the first count entries equal to v, counting from the head,
+// the last -count ones if count is negative, or all of them if count is 0.
+// It returns the number of entries deleted. Each node is filtered in a single
+// pass, so removing many entries takes time linear in the size of the list.
+func (l *Quicklist) Remove(v []byte, count int) int {
+	reverse, limit := count < 0, count
+	n := l.head
+	if reverse {
+		n, limit = l.tail, -count
+	}
+	removed := 0
+	var drop []int // Offsets of the entries of n to delete, ascending
+	for n != nil && (limit == 0 || removed < limit) {
+		drop = drop[:0]
+		more := func() bool { return limit == 0 || removed+len(drop) < limit }
+		next := n.next
+		if reverse {
+			next = n.prev
+			for off := len(n.buf); off > 0 && more(); {
+				var e []byte
+				e, off = entryBefore(n.buf, off)
+				if bytes.Equal(e, v) {
+					drop = append(drop, off)
+				}
+			}
+			slices.Reverse(drop)
+		} else {
+			for off := 0; off < len(n.buf) && more(); {
+				e, end := entryAt(n.buf, off)
+				if bytes.Equal(e, v) {
+					drop = append(drop, off)
+				}
+				off = end
+			}
+		}
+
+		switch {
+		case len(drop) == n.count:
+			l.unlinkNode(n)
+		case len(drop) > 0:
+			n.buf = filterEntries(n.buf, drop)
+			n.count -= len(drop)
+		}
+		removed += len(drop)
+		n = next
+	}
+
+	if removed > 0 {
+		l.count -= removed
+		l.compact(l.head, l.nodes)
+	}
+	return removed
+}
+
+// filterEntries deletes the entries starting at the ascending offsets drop
+// from buf, moving the remaining ones down in place, and returns the
+// shortened buffer.
+func filterEntries(buf []byte, drop []int) []byte {
+	w, r := 0, 0
+	for _, off := range drop {
+		w += copy(buf[w:], buf[r:off])
+		_, r = entryAt(buf, off)
+	}
+	w += copy(buf[w:], buf[r:])
+	return buf[:w]
+}
+
+// compact merges adjacent nodes among the first span nodes from n when
+// together they fill at most half a node, so deletions do not leave long
+// chains of nearly empty nodes.
+func (l *Quicklist) compact(n *qlNode, span int) {
+	for ; n != nil && n.next != nil && span > 1; span-- {
+		if next := n.next; len(n.buf)+len(next.buf) <= maxNodeBytes/2 {
+			n.buf = append(n.buf, next.buf...)
+			n.count += next.count
+			l.unlinkNode(next)
+		} else {
+			n = next
+		}
+	}
+}
+
+// Iter calls fn for the entries from entry start towards the tail, or
+// towards the head if reverse is set, until fn returns false. v is only
+// valid during the call, and fn must not modify the list.
+func (l *Quicklist) Iter(start int, reverse bool, fn func(i int, v []byte) bool) {
+	if start < 0 || start >= l.count {
+		return
+	}
+	n, j := l.locate(start)
+	i := start
+	if !reverse {
+		for off := n.offsetOf(j); n != nil; n, off = n.next, 0 {
+			for off < len(n.buf) {
+				var v []byte
+				v, off = entryAt(n.buf, off)
+				if !fn(i, v) {
+					return
+				}
+				i++
+			}
+		}
+		return
+	}
+	_, end := entryAt(n.buf, n.offsetOf(j))
+	for n != nil {
+		for end > 0 {
+			var v []byte
+			v, end = entryBefore(n.buf, end)
+			if !fn(i, v) {
+				return
+			}
+			i--
+		}
+		if n = n.prev; n != nil {
+			end = len(n.buf)
+		}
+	}
+}
+
+// Clone returns a copy of the list that shares no memory with it.
+func (l *Quicklist) Clone() *Quicklist {
+	c := &Quicklist{}
+	for n := l.head; n != nil; n = n.next {
+		c.insertNode(c.tail, &qlNode{buf: append([]byte(nil), n.buf...), count: n.count})
+	}
+	c.count = l.count
+	return c
+}
@@ -0,0 +1,233 @@
+package kvstore
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkQuicklist verifies the list against want and its internal invariants.
+func checkQuicklist(t *testing.T, l *Quicklist, want [][]byte) {
+	t.Helper()
+	if l.Len() != len(want) {
+		t.Fatalf("Len = %d; want %d", l.Len(), len(want))
+	}
+
+	count, nodes := 0, 0
+	var prev *qlNode
+	for n := l.head; n != nil; prev, n = n, n.next {
+		if n.prev != prev {
+			t.Fatalf("node %d has a broken prev link", nodes)
+		}
+		if n.count == 0 {
+			t.Fatalf("node %d is empty", nodes)
+		}
+		if n.count > 1 && len(n.buf) > maxNodeBytes {
+			t.Fatalf("node %d holds %d bytes; want at most %d", nodes, len(n.buf), maxNodeBytes)
+		}
+		count += n.count
+		nodes++
+	}
+	if l.tail != prev || count != l.count || nodes != l.nodes {
+		t.Fatalf("list has %d entries in %d nodes; counters say %d in %d", count, nodes, l.count, l.nodes)
+	}
+
+	var got [][]byte
+	l.Iter(0, false, func(i int, v []byte) bool {
+		if i != len(got) {
+			t.Fatalf("Iter passed index %d; want %d", i, len(got))
+		}
+		got = append(got, append([]byte(nil), v...))
+		return true
+	})
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("entry %d = %q; want %q", i, got[i], want[i])
+		}
+	}
+
+	i := len(want) - 1
+	l.Iter(len(want)-1, true, func(j int, v []byte) bool {
+		if j != i || !bytes.Equal(v, want[i]) {
+			t.Fatalf("reverse Iter entry %d = %q; want %d: %q", j, v, i, want[i])
+		}
+		i--
+		return true
+	})
+	if i != -1 {
+		t.Fatalf("reverse Iter stopped at %d", i)
+	}
+}
+
+func TestQuicklist_PushPop(t *testing.T) {
+	l := NewQuicklist()
+	var want [][]byte
+	for i := 0; i < 1000; i++ {
+		v := []byte("value:" + strconv.Itoa(i))
+		if i%2 == 0 {
+			l.PushBack(v)
+			want = append(want, v)
+		} else {
+			l.PushFront(v)
+			want = append([][]byte{v}, want...)
+		}
+	}
+	checkQuicklist(t, l, want)
+	if l.Nodes() < 2 {
+		t.Errorf("1000 entries packed into %d node; want several", l.Nodes())
+	}
+
+	for i := 0; i < 500; i++ {
+		v, ok := l.PopFront()
+		if !ok || !bytes.Equal(v, want[0]) {
+			t.Fatalf("PopFront = %q, %v; want %q", v, ok, want[0])
+		}
+		want = want[1:]
+		v, ok = l.PopBack()
+		if !ok || !bytes.Equal(v, want[len(want)-1]) {
+			t.Fatalf("PopBack = %q, %v; want %q", v, ok, want[len(want)-1])
+		}
+		want = want[:len(want)-1]
+	}
+	checkQuicklist(t, l, want)
+	if _, ok := l.PopFront(); ok {
+		t.Errorf("PopFront on an empty list succeeded")
+	}
+	if l.Nodes() != 0 {
+		t.Errorf("empty list has %d nodes", l.Nodes())
+	}
+}
+
+// Random operations must keep the list equal to a plain slice of entries.
+func TestQuicklist_RandomOps(t *testing.T) {
+	l := NewQuicklist()
+	var want [][]byte
+	value := func() []byte {
+		// Mostly small entries, some large ones to force splits and
+		// oversized nodes.
+		n := rand.IntN(40)
+		if rand.IntN(50) == 0 {
+			n = rand.IntN(3 * maxNodeBytes)
+		}
+		return []byte(strings.Repeat(strconv.Itoa(rand.IntN(10)), n))
+	}
+
+	for step := 0; step < 20000; step++ {
+		switch op := rand.IntN(10); {
+		case op < 2:
+			v := value()
+			l.PushBack(v)
+			want = append(want, v)
+		case op < 3:
+			v := value()
+			l.PushFront(v)
+			want = append([][]byte{v}, want...)
+		case op < 5:
+			i := rand.IntN(len(want) + 1)
+			v := value()
+			l.Insert(i, v)
+			want = append(want[:i], append([][]byte{v}, want[i:]...)...)
+		case op < 6 && len(want) > 0:
+			i := rand.IntN(len(want))
+			v := value()
+			l.Set(i, v)
+			want[i] = v
+		case op < 8 && len(want) > 0:
+			i, n := rand.IntN(len(want)), rand.IntN(20)
+			l.Delete(i, n)
+			want = append(want[:i], want[min(i+n, len(want)):]...)
+		case op < 9 && len(want) > 0:
+			i := rand.IntN(len(want))
+			if v, ok := l.Index(i); !ok || !bytes.Equal(v, want[i]) {
+				t.Fatalf("Index(%d) = %q, %v; want %q", i, v, ok, want[i])
+			}
+		case len(want) > 0:
+			if v, ok := l.PopBack(); !ok || !bytes.Equal(v, want[len(want)-1]) {
+				t.Fatalf("PopBack = %q, %v; want %q", v, ok, want[len(want)-1])
+			}
+			want = want[:len(want)-1]
+		}
+		if step%1000 == 0 {
+			checkQuicklist(t, l, want)
+		}
+	}
+	checkQuicklist(t, l, want)
+
+	// A clone is equal but independent.
+	c := l.Clone()
+	checkQuicklist(t, c, want)
+	c.PushBack([]byte("extra"))
+	c.Delete(0, c.Len()/2)
+	checkQuicklist(t, l, want)
+}
+
+func TestQuicklist_Remove(t *testing.T) {
+	// remove deletes from want what Remove(v, count) should.
+	remove := func(want [][]byte, v []byte, count int) ([][]byte, int) {
+		var kept [][]byte
+		removed := 0
+		for i := range want {
+			j := i
+			if count < 0 {
+				j = len(want) - 1 - i
+			}
+			if bytes.Equal(want[j], v) && (count == 0 || removed < max(count, -count)) {
+				removed++
+				continue
+			}
+			kept = append(kept, want[j])
+		}
+		if count < 0 {
+			slices.Reverse(kept)
+		}
+		return kept, removed
+	}
+
+	for _, count := range []int{0, 1, 7, 5000, -1, -7, -5000} {
+		l := NewQuicklist()
+		var want [][]byte
+		for i := 0; i < 3000; i++ {
+			// Runs of matches span whole nodes, and single ones sit
+			// between other entries.
+			v := []byte("other:" + strconv.Itoa(i))
+			if i%3 == 0 || (i >= 1000 && i < 2000) {
+				v = []byte("match")
+			}
+			l.PushBack(v)
+			want = append(want, v)
+		}
+
+		want, n := remove(want, []byte("match"), count)
+		if got := l.Remove([]byte("match"), count); got != n {
+			t.Errorf("Remove(match, %d) = %d; want %d", count, got, n)
+		}
+		checkQuicklist(t, l, want)
+	}
+
+	l := NewQuicklist()
+	l.PushBack([]byte("a"))
+	if got := l.Remove([]byte("b"), 0); got != 0 {
+		t.Errorf("Remove of a missing entry = %d; want 0", got)
+	}
+	if got := l.Remove([]byte("a"), -1); got != 1 || l.Len() != 0 || l.Nodes() != 0 {
+		t.Errorf("Remove of the only entry = %d, leaving %d entries in %d nodes", got, l.Len(), l.Nodes())
+	}
+}
+
+func TestQuicklist_Returned(t *testing.T) {
+	l := NewQuicklist()
+	v := []byte("abc")
+	l.PushBack(v)
+	v[0] = 'x'
+	got, _ := l.Index(0)
+	if string(got) != "abc" {
+		t.Fatalf("Index after modifying the pushed slice = %q; want abc", got)
+	}
+	got[1] = 'y'
+	if again, _ := l.Index(0); string(again) != "abc" {
+		t.Errorf("Index after modifying a returned slice = %q; want abc", again)
+	}
+}
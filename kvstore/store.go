@@ -0,0 +1,262 @@
+package kvstore
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"sync"
+)
+
+// MaxShards is the largest number of shards a Store can have.
+const MaxShards = 64
+
+// Store is a concurrency-safe keyspace split into shards, each a Table of
+// string keys guarded by its own lock. A key's shard is chosen by the high
+// bits of its hash (the tables use the low bits to pick buckets), so
+// commands on keys in different shards do not contend.
+//
+// Operations on several keys lock every shard involved, always in ascending
+// shard order, so they are atomic and cannot deadlock with each other.
+type Store[V any] struct {
+	shards []shard[V]
+	shift  uint // Shifts a hash code down to its shard index
+	hash   func(key string) uint64
+}
+
+type shard[V any] struct {
+	mu    sync.RWMutex
+	table *Table[string, V]
+}
+
+// NewStore returns an empty store with the given number of shards, which
+// must be a power of two no larger than MaxShards. Every shard is a table
+// configured by opts; the initial capacity applies per shard.
+func NewStore[V any](shards int, hash func(key string) uint64, opts ...Options) *Store[V] {
+	if shards < 1 || shards > MaxShards || shards&(shards-1) != 0 {
+		panic("kvstore: shard count must be a power of two between 1 and 64")
+	}
+	s := &Store[V]{
+		shards: make([]shard[V], shards),
+		shift:  uint(64 - bits.TrailingZeros(uint(shards))),
+		hash:   hash,
+	}
+	for i := range s.shards {
+		s.shards[i].table = NewTable[string, V](hash, opts...)
+	}
+	return s
+}
+
+// Shards returns the number of shards.
+func (s *Store[V]) Shards() int {
+	return len(s.shards)
+}
+
+func (s *Store[V]) shardIndex(key string) int {
+	// With a single shard the shift is 64, which yields 0.
+	return int(s.hash(key) >> s.shift)
+}
+
+// Tx gives access to the keys whose shards were locked by Lock. It is only
+// valid until Unlock, and only for those keys.
+type Tx[V any] struct {
+	s      *Store[V]
+	locked uint64 // Bit i is set if shard i is locked
+}
+
+// Lock locks the shards of keys, in ascending order, and returns a Tx for
+// operating on those keys atomically. Callers must call Unlock when done and
+// must not call Lock again before that.
+func (s *Store[V]) Lock(keys ...string) Tx[V] {
+	tx := Tx[V]{s: s}
+	for _, key := range keys {
+		tx.locked |= 1 << s.shardIndex(key)
+	}
+	for set := tx.locked; set != 0; set &= set - 1 {
+		s.shards[bits.TrailingZeros64(set)].mu.Lock()
+	}
+	return tx
+}
+
+// Unlock releases the shards locked by Lock.
+func (tx Tx[V]) Unlock() {
+	for set := tx.locked; set != 0; set &= set - 1 {
+		tx.s.shards[bits.TrailingZeros64(set)].mu.Unlock()
+	}
+}
+
+// table returns the table holding key, which must have been locked.
+func (tx Tx[V]) table(key string) *Table[string, V] {
+	i := tx.s.shardIndex(key)
+	if tx.locked&(1<<i) == 0 {
+		panic("kvstore: key " + key + " used without locking its shard")
+	}
+	return tx.s.shards[i].table
+}
+
+// The methods of Tx are those of Table, applied to the key's shard.
+
+func (tx Tx[V]) Get(key string) (V, bool)            { return tx.table(key).Get(key) }
+func (tx Tx[V]) Peek(key string) (V, bool)           { return tx.table(key).Peek(key) }
+func (tx Tx[V]) Insert(key string, value V)          { tx.table(key).Insert(key, value) }
+func (tx Tx[V]) Update(key string, value V) bool     { return tx.table(key).Update(key, value) }
+func (tx Tx[V]) Delete(key string) bool              { return tx.table(key).Delete(key) }
+func (tx Tx[V]) SetExpire(key string, at int64) bool { return tx.table(key).SetExpire(key, at) }
+func (tx Tx[V]) Persist(key string) bool             { return tx.table(key).Persist(key) }
+
+func (tx Tx[V]) ExpireAt(key string) (at int64, ok bool) {
+	return tx.table(key).ExpireAt(key)
+}
+
+func (tx Tx[V]) Access(key string) (idle int64, freq uint8, ok bool) {
+	return tx.table(key).Access(key)
+}
+
+// Get returns the value stored under key.
+func (s *Store[V]) Get(key string) (V, bool) {
+	tx := s.Lock(key)
+	defer tx.Unlock()
+	return tx.Get(key)
+}
+
+// Insert stores value under key, replacing any previous value and expiry.
+func (s *Store[V]) Insert(key string, value V) {
+	tx := s.Lock(key)
+	defer tx.Unlock()
+	tx.Insert(key, value)
+}
+
+// Delete removes key and reports whether it existed.
+func (s *Store[V]) Delete(key string) bool {
+	tx := s.Lock(key)
+	defer tx.Unlock()
+	return tx.Delete(key)
+}
+
+// Len returns the number of keys, including expired keys not removed yet.
+// Shards are counted one at a time, so concurrent writes may or may not be
+// included.
+func (s *Store[V]) Len() int {
+	total := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		total += sh.table.Len()
+		sh.mu.RUnlock()
+	}
+	return total
+}
+
+// Clear removes every key, holding all shard locks so no write interleaves.
+func (s *Store[V]) Clear() {
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+	}
+	for i := range s.shards {
+		s.shards[i].table.Clear()
+	}
+	for i := range s.shards {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+// RandomKey returns a key picked at random, or false if the store is empty.
+// A shard is picked with probability proportional to its size, so every key
+// is about equally likely.
+func (s *Store[V]) RandomKey() (string, bool) {
+	sizes := make([]int, len(s.shards))
+	for {
+		total := 0
+		for i := range s.shards {
+			sh := &s.shards[i]
+			sh.mu.RLock()
+			sizes[i] = sh.table.Len()
+			sh.mu.RUnlock()
+			total += sizes[i]
+		}
+		if total == 0 {
+			return "", false
+		}
+
+		n := rand.IntN(total)
+		i := 0
+		for n >= sizes[i] {
+			n -= sizes[i]
+			i++
+		}
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		key, ok := sh.table.RandomKey()
+		sh.mu.Unlock()
+		if ok {
+			return key, true
+		}
+		// The shard emptied in the meantime, or only held expired keys.
+	}
+}
+
+// ForEach calls fn for every live key until fn returns false. Each shard is
+// read-locked while it is visited; fn must not use the store.
+func (s *Store[V]) ForEach(fn func(key string, value V) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		more := true
+		sh.table.ForEach(func(key string, value V) bool {
+			more = fn(key, value)
+			return more
+		})
+		sh.mu.RUnlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// Scan is Table.Scan over the whole store: it calls fn for the keys of one
+// bucket and returns the next cursor, 0 when done. The low bits of the
+// cursor select the shard and the rest is that shard's table cursor, so the
+// guarantees of Table.Scan carry over. fn must not use the store.
+func (s *Store[V]) Scan(cursor uint64, fn func(key string, value V)) uint64 {
+	shardBits := uint(bits.TrailingZeros(uint(len(s.shards))))
+	i := int(cursor & uint64(len(s.shards)-1))
+	sh := &s.shards[i]
+	sh.mu.RLock()
+	next := sh.table.Scan(cursor>>shardBits, fn)
+	sh.mu.RUnlock()
+
+	if next == 0 {
+		i++
+		if i == len(s.shards) {
+			return 0
+		}
+	}
+	return next<<shardBits | uint64(i)
+}
+
+// ActiveExpire runs Table.ActiveExpire on every shard, locking one at a
+// time, and returns the totals.
+func (s *Store[V]) ActiveExpire(maxSample int) (sampled, expired int) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		n, e := sh.table.ActiveExpire(maxSample)
+		sh.mu.Unlock()
+		sampled += n
+		expired += e
+	}
+	return sampled, expired
+}
+
+// Rehash moves up to n buckets in every shard that is rehashing and reports
+// whether any shard still is.
+func (s *Store[V]) Rehash(n int) bool {
+	more := false
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		if sh.table.Rehash(n) {
+			more = true
+		}
+		sh.mu.Unlock()
+	}
+	return more
+}
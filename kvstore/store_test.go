@@ -0,0 +1,189 @@
+package kvstore
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestStore_Sharding(t *testing.T) {
+	s := NewStore[int](16, SeededHash)
+	for i := 0; i < 10000; i++ {
+		s.Insert("key:"+strconv.Itoa(i), i)
+	}
+	if s.Len() != 10000 {
+		t.Fatalf("Len = %d; want 10000", s.Len())
+	}
+	// Seeded hashing spreads the keys about evenly over the shards.
+	for i := range s.shards {
+		if n := s.shards[i].table.Len(); n < 10000/16/2 || n > 10000/16*2 {
+			t.Errorf("shard %d holds %d keys; want about %d", i, n, 10000/16)
+		}
+	}
+	for i := 0; i < 10000; i++ {
+		if v, ok := s.Get("key:" + strconv.Itoa(i)); !ok || v != i {
+			t.Fatalf("Get(key:%d) = %d, %v; want %d, true", i, v, ok, i)
+		}
+	}
+
+	for i := 0; i < 10000; i += 2 {
+		if !s.Delete("key:" + strconv.Itoa(i)) {
+			t.Fatalf("Delete(key:%d) = false; want true", i)
+		}
+	}
+	if s.Len() != 5000 {
+		t.Errorf("Len after deletes = %d; want 5000", s.Len())
+	}
+	if key, ok := s.RandomKey(); !ok || key[len(key)-1]%2 == 0 {
+		t.Errorf("RandomKey = %q, %v; want an odd key", key, ok)
+	}
+
+	s.Clear()
+	if s.Len() != 0 {
+		t.Errorf("Len after Clear = %d; want 0", s.Len())
+	}
+	if _, ok := s.RandomKey(); ok {
+		t.Errorf("RandomKey on an empty store returned a key")
+	}
+}
+
+func TestStore_ShardCount(t *testing.T) {
+	for _, n := range []int{0, 3, 65, 128} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewStore(%d) did not panic", n)
+				}
+			}()
+			NewStore[int](n, SeededHash)
+		}()
+	}
+
+	// A single shard behaves like a plain table.
+	s := NewStore[int](1, SeededHash)
+	s.Insert("a", 1)
+	if v, ok := s.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %d, %v; want 1, true", v, ok)
+	}
+}
+
+func TestStore_TxRequiresLock(t *testing.T) {
+	s := NewStore[int](64, SeededHash)
+	// Find a key in a different shard than "a".
+	other := "b"
+	for i := 0; s.shardIndex(other) == s.shardIndex("a"); i++ {
+		other = "b" + strconv.Itoa(i)
+	}
+
+	tx := s.Lock("a")
+	defer tx.Unlock()
+	tx.Insert("a", 1)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("using a key whose shard is not locked did not panic")
+		}
+	}()
+	tx.Get(other)
+}
+
+// Transfers between random pairs of keys, locked in either order, must
+// neither deadlock nor lose updates.
+func TestStore_MultiKeyLock(t *testing.T) {
+	const accounts, workers, transfers = 50, 8, 2000
+	s := NewStore[int](16, SeededHash)
+	for i := 0; i < accounts; i++ {
+		s.Insert(strconv.Itoa(i), 100)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < transfers; i++ {
+				from, to := strconv.Itoa(rand.IntN(accounts)), strconv.Itoa(rand.IntN(accounts))
+				tx := s.Lock(from, to)
+				a, _ := tx.Get(from)
+				tx.Update(from, a-1)
+				b, _ := tx.Get(to)
+				tx.Update(to, b+1)
+				tx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	s.ForEach(func(key string, value int) bool {
+		total += value
+		return true
+	})
+	if total != accounts*100 {
+		t.Errorf("total after transfers = %d; want %d", total, accounts*100)
+	}
+}
+
+func TestStore_ScanAcrossShards(t *testing.T) {
+	s := NewStore[int](8, SeededHash)
+	for i := 0; i < 1000; i++ {
+		s.Insert("key:"+strconv.Itoa(i), i)
+	}
+
+	// Keys added while scanning make the shards grow; the original keys must
+	// still all be returned.
+	seen := make(map[string]bool)
+	cursor, extra := uint64(0), 0
+	for {
+		cursor = s.Scan(cursor, func(key string, value int) {
+			seen[key] = true
+		})
+		if cursor == 0 {
+			break
+		}
+		if extra < 3000 {
+			for j := 0; j < 10; j++ {
+				s.Insert("extra:"+strconv.Itoa(extra), extra)
+				extra++
+			}
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if !seen["key:"+strconv.Itoa(i)] {
+			t.Fatalf("Scan missed key:%d", i)
+		}
+	}
+}
+
+// Mixed reads and writes from GOMAXPROCS goroutines. Compare the shard counts
+// with different -cpu values, e.g. go test -bench Store -cpu 1,2,4,8: with a
+// single shard every operation contends for one lock, so throughput stays
+// flat as goroutines are added.
+func BenchmarkStore_Parallel(b *testing.B) {
+	keys := make([]string, 100000)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+	}
+	for _, shards := range []int{1, 16, 64} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			s := NewStore[int](shards, SeededHash)
+			for i, key := range keys {
+				s.Insert(key, i)
+			}
+			for s.Rehash(100) {
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.IntN(len(keys))
+				for pb.Next() {
+					i = (i + 1) % len(keys)
+					if i%10 == 0 {
+						s.Insert(keys[i], i)
+					} else {
+						s.Get(keys[i])
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// ErrProtocol is returned (wrapped) when the input stream is not valid RESP.
+// The connection should be closed after reporting it, since the reader can no
+// longer be trusted to be positioned at a message boundary.
+var ErrProtocol = errors.New("Protocol error")
+
+// ErrTooLarge is returned (wrapped) when a message exceeds one of the
+// configured Limits.
+var ErrTooLarge = errors.New("Protocol error: too big")
+
+// Limits bounds the resources a single message may consume while it is being
+// decoded. A zero field means "no limit".
+type Limits struct {
+	MaxBulkLength  int64 // Largest accepted bulk string payload, in bytes
+	MaxArrayLength int64 // Largest accepted aggregate element count
+	MaxDepth       int   // Deepest accepted aggregate nesting
+	MaxLineLength  int   // Longest accepted type/length/simple line, in bytes
+}
+
+// DefaultLimits mirrors the defaults of a stock Redis server.
+var DefaultLimits = Limits{
+	MaxBulkLength:  512 * 1024 * 1024,
+	MaxArrayLength: 1024 * 1024,
+	MaxDepth:       128,
+	MaxLineLength:  64 * 1024,
+}
+
+// Bulk payloads above this size are read incrementally instead of being
+// allocated up front, so a peer cannot make us reserve memory it never sends.
+const bulkPreallocLimit = 64 * 1024
+
+// Deserialize reads exactly one RESP value from r using DefaultLimits.
+func Deserialize(r *bufio.Reader) (Value, error) {
+	return DeserializeWithLimits(r, DefaultLimits)
+}
+
+// DeserializeWithLimits reads exactly one RESP value from r, rejecting
+// messages that exceed limits. A clean end of stream before the first byte is
+// reported as io.EOF; a stream that ends mid-message as io.ErrUnexpectedEOF.
+func DeserializeWithLimits(r *bufio.Reader, limits Limits) (Value, error) {
+	d := decoder{r: r, limits: limits}
+	typ, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	return d.decode(typ, 0)
+}
+
+type decoder struct {
+	r      *bufio.Reader
+	limits Limits
+}
+
+func (d *decoder) decode(typ byte, depth int) (Value, error) {
+	switch typ {
+	case '+':
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		return SimpleString{Value: string(line)}, nil
+	case '-':
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		return Error{Value: string(line)}, nil
+	case ':':
+		n, err := d.readInteger()
+		if err != nil {
+			return nil, err
+		}
+		return Integer{Value: n}, nil
+	case '$':
+		return d.decodeBulkString()
+	case '*':
+		return d.decodeArray(depth)
+	case '_':
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) != 0 {
+			return nil, fmt.Errorf("%w: invalid null", ErrProtocol)
+		}
+		return Null{}, nil
+	case '#':
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		switch string(line) {
+		case "t":
+			return Boolean{Value: true}, nil
+		case "f":
+			return Boolean{Value: false}, nil
+		}
+		return nil, fmt.Errorf("%w: invalid boolean %q", ErrProtocol, line)
+	case ',':
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		f, err := strconv.ParseFloat(string(line), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid double %q", ErrProtocol, line)
+		}
+		return Double{Value: f}, nil
+	case '(':
+		line, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		n, ok := new(big.Int).SetString(string(line), 10)
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid big number %q", ErrProtocol, line)
+		}
+		return BigNumber{Value: n}, nil
+	case '!':
+		payload, err := d.readBlob("blob error")
+		if err != nil {
+			return nil, err
+		}
+		return BlobError{Value: string(payload)}, nil
+	case '=':
+		payload, err := d.readBlob("verbatim string")
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) < 4 || payload[3] != ':' {
+			return nil, fmt.Errorf("%w: invalid verbatim string", ErrProtocol)
+		}
+		return VerbatimString{Format: string(payload[:3]), Value: string(payload[4:])}, nil
+	case '%':
+		entries, err := d.decodeEntries(depth)
+		if err != nil {
+			return nil, err
+		}
+		return Map{Entries: entries}, nil
+	case '~':
+		values, err := d.decodeAggregate("set", depth)
+		if err != nil {
+			return nil, err
+		}
+		return Set{Values: values}, nil
+	case '>':
+		values, err := d.decodeAggregate("push", depth)
+		if err != nil {
+			return nil, err
+		}
+		return Push{Values: values}, nil
+	case '|':
+		entries, err := d.decodeEntries(depth)
+		if err != nil {
+			return nil, err
+		}
+		// The attribute describes the reply that immediately follows it,
+		// which counts as nested in it. Attributes cannot be chained: the
+		// decoder would otherwise recurse once per attribute without bound
+		// when depth is not limited.
+		typ, err := d.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if typ == '|' {
+			return nil, fmt.Errorf("%w: attribute followed by another attribute", ErrProtocol)
+		}
+		v, err := d.decode(typ, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return Attribute{Entries: entries, Value: v}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type byte %q", ErrProtocol, typ)
+	}
+}
+
+func (d *decoder) decodeBulkString() (Value, error) {
+	n, err := d.readLength("bulk", d.limits.MaxBulkLength)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return BulkString{IsNull: true}, nil
+	}
+	payload, err := d.readPayload(n)
+	if err != nil {
+		return nil, err
+	}
+	return BulkString{Value: payload}, nil
+}
+
+func (d *decoder) decodeArray(depth int) (Value, error) {
+	n, err := d.readLength("multibulk", d.limits.MaxArrayLength)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return Array{IsNull: true}, nil
+	}
+	values, err := d.decodeElements(n, depth)
+	if err != nil {
+		return nil, err
+	}
+	return Array{Values: values}, nil
+}
+
+// readBlob reads a length-prefixed, non-nullable payload.
+func (d *decoder) readBlob(kind string) ([]byte, error) {
+	n, err := d.readLength(kind, d.limits.MaxBulkLength)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("%w: invalid %s length", ErrProtocol, kind)
+	}
+	return d.readPayload(n)
+}
+
+// decodeAggregate reads a non-nullable aggregate such as a set or push.
+func (d *decoder) decodeAggregate(kind string, depth int) ([]Value, error) {
+	n, err := d.readLength(kind, d.limits.MaxArrayLength)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("%w: invalid %s length", ErrProtocol, kind)
+	}
+	return d.decodeElements(n, depth)
+}
+
+// decodeEntries reads the key/value pairs of a map or attribute. The element
+// limit applies to the total number of keys and values.
+func (d *decoder) decodeEntries(depth int) ([]MapEntry, error) {
+	n, err := d.readLength("map", 0)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("%w: invalid map length", ErrProtocol)
+	}
+	if n > math.MaxInt64/2 || d.limits.MaxArrayLength > 0 && n*2 > d.limits.MaxArrayLength {
+		return nil, fmt.Errorf("%w map length", ErrTooLarge)
+	}
+	values, err := d.decodeElements(n*2, depth)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]MapEntry, n)
+	for i := range entries {
+		entries[i] = MapEntry{Key: values[2*i], Value: values[2*i+1]}
+	}
+	return entries, nil
+}
+
+// decodeElements reads n nested values that belong to an aggregate found at
+// the given depth.
+func (d *decoder) decodeElements(n int64, depth int) ([]Value, error) {
+	if d.limits.MaxDepth > 0 && depth >= d.limits.MaxDepth {
+		return nil, fmt.Errorf("%w nesting depth", ErrTooLarge)
+	}
+	if n == 0 {
+		return []Value{}, nil
+	}
+
+	// Don't trust the declared count for the initial allocation.
+	values := make([]Value, 0, min(n, 1024))
+	for i := int64(0); i < n; i++ {
+		typ, err := d.r.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		v, err := d.decode(typ, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// readLine returns the next CRLF-terminated line without its terminator. The
+// returned slice is only valid until the next read from d.r.
+func (d *decoder) readLine() ([]byte, error) {
+	line, err := readLine(d.r, d.limits.MaxLineLength)
+	return line, unexpectedEOF(err)
+}
+
+func (d *decoder) readInteger() (int64, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid integer %q", ErrProtocol, line)
+	}
+	return n, nil
+}
+
+// readLength reads an aggregate or bulk length header. -1 denotes a null
+// value; anything lower is invalid.
+func (d *decoder) readLength(kind string, limit int64) (int64, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil || n < -1 {
+		return 0, fmt.Errorf("%w: invalid %s length", ErrProtocol, kind)
+	}
+	if limit > 0 && n > limit {
+		return 0, fmt.Errorf("%w %s length", ErrTooLarge, kind)
+	}
+	return n, nil
+}
+
+// readPayload reads n bytes followed by CRLF.
+func (d *decoder) readPayload(n int64) ([]byte, error) {
+	var payload []byte
+	if n <= bulkPreallocLimit {
+		payload = make([]byte, n)
+		if _, err := io.ReadFull(d.r, payload); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	} else {
+		var buf bytes.Buffer
+		buf.Grow(bulkPreallocLimit)
+		if _, err := io.CopyN(&buf, d.r, n); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		payload = buf.Bytes()
+	}
+
+	var term [2]byte
+	if _, err := io.ReadFull(d.r, term[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if term[0] != '\r' || term[1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk payload not terminated by CRLF", ErrProtocol)
+	}
+	return payload, nil
+}
+
+// readLine reads a CRLF-terminated line of at most max bytes (0 means no
+// limit) and returns it without the terminator.
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		// The line is longer than the reader's buffer; keep collecting.
+		long := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			if max > 0 && len(long) > max {
+				return nil, fmt.Errorf("%w line", ErrTooLarge)
+			}
+			line, err = r.ReadSlice('\n')
+			long = append(long, line...)
+		}
+		line = long
+	}
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && len(line)-2 > max {
+		return nil, fmt.Errorf("%w line", ErrTooLarge)
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("%w: line not terminated by CRLF", ErrProtocol)
+	}
+	return line[:len(line)-2], nil
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF for reads that
+// happen after a message has started.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
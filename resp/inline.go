@@ -0,0 +1,177 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+)
+
+// ReadCommand reads the next client command from r. Commands normally arrive
+// as RESP arrays, but like Redis any input that does not start with '*' is
+// treated as an inline command: a single line of space-separated arguments,
+// terminated by CRLF or a bare LF, as typed into telnet or netcat. Inline
+// commands are returned as an Array of BulkStrings so callers can handle both
+// forms the same way. Blank inline lines are skipped.
+func ReadCommand(r *bufio.Reader, limits Limits) (Value, error) {
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if first[0] == '*' {
+			return DeserializeWithLimits(r, limits)
+		}
+
+		line, err := readInlineLine(r, limits.MaxLineLength)
+		if err != nil {
+			return nil, err
+		}
+		args, err := SplitArgs(line)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			values[i] = BulkString{Value: arg}
+		}
+		return Array{Values: values}, nil
+	}
+}
+
+// readInlineLine reads a line terminated by LF, with an optional CR before
+// it, and returns it without the terminator.
+func readInlineLine(r *bufio.Reader, max int) ([]byte, error) {
+	var long []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, unexpectedEOF(err)
+		}
+		if long != nil || err == bufio.ErrBufferFull {
+			long = append(long, chunk...)
+			chunk = long
+		}
+		if max > 0 && len(chunk) > max+2 {
+			return nil, fmt.Errorf("%w inline request", ErrTooLarge)
+		}
+		if err == nil {
+			chunk = chunk[:len(chunk)-1]
+			if n := len(chunk); n > 0 && chunk[n-1] == '\r' {
+				chunk = chunk[:n-1]
+			}
+			return chunk, nil
+		}
+	}
+}
+
+// SplitArgs splits an inline command line into arguments following the
+// rules of Redis' sdssplitargs: arguments are separated by whitespace,
+// "double quotes" support \n, \r, \t, \b, \a, \\, \" and \xHH escapes, and
+// 'single quotes' only support \'. A closing quote must be followed by
+// whitespace or the end of the line.
+func SplitArgs(line []byte) ([][]byte, error) {
+	var args [][]byte
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var (
+			current  = []byte{}
+			inDouble bool
+			inSingle bool
+			done     bool
+		)
+		for !done {
+			if i == len(line) {
+				if inDouble || inSingle {
+					return nil, errUnbalancedQuotes
+				}
+				break
+			}
+			ch := line[i]
+			switch {
+			case inDouble:
+				if ch == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					current = append(current, hexValue(line[i+2])<<4|hexValue(line[i+3]))
+					i += 3
+				} else if ch == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current = append(current, '\n')
+					case 'r':
+						current = append(current, '\r')
+					case 't':
+						current = append(current, '\t')
+					case 'b':
+						current = append(current, '\b')
+					case 'a':
+						current = append(current, '\a')
+					default:
+						current = append(current, line[i])
+					}
+				} else if ch == '"' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					current = append(current, ch)
+				}
+			case inSingle:
+				if ch == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					current = append(current, '\'')
+					i++
+				} else if ch == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errUnbalancedQuotes
+					}
+					done = true
+				} else {
+					current = append(current, ch)
+				}
+			default:
+				switch ch {
+				case ' ', '\n', '\r', '\t', 0:
+					done = true
+				case '"':
+					inDouble = true
+				case '\'':
+					inSingle = true
+				default:
+					current = append(current, ch)
+				}
+			}
+			i++
+		}
+		args = append(args, current)
+	}
+}
+
+var errUnbalancedQuotes = fmt.Errorf("%w: unbalanced quotes in request", ErrProtocol)
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == '\v' || ch == '\f'
+}
+
+func isHex(ch byte) bool {
+	return (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
+
+func hexValue(ch byte) byte {
+	switch {
+	case ch >= '0' && ch <= '9':
+		return ch - '0'
+	case ch >= 'a' && ch <= 'f':
+		return ch - 'a' + 10
+	}
+	return ch - 'A' + 10
+}
@@ -0,0 +1,529 @@
+package resp
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	valueType  = reflect.TypeOf((*Value)(nil)).Elem()
+	bigIntType = reflect.TypeOf(big.Int{})
+)
+
+// Marshal converts a Go value into a Value:
+//
+//   - nil pointers, interfaces, slices and maps become Null
+//   - strings and []byte become BulkStrings
+//   - bools become Booleans, floats become Doubles
+//   - integers become Integers (uint64 values beyond int64 become BigNumbers),
+//     and *big.Int becomes a BigNumber
+//   - slices and arrays become Arrays
+//   - maps become Maps, ordered by key
+//   - structs become Maps of field name to field value
+//
+// Values that already implement Value are returned as is. Struct fields are
+// named by their `resp:"name"` tag, falling back to the Go field name. A tag
+// of "-" skips the field and the "omitempty" option skips zero values.
+//
+// Maps are RESP3 types; when written to a RESP2 connection they are sent as
+// flat field/value arrays, which Unmarshal also accepts.
+func Marshal(v any) (Value, error) {
+	if v == nil {
+		return Null{}, nil
+	}
+	return marshalValue(reflect.ValueOf(v))
+}
+
+func marshalValue(rv reflect.Value) (Value, error) {
+	if rv.Type().Implements(valueType) {
+		if rv.Kind() == reflect.Interface && rv.IsNil() {
+			return Null{}, nil
+		}
+		return rv.Interface().(Value), nil
+	}
+	if rv.Type() == bigIntType {
+		n := rv.Interface().(big.Int)
+		return BigNumber{Value: &n}, nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return Null{}, nil
+		}
+		return marshalValue(rv.Elem())
+	case reflect.String:
+		return NewBulkString(rv.String()), nil
+	case reflect.Bool:
+		return Boolean{Value: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Integer{Value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return BigNumber{Value: new(big.Int).SetUint64(u)}, nil
+		}
+		return Integer{Value: int64(u)}, nil
+	case reflect.Float32, reflect.Float64:
+		return Double{Value: rv.Float()}, nil
+	case reflect.Slice:
+		if rv.IsNil() {
+			return Null{}, nil
+		}
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return BulkString{Value: append([]byte{}, rv.Bytes()...)}, nil
+		}
+		return marshalArray(rv)
+	case reflect.Array:
+		return marshalArray(rv)
+	case reflect.Map:
+		if rv.IsNil() {
+			return Null{}, nil
+		}
+		return marshalMap(rv)
+	case reflect.Struct:
+		return marshalStruct(rv)
+	}
+	return nil, fmt.Errorf("resp: cannot marshal Go value of type %s", rv.Type())
+}
+
+func marshalArray(rv reflect.Value) (Value, error) {
+	values := make([]Value, rv.Len())
+	for i := range values {
+		v, err := marshalValue(rv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return Array{Values: values}, nil
+}
+
+func marshalMap(rv reflect.Value) (Value, error) {
+	entries := make([]MapEntry, 0, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		key, err := marshalValue(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalValue(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, MapEntry{Key: key, Value: value})
+	}
+	// Go maps are unordered; sort so the same map always encodes the same way.
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key.String() < entries[j].Key.String()
+	})
+	return Map{Entries: entries}, nil
+}
+
+func marshalStruct(rv reflect.Value) (Value, error) {
+	fields := structFields(rv.Type())
+	entries := make([]MapEntry, 0, len(fields))
+	for _, f := range fields {
+		fv := rv.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		value, err := marshalValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.name, err)
+		}
+		entries = append(entries, MapEntry{Key: NewBulkString(f.name), Value: value})
+	}
+	return Map{Entries: entries}, nil
+}
+
+// Unmarshal stores the Go representation of v in the value pointed to by
+// dst, following the rules of Marshal in reverse. Conversions are lenient
+// where RESP2 forces a server to use a different type: numbers and booleans
+// may arrive as bulk strings, and maps and structs may arrive as flat arrays
+// of alternating fields and values. Null stores the zero value (nil for
+// pointers, slices and maps).
+//
+// Unmarshaling into a Value stores v unchanged; unmarshaling into an empty
+// interface stores string, int64, float64, bool, *big.Int, []any or
+// map[string]any. If v is an Error or BlobError reply, that reply is
+// returned as the error.
+func Unmarshal(v Value, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("resp: Unmarshal requires a non-nil pointer, got %T", dst)
+	}
+	return unmarshalValue(v, rv.Elem())
+}
+
+func unmarshalValue(v Value, rv reflect.Value) error {
+	switch src := v.(type) {
+	case Attribute:
+		return unmarshalValue(src.Value, rv)
+	case Error:
+		return src
+	case BlobError:
+		return src
+	}
+
+	if rv.Type() == valueType {
+		rv.Set(reflect.ValueOf(&v).Elem())
+		return nil
+	}
+	if isNull(v) {
+		rv.SetZero()
+		return nil
+	}
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return unmarshalValue(v, rv.Elem())
+	}
+	if rv.Type() == bigIntType {
+		n, ok := toBigInt(v)
+		if !ok {
+			return typeError(v, rv.Type())
+		}
+		rv.Set(reflect.ValueOf(*n))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return typeError(v, rv.Type())
+		}
+		natural, err := naturalValue(v)
+		if err != nil {
+			return err
+		}
+		if natural == nil {
+			rv.SetZero()
+		} else {
+			rv.Set(reflect.ValueOf(natural))
+		}
+		return nil
+	case reflect.String:
+		s, ok := toText(v)
+		if !ok {
+			return typeError(v, rv.Type())
+		}
+		rv.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, ok := toBool(v)
+		if !ok {
+			return typeError(v, rv.Type())
+		}
+		rv.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := toBigInt(v)
+		if !ok || !n.IsInt64() || rv.OverflowInt(n.Int64()) {
+			return typeError(v, rv.Type())
+		}
+		rv.SetInt(n.Int64())
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := toBigInt(v)
+		if !ok || !n.IsUint64() || rv.OverflowUint(n.Uint64()) {
+			return typeError(v, rv.Type())
+		}
+		rv.SetUint(n.Uint64())
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat(v)
+		if !ok || rv.OverflowFloat(f) {
+			return typeError(v, rv.Type())
+		}
+		rv.SetFloat(f)
+		return nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b, ok := toBytes(v)
+			if !ok {
+				return typeError(v, rv.Type())
+			}
+			rv.SetBytes(b)
+			return nil
+		}
+		elems, ok := elements(v)
+		if !ok {
+			return typeError(v, rv.Type())
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(elems), len(elems))
+		for i, e := range elems {
+			if err := unmarshalValue(e, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+		return nil
+	case reflect.Array:
+		elems, ok := elements(v)
+		if !ok || len(elems) != rv.Len() {
+			return typeError(v, rv.Type())
+		}
+		for i, e := range elems {
+			if err := unmarshalValue(e, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		entries, ok := toEntries(v)
+		if !ok {
+			return typeError(v, rv.Type())
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), len(entries))
+		for _, e := range entries {
+			key := reflect.New(rv.Type().Key()).Elem()
+			if err := unmarshalValue(e.Key, key); err != nil {
+				return err
+			}
+			value := reflect.New(rv.Type().Elem()).Elem()
+			if err := unmarshalValue(e.Value, value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		rv.Set(m)
+		return nil
+	case reflect.Struct:
+		entries, ok := toEntries(v)
+		if !ok {
+			return typeError(v, rv.Type())
+		}
+		fields := structFields(rv.Type())
+		for _, e := range entries {
+			name, ok := toText(e.Key)
+			if !ok {
+				return typeError(e.Key, reflect.TypeOf(""))
+			}
+			f, ok := lookupField(fields, name)
+			if !ok {
+				continue // Unknown fields are ignored
+			}
+			if err := unmarshalValue(e.Value, rv.Field(f.index)); err != nil {
+				return fmt.Errorf("field %s: %w", f.name, err)
+			}
+		}
+		return nil
+	}
+	return typeError(v, rv.Type())
+}
+
+// naturalValue converts v into the Go type used for empty interfaces.
+func naturalValue(v Value) (any, error) {
+	switch src := v.(type) {
+	case SimpleString:
+		return src.Value, nil
+	case BulkString:
+		if src.IsNull {
+			return nil, nil
+		}
+		return string(src.Value), nil
+	case VerbatimString:
+		return src.Value, nil
+	case Integer:
+		return src.Value, nil
+	case Double:
+		return src.Value, nil
+	case Boolean:
+		return src.Value, nil
+	case BigNumber:
+		return src.Value, nil
+	case Null:
+		return nil, nil
+	case Map:
+		m := make(map[string]any, len(src.Entries))
+		for _, e := range src.Entries {
+			value, err := naturalValue(e.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[e.Key.String()] = value
+		}
+		return m, nil
+	case Attribute:
+		return naturalValue(src.Value)
+	case Error:
+		return nil, src
+	case BlobError:
+		return nil, src
+	}
+	elems, ok := elements(v)
+	if !ok {
+		return nil, nil
+	}
+	out := make([]any, len(elems))
+	for i, e := range elems {
+		value, err := naturalValue(e)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = value
+	}
+	return out, nil
+}
+
+func isNull(v Value) bool {
+	switch v := v.(type) {
+	case Null:
+		return true
+	case BulkString:
+		return v.IsNull
+	case Array:
+		return v.IsNull
+	}
+	return v == nil
+}
+
+func toText(v Value) (string, bool) {
+	switch v := v.(type) {
+	case SimpleString:
+		return v.Value, true
+	case BulkString:
+		return string(v.Value), true
+	case VerbatimString:
+		return v.Value, true
+	case Integer:
+		return strconv.FormatInt(v.Value, 10), true
+	case Double:
+		return v.String(), true
+	case BigNumber:
+		return v.String(), true
+	}
+	return "", false
+}
+
+func toBytes(v Value) ([]byte, bool) {
+	if b, ok := v.(BulkString); ok {
+		return append([]byte{}, b.Value...), true
+	}
+	s, ok := toText(v)
+	return []byte(s), ok
+}
+
+func toBool(v Value) (bool, bool) {
+	switch v := v.(type) {
+	case Boolean:
+		return v.Value, true
+	case Integer:
+		return v.Value != 0, v.Value == 0 || v.Value == 1
+	}
+	if s, ok := toText(v); ok {
+		b, err := strconv.ParseBool(s)
+		return b, err == nil
+	}
+	return false, false
+}
+
+func toBigInt(v Value) (*big.Int, bool) {
+	switch v := v.(type) {
+	case Integer:
+		return big.NewInt(v.Value), true
+	case BigNumber:
+		return v.Value, v.Value != nil
+	case SimpleString, BulkString:
+		s, _ := toText(v)
+		return new(big.Int).SetString(s, 10)
+	}
+	return nil, false
+}
+
+func toFloat(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case Double:
+		return v.Value, true
+	case Integer:
+		return float64(v.Value), true
+	case SimpleString, BulkString:
+		s, _ := toText(v)
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func elements(v Value) ([]Value, bool) {
+	switch v := v.(type) {
+	case Array:
+		return v.Values, true
+	case Set:
+		return v.Values, true
+	case Push:
+		return v.Values, true
+	}
+	return nil, false
+}
+
+// toEntries returns the key/value pairs of a Map, or of a flat RESP2 array
+// of alternating keys and values.
+func toEntries(v Value) ([]MapEntry, bool) {
+	if m, ok := v.(Map); ok {
+		return m.Entries, true
+	}
+	arr, ok := v.(Array)
+	if !ok || len(arr.Values)%2 != 0 {
+		return nil, false
+	}
+	entries := make([]MapEntry, len(arr.Values)/2)
+	for i := range entries {
+		entries[i] = MapEntry{Key: arr.Values[2*i], Value: arr.Values[2*i+1]}
+	}
+	return entries, true
+}
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// structFields lists the exported, non-skipped fields of a struct type.
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("resp")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{name: name, index: i, omitEmpty: opts == "omitempty"})
+	}
+	return fields
+}
+
+// lookupField finds a field by exact name, falling back to a case-insensitive
+// match.
+func lookupField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+func typeError(v Value, t reflect.Type) error {
+	return fmt.Errorf("resp: cannot unmarshal %T into Go value of type %s", v, t)
+}
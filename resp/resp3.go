@@ -0,0 +1,408 @@
+package resp
+
+import (
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*Null Type (RESP3)*/
+type Null struct{}
+
+var nullBytes = []byte("_\r\n")
+
+func (n Null) Serialize() []byte {
+	return nullBytes
+}
+
+func (n Null) AppendTo(dst []byte) []byte {
+	return append(dst, nullBytes...)
+}
+
+func (n Null) WriteTo(w io.Writer) (int64, error) {
+	written, err := w.Write(nullBytes)
+	return int64(written), err
+}
+
+func (n Null) String() string {
+	return "(nil)"
+}
+
+/*Boolean Type (RESP3)*/
+type Boolean struct {
+	Value bool
+}
+
+var (
+	trueBytes  = []byte("#t\r\n")
+	falseBytes = []byte("#f\r\n")
+)
+
+func (b Boolean) Serialize() []byte {
+	if b.Value {
+		return trueBytes
+	}
+	return falseBytes
+}
+
+func (b Boolean) AppendTo(dst []byte) []byte {
+	return append(dst, b.Serialize()...)
+}
+
+func (b Boolean) WriteTo(w io.Writer) (int64, error) {
+	written, err := w.Write(b.Serialize())
+	return int64(written), err
+}
+
+func (b Boolean) String() string {
+	if b.Value {
+		return "(true)"
+	}
+	return "(false)"
+}
+
+/*Double Type (RESP3)*/
+type Double struct {
+	Value float64
+}
+
+func (d Double) Serialize() []byte {
+	return d.AppendTo(make([]byte, 0, 32))
+}
+
+func (d Double) AppendTo(dst []byte) []byte {
+	dst = append(dst, ',')
+	dst = appendFloat(dst, d.Value)
+	return append(dst, crlf...)
+}
+
+func (d Double) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, d)
+}
+
+func (d Double) String() string {
+	return string(appendFloat(nil, d.Value))
+}
+
+// appendFloat formats f the way RESP3 expects, spelling out infinities and
+// NaN instead of using Go's "+Inf"/"NaN".
+func appendFloat(buf []byte, f float64) []byte {
+	switch {
+	case math.IsInf(f, 1):
+		return append(buf, "inf"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-inf"...)
+	case math.IsNaN(f):
+		return append(buf, "nan"...)
+	}
+	return strconv.AppendFloat(buf, f, 'g', -1, 64)
+}
+
+/*Big Number Type (RESP3)*/
+type BigNumber struct {
+	Value *big.Int
+}
+
+func (n BigNumber) Serialize() []byte {
+	return n.AppendTo(make([]byte, 0, 32))
+}
+
+func (n BigNumber) AppendTo(dst []byte) []byte {
+	dst = append(dst, '(')
+	dst = n.Value.Append(dst, 10)
+	return append(dst, crlf...)
+}
+
+func (n BigNumber) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, n)
+}
+
+func (n BigNumber) String() string {
+	return n.Value.String()
+}
+
+/*Blob Error Type (RESP3)*/
+type BlobError struct {
+	Value string
+}
+
+func (e BlobError) Serialize() []byte {
+	return e.AppendTo(nil)
+}
+
+func (e BlobError) AppendTo(dst []byte) []byte {
+	return appendBlob(dst, '!', e.Value)
+}
+
+func (e BlobError) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, e)
+}
+
+func (e BlobError) String() string {
+	return e.Value
+}
+
+// Error makes an error reply usable as a Go error.
+func (e BlobError) Error() string {
+	return e.Value
+}
+
+/*Verbatim String Type (RESP3)*/
+type VerbatimString struct {
+	Format string // Three-character format hint, e.g. "txt" or "mkd"
+	Value  string
+}
+
+func (v VerbatimString) Serialize() []byte {
+	return v.AppendTo(nil)
+}
+
+// AppendTo appends =<length>\r\n<format>:<value>\r\n.
+func (v VerbatimString) AppendTo(dst []byte) []byte {
+	dst = append(dst, '=')
+	dst = strconv.AppendInt(dst, int64(len(v.Format)+1+len(v.Value)), 10)
+	dst = append(dst, crlf...)
+	dst = append(dst, v.Format...)
+	dst = append(dst, ':')
+	dst = append(dst, v.Value...)
+	return append(dst, crlf...)
+}
+
+func (v VerbatimString) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, v)
+}
+
+func (v VerbatimString) String() string {
+	return v.Value
+}
+
+// appendBlob appends a length-prefixed payload: <prefix><len>\r\n<data>\r\n
+func appendBlob[T string | []byte](dst []byte, prefix byte, data T) []byte {
+	dst = appendHeader(dst, prefix, len(data))
+	dst = append(dst, data...)
+	return append(dst, crlf...)
+}
+
+/*Map Type (RESP3)*/
+
+// MapEntry is a single key/value pair of a Map or Attribute. Entries are kept
+// in a slice rather than a Go map so that wire order is preserved and keys
+// may be any Value.
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+type Map struct {
+	Entries []MapEntry
+}
+
+func (m Map) Serialize() []byte {
+	return m.AppendTo(nil)
+}
+
+func (m Map) AppendTo(dst []byte) []byte {
+	return appendEntries(dst, '%', m.Entries)
+}
+
+func (m Map) WriteTo(w io.Writer) (int64, error) {
+	return writeEntries(w, '%', m.Entries)
+}
+
+func (m Map) String() string {
+	return entriesString(m.Entries)
+}
+
+/*Set Type (RESP3)*/
+type Set struct {
+	Values []Value
+}
+
+func (s Set) Serialize() []byte {
+	return s.AppendTo(nil)
+}
+
+func (s Set) AppendTo(dst []byte) []byte {
+	return appendValues(dst, '~', s.Values)
+}
+
+func (s Set) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeHeader(w, '~', len(s.Values))
+	if err != nil {
+		return n, err
+	}
+	return writeValues(w, n, s.Values)
+}
+
+func (s Set) String() string {
+	return "{" + valuesString(s.Values) + "}"
+}
+
+/*Attribute Type (RESP3)*/
+
+// Attribute carries out-of-band metadata about the reply that follows it.
+// The decoder attaches that reply as Value, so an Attribute always travels
+// together with the data it describes.
+type Attribute struct {
+	Entries []MapEntry
+	Value   Value
+}
+
+func (a Attribute) Serialize() []byte {
+	return a.AppendTo(nil)
+}
+
+func (a Attribute) AppendTo(dst []byte) []byte {
+	dst = appendEntries(dst, '|', a.Entries)
+	if a.Value != nil {
+		dst = a.Value.AppendTo(dst)
+	}
+	return dst
+}
+
+func (a Attribute) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeEntries(w, '|', a.Entries)
+	if err != nil || a.Value == nil {
+		return n, err
+	}
+	m, err := a.Value.WriteTo(w)
+	return n + m, err
+}
+
+func (a Attribute) String() string {
+	if a.Value == nil {
+		return entriesString(a.Entries)
+	}
+	return a.Value.String()
+}
+
+/*Push Type (RESP3)*/
+type Push struct {
+	Values []Value
+}
+
+func (p Push) Serialize() []byte {
+	return p.AppendTo(nil)
+}
+
+func (p Push) AppendTo(dst []byte) []byte {
+	return appendValues(dst, '>', p.Values)
+}
+
+func (p Push) WriteTo(w io.Writer) (int64, error) {
+	n, err := writeHeader(w, '>', len(p.Values))
+	if err != nil {
+		return n, err
+	}
+	return writeValues(w, n, p.Values)
+}
+
+func (p Push) String() string {
+	return "[" + valuesString(p.Values) + "]"
+}
+
+func appendValues(dst []byte, prefix byte, values []Value) []byte {
+	dst = appendHeader(dst, prefix, len(values))
+	for _, v := range values {
+		dst = v.AppendTo(dst)
+	}
+	return dst
+}
+
+func appendEntries(dst []byte, prefix byte, entries []MapEntry) []byte {
+	dst = appendHeader(dst, prefix, len(entries))
+	for _, e := range entries {
+		dst = e.Key.AppendTo(dst)
+		dst = e.Value.AppendTo(dst)
+	}
+	return dst
+}
+
+func writeEntries(w io.Writer, prefix byte, entries []MapEntry) (int64, error) {
+	written, err := writeHeader(w, prefix, len(entries))
+	if err != nil {
+		return written, err
+	}
+	for _, e := range entries {
+		n, err := e.Key.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		n, err = e.Value.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func valuesString(values []Value) string {
+	elements := make([]string, len(values))
+	for i, v := range values {
+		elements[i] = v.String()
+	}
+	return strings.Join(elements, ",")
+}
+
+func entriesString(entries []MapEntry) string {
+	elements := make([]string, len(entries))
+	for i, e := range entries {
+		elements[i] = e.Key.String() + ":" + e.Value.String()
+	}
+	return "{" + strings.Join(elements, ",") + "}"
+}
+
+// ToRESP2 rewrites v, recursively, using only RESP2 types so it can be sent to
+// a client that has not negotiated RESP3. Maps are flattened into arrays of
+// alternating keys and values, sets and pushes become arrays, doubles and big
+// numbers become bulk strings, booleans become 1/0 and Null becomes a null
+// bulk string. Attributes are dropped in favor of the value they describe.
+func ToRESP2(v Value) Value {
+	switch v := v.(type) {
+	case Null:
+		return BulkString{IsNull: true}
+	case Boolean:
+		if v.Value {
+			return Integer{Value: 1}
+		}
+		return Integer{Value: 0}
+	case Double:
+		return NewBulkString(v.String())
+	case BigNumber:
+		return NewBulkString(v.String())
+	case BlobError:
+		return Error{Value: strings.NewReplacer("\r", " ", "\n", " ").Replace(v.Value)}
+	case VerbatimString:
+		return NewBulkString(v.Value)
+	case Map:
+		values := make([]Value, 0, 2*len(v.Entries))
+		for _, e := range v.Entries {
+			values = append(values, ToRESP2(e.Key), ToRESP2(e.Value))
+		}
+		return Array{Values: values}
+	case Set:
+		return Array{Values: toRESP2Values(v.Values)}
+	case Push:
+		return Array{Values: toRESP2Values(v.Values)}
+	case Attribute:
+		return ToRESP2(v.Value)
+	case Array:
+		if v.IsNull {
+			return v
+		}
+		return Array{Values: toRESP2Values(v.Values)}
+	}
+	return v
+}
+
+func toRESP2Values(values []Value) []Value {
+	out := make([]Value, len(values))
+	for i, v := range values {
+		out[i] = ToRESP2(v)
+	}
+	return out
+}
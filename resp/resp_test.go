@@ -3,7 +3,12 @@ package resp
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/big"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -68,7 +73,7 @@ func TestInteger_String(t *testing.T) {
 }
 
 func TestBulkString_Serialize(t *testing.T) {
-	b := BulkString{Value: "hello", IsNull: false}
+	b := BulkString{Value: []byte("hello"), IsNull: false}
 	expected := []byte("$5\r\nhello\r\n")
 	result := b.Serialize()
 
@@ -86,7 +91,7 @@ func TestBulkString_Serialize(t *testing.T) {
 }
 
 func TestBulkString_String(t *testing.T) {
-	b := BulkString{Value: "hello", IsNull: false}
+	b := BulkString{Value: []byte("hello"), IsNull: false}
 	expected := "hello"
 	result := b.String()
 
@@ -107,7 +112,7 @@ func TestArray_Serialize(t *testing.T) {
 	a := Array{
 		Values: []Value{
 			Integer{Value: 1},
-			BulkString{Value: "two", IsNull: false},
+			BulkString{Value: []byte("two"), IsNull: false},
 			SimpleString{Value: "three"},
 		},
 		IsNull: false,
@@ -132,7 +137,7 @@ func TestArray_String(t *testing.T) {
 	a := Array{
 		Values: []Value{
 			Integer{Value: 1},
-			BulkString{Value: "two", IsNull: false},
+			BulkString{Value: []byte("two"), IsNull: false},
 			SimpleString{Value: "three"},
 		},
 		IsNull: false,
@@ -214,7 +219,7 @@ func TestDeserialize_Integer(t *testing.T) {
 func TestDeserialize_BulkString(t *testing.T) {
 	input := []byte("$5\r\nhello\r\n")
 	reader := bytes.NewReader(input)
-	expected := BulkString{Value: "hello"}
+	expected := BulkString{Value: []byte("hello")}
 
 	breader := bufio.NewReader(reader)
 	result, err := Deserialize(breader)
@@ -247,7 +252,7 @@ func TestDeserialize_Array(t *testing.T) {
 	expected := Array{
 		Values: []Value{
 			Integer{Value: 1},
-			BulkString{Value: "two"},
+			BulkString{Value: []byte("two")},
 			SimpleString{Value: "three"},
 		},
 	}
@@ -290,7 +295,7 @@ func TestDeserialize_InvalidType(t *testing.T) {
 func TestDeserialize_BulkString_Empty(t *testing.T) {
 	input := []byte("$0\r\n\r\n")
 	reader := bytes.NewReader(input)
-	expected := BulkString{Value: ""}
+	expected := BulkString{Value: []byte("")}
 
 	breader := bufio.NewReader(reader)
 	result, err := Deserialize(breader)
@@ -308,7 +313,7 @@ func TestDeserialize_Array_SingleBulkString(t *testing.T) {
 	reader := bytes.NewReader(input)
 	expected := Array{
 		Values: []Value{
-			BulkString{Value: "ping"},
+			BulkString{Value: []byte("ping")},
 		},
 	}
 
@@ -328,8 +333,8 @@ func TestDeserialize_Array_TwoBulkStrings(t *testing.T) {
 	reader := bytes.NewReader(input)
 	expected := Array{
 		Values: []Value{
-			BulkString{Value: "echo"},
-			BulkString{Value: "hello world"},
+			BulkString{Value: []byte("echo")},
+			BulkString{Value: []byte("hello world")},
 		},
 	}
 
@@ -349,8 +354,8 @@ func TestDeserialize_Array_GetKeyValue(t *testing.T) {
 	reader := bytes.NewReader(input)
 	expected := Array{
 		Values: []Value{
-			BulkString{Value: "get"},
-			BulkString{Value: "key"},
+			BulkString{Value: []byte("get")},
+			BulkString{Value: []byte("key")},
 		},
 	}
 
@@ -412,3 +417,624 @@ func TestDeserialize_BulkString_Null(t *testing.T) {
 		t.Errorf("Deserialize() = %v, want %v", result, expected)
 	}
 }
+
+func TestDeserialize_NestedArray(t *testing.T) {
+	input := []byte("*2\r\n*1\r\n:1\r\n*0\r\n")
+	expected := Array{
+		Values: []Value{
+			Array{Values: []Value{Integer{Value: 1}}},
+			Array{Values: []Value{}},
+		},
+	}
+
+	result, err := Deserialize(bufio.NewReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Deserialize() = %v, want %v", result, expected)
+	}
+}
+
+func TestDeserialize_LongLine(t *testing.T) {
+	// Longer than bufio's default buffer, but within the line limit.
+	long := bytes.Repeat([]byte("a"), 10000)
+	input := append(append([]byte("+"), long...), "\r\n"...)
+
+	result, err := Deserialize(bufio.NewReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+
+	if result.(SimpleString).Value != string(long) {
+		t.Errorf("Deserialize() returned %d bytes, want %d", len(result.String()), len(long))
+	}
+}
+
+func TestDeserialize_ProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"unknown type", "?oops\r\n"},
+		{"bare LF", "+OK\n"},
+		{"bad integer", ":12a\r\n"},
+		{"bad bulk length", "$abc\r\n"},
+		{"negative bulk length", "$-2\r\n"},
+		{"bulk missing CRLF", "$3\r\nfooXX"},
+		{"bad array length", "*x\r\n"},
+		{"bad element", "*1\r\n?\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Deserialize(bufio.NewReader(bytes.NewReader([]byte(tt.input))))
+			if !errors.Is(err, ErrProtocol) {
+				t.Errorf("Deserialize(%q) error = %v, want ErrProtocol", tt.input, err)
+			}
+		})
+	}
+}
+
+func TestDeserialize_Limits(t *testing.T) {
+	limits := Limits{MaxBulkLength: 4, MaxArrayLength: 2, MaxDepth: 2, MaxLineLength: 8}
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"bulk too long", "$5\r\nhello\r\n"},
+		{"array too long", "*3\r\n:1\r\n:2\r\n:3\r\n"},
+		{"too deep", "*1\r\n*1\r\n*1\r\n:1\r\n"},
+		{"line too long", "+123456789\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DeserializeWithLimits(bufio.NewReader(bytes.NewReader([]byte(tt.input))), limits)
+			if !errors.Is(err, ErrTooLarge) {
+				t.Errorf("DeserializeWithLimits(%q) error = %v, want ErrTooLarge", tt.input, err)
+			}
+		})
+	}
+
+	// Values right at the limits are accepted.
+	input := "*2\r\n*1\r\n$4\r\nabcd\r\n+1234\r\n"
+	if _, err := DeserializeWithLimits(bufio.NewReader(bytes.NewReader([]byte(input))), limits); err != nil {
+		t.Errorf("DeserializeWithLimits(%q) error = %v", input, err)
+	}
+
+	// A map counts both keys and values against the element limit, even when
+	// the limit is too small to hold a single entry or is turned off.
+	for _, tt := range []struct {
+		limits Limits
+		input  string
+	}{
+		{Limits{MaxArrayLength: 2}, "%2\r\n:1\r\n:2\r\n:3\r\n:4\r\n"},
+		{Limits{MaxArrayLength: 1}, "%1\r\n:1\r\n:2\r\n"},
+		{Limits{MaxArrayLength: 1}, "%9223372036854775807\r\n"},
+		{Limits{}, "%9223372036854775807\r\n"},
+	} {
+		_, err := DeserializeWithLimits(bufio.NewReader(bytes.NewReader([]byte(tt.input))), tt.limits)
+		if !errors.Is(err, ErrTooLarge) {
+			t.Errorf("DeserializeWithLimits(%q, %+v) error = %v, want ErrTooLarge", tt.input, tt.limits, err)
+		}
+	}
+}
+
+func TestDeserialize_EOF(t *testing.T) {
+	_, err := Deserialize(bufio.NewReader(bytes.NewReader(nil)))
+	if err != io.EOF {
+		t.Errorf("Deserialize() on empty input error = %v, want io.EOF", err)
+	}
+
+	_, err = Deserialize(bufio.NewReader(bytes.NewReader([]byte("*2\r\n:1\r\n"))))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Deserialize() on truncated input error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestRESP3_Serialize(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{"null", Null{}, "_\r\n"},
+		{"true", Boolean{Value: true}, "#t\r\n"},
+		{"false", Boolean{Value: false}, "#f\r\n"},
+		{"double", Double{Value: 3.25}, ",3.25\r\n"},
+		{"double inf", Double{Value: math.Inf(-1)}, ",-inf\r\n"},
+		{"big number", BigNumber{Value: mustBigInt("3492890328409238509324850943850943825024385")}, "(3492890328409238509324850943850943825024385\r\n"},
+		{"blob error", BlobError{Value: "SYNTAX invalid"}, "!14\r\nSYNTAX invalid\r\n"},
+		{"verbatim", VerbatimString{Format: "txt", Value: "Some string"}, "=15\r\ntxt:Some string\r\n"},
+		{"map", Map{Entries: []MapEntry{
+			{Key: SimpleString{Value: "first"}, Value: Integer{Value: 1}},
+			{Key: SimpleString{Value: "second"}, Value: Integer{Value: 2}},
+		}}, "%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n"},
+		{"set", Set{Values: []Value{Integer{Value: 1}, BulkString{Value: []byte("a")}}}, "~2\r\n:1\r\n$1\r\na\r\n"},
+		{"push", Push{Values: []Value{BulkString{Value: []byte("message")}}}, ">1\r\n$7\r\nmessage\r\n"},
+		{"attribute", Attribute{
+			Entries: []MapEntry{{Key: SimpleString{Value: "ttl"}, Value: Integer{Value: 3600}}},
+			Value:   Integer{Value: 7},
+		}, "|1\r\n+ttl\r\n:3600\r\n:7\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.value.Serialize()
+			if string(result) != tt.expected {
+				t.Errorf("Serialize() = %q, want %q", result, tt.expected)
+			}
+
+			// Every RESP3 value must survive a round trip through the decoder.
+			decoded, err := Deserialize(bufio.NewReader(bytes.NewReader(result)))
+			if err != nil {
+				t.Fatalf("Deserialize() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("Deserialize() = %#v, want %#v", decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestRESP3_String(t *testing.T) {
+	tests := []struct {
+		value    Value
+		expected string
+	}{
+		{Null{}, "(nil)"},
+		{Boolean{Value: true}, "(true)"},
+		{Double{Value: math.NaN()}, "nan"},
+		{VerbatimString{Format: "txt", Value: "hi"}, "hi"},
+		{Map{Entries: []MapEntry{{Key: SimpleString{Value: "a"}, Value: Integer{Value: 1}}}}, "{a:1}"},
+		{Set{Values: []Value{Integer{Value: 1}, Integer{Value: 2}}}, "{1,2}"},
+	}
+
+	for _, tt := range tests {
+		if result := tt.value.String(); result != tt.expected {
+			t.Errorf("%T.String() = %q, want %q", tt.value, result, tt.expected)
+		}
+	}
+}
+
+func TestDeserialize_RESP3Errors(t *testing.T) {
+	inputs := []string{
+		"_x\r\n",
+		"#x\r\n",
+		",abc\r\n",
+		"(12.5\r\n",
+		"=3\r\ntxt\r\n",
+		"%-1\r\n",
+		"~1\r\n",
+	}
+
+	for _, input := range inputs {
+		_, err := Deserialize(bufio.NewReader(bytes.NewReader([]byte(input))))
+		if err == nil {
+			t.Errorf("Deserialize(%q) should return an error", input)
+		}
+	}
+}
+
+// Chained attributes are rejected rather than decoded recursively, which
+// would overflow the stack with enough of them and no depth limit.
+func TestDeserialize_ChainedAttributes(t *testing.T) {
+	input := "*1\r\n" + strings.Repeat("|0\r\n", 1_000_000) + ":1\r\n"
+	for _, limits := range []Limits{DefaultLimits, {}} {
+		_, err := ReadCommand(bufio.NewReader(strings.NewReader(input)), limits)
+		if !errors.Is(err, ErrProtocol) {
+			t.Errorf("ReadCommand(chained attributes, %+v) error = %v, want ErrProtocol", limits, err)
+		}
+	}
+
+	// The reply an attribute describes is nested in it.
+	input = "|0\r\n*1\r\n:1\r\n"
+	_, err := DeserializeWithLimits(bufio.NewReader(strings.NewReader(input)), Limits{MaxDepth: 1})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("DeserializeWithLimits(%q) error = %v, want ErrTooLarge", input, err)
+	}
+}
+
+func mustBigInt(s string) *big.Int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big integer: " + s)
+	}
+	return n
+}
+
+func TestToRESP2(t *testing.T) {
+	input := Map{Entries: []MapEntry{
+		{Key: BulkString{Value: []byte("proto")}, Value: Integer{Value: 3}},
+		{Key: BulkString{Value: []byte("score")}, Value: Double{Value: 1.5}},
+		{Key: BulkString{Value: []byte("flags")}, Value: Set{Values: []Value{Boolean{Value: true}, Null{}}}},
+	}}
+	expected := Array{Values: []Value{
+		BulkString{Value: []byte("proto")}, Integer{Value: 3},
+		BulkString{Value: []byte("score")}, BulkString{Value: []byte("1.5")},
+		BulkString{Value: []byte("flags")}, Array{Values: []Value{Integer{Value: 1}, BulkString{IsNull: true}}},
+	}}
+
+	result := ToRESP2(input)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ToRESP2() = %#v, want %#v", result, expected)
+	}
+
+	// RESP2 values pass through untouched.
+	s := SimpleString{Value: "OK"}
+	if result := ToRESP2(s); !reflect.DeepEqual(result, s) {
+		t.Errorf("ToRESP2() = %#v, want %#v", result, s)
+	}
+}
+
+func TestReadCommand_Inline(t *testing.T) {
+	input := "PING\r\n\r\nSET key \"hello world\"\nECHO 'it\\'s' \"\\x41\\tB\"\r\n*1\r\n$4\r\nPING\r\n"
+	expected := []Value{
+		Array{Values: []Value{BulkString{Value: []byte("PING")}}},
+		Array{Values: []Value{BulkString{Value: []byte("SET")}, BulkString{Value: []byte("key")}, BulkString{Value: []byte("hello world")}}},
+		Array{Values: []Value{BulkString{Value: []byte("ECHO")}, BulkString{Value: []byte("it's")}, BulkString{Value: []byte("A\tB")}}},
+		Array{Values: []Value{BulkString{Value: []byte("PING")}}},
+	}
+
+	breader := bufio.NewReader(bytes.NewReader([]byte(input)))
+	for i, want := range expected {
+		result, err := ReadCommand(breader, DefaultLimits)
+		if err != nil {
+			t.Fatalf("ReadCommand() #%d error = %v", i, err)
+		}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("ReadCommand() #%d = %v, want %v", i, result, want)
+		}
+	}
+
+	if _, err := ReadCommand(breader, DefaultLimits); err != io.EOF {
+		t.Errorf("ReadCommand() at end of input error = %v, want io.EOF", err)
+	}
+}
+
+func TestReadCommand_InlineErrors(t *testing.T) {
+	for _, input := range []string{"SET key \"unterminated\r\n", "SET key \"a\"b\r\n", "GET 'x\r\n"} {
+		_, err := ReadCommand(bufio.NewReader(bytes.NewReader([]byte(input))), DefaultLimits)
+		if !errors.Is(err, ErrProtocol) {
+			t.Errorf("ReadCommand(%q) error = %v, want ErrProtocol", input, err)
+		}
+	}
+
+	limits := DefaultLimits
+	limits.MaxLineLength = 16
+	input := "ECHO " + string(bytes.Repeat([]byte("x"), 32)) + "\r\n"
+	_, err := ReadCommand(bufio.NewReader(bytes.NewReader([]byte(input))), limits)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("ReadCommand() on long inline request error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestAppendTo_MatchesSerialize(t *testing.T) {
+	values := []Value{
+		SimpleString{Value: "OK"},
+		Error{Value: "ERR boom"},
+		Integer{Value: -42},
+		BulkString{Value: []byte("hello")},
+		BulkString{IsNull: true},
+		Array{Values: []Value{Integer{Value: 1}, Array{Values: []Value{BulkString{Value: []byte("x")}}}}},
+		Array{IsNull: true},
+		Null{},
+		Boolean{Value: true},
+		Double{Value: 2.5},
+		BigNumber{Value: mustBigInt("123456789012345678901234567890")},
+		BlobError{Value: "ERR blob"},
+		VerbatimString{Format: "txt", Value: "verbatim"},
+		Map{Entries: []MapEntry{{Key: BulkString{Value: []byte("k")}, Value: Set{Values: []Value{Integer{Value: 1}}}}}},
+		Push{Values: []Value{BulkString{Value: []byte("message")}}},
+		Attribute{Entries: []MapEntry{{Key: SimpleString{Value: "a"}, Value: Integer{Value: 1}}}, Value: Integer{Value: 2}},
+	}
+
+	for _, v := range values {
+		expected := v.Serialize()
+
+		prefix := []byte("prefix")
+		if result := v.AppendTo(prefix); !bytes.Equal(result, append([]byte("prefix"), expected...)) {
+			t.Errorf("%T.AppendTo() = %q, want %q", v, result, expected)
+		}
+
+		var buf bytes.Buffer
+		n, err := v.WriteTo(&buf)
+		if err != nil {
+			t.Fatalf("%T.WriteTo() error = %v", v, err)
+		}
+		if n != int64(len(expected)) || !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("%T.WriteTo() = %q (%d), want %q", v, buf.Bytes(), n, expected)
+		}
+	}
+}
+
+func TestWriter_Streaming(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	w.WriteArrayHeader(3)
+	w.WriteBulkString("a")
+	w.WriteInteger(2)
+	w.WriteValue(Array{Values: []Value{SimpleString{Value: "nested"}}})
+	w.WriteError("ERR nope")
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	expected := "*3\r\n$1\r\na\r\n:2\r\n*1\r\n+nested\r\n-ERR nope\r\n"
+	if buf.String() != expected {
+		t.Errorf("Writer output = %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestWriter_Protocols(t *testing.T) {
+	reply := Map{Entries: []MapEntry{
+		{Key: BulkString{Value: []byte("score")}, Value: Double{Value: 1.5}},
+		{Key: BulkString{Value: []byte("tags")}, Value: Set{Values: []Value{Null{}, Boolean{Value: false}}}},
+	}}
+
+	tests := []struct {
+		proto    int
+		expected string
+	}{
+		{RESP2, "*4\r\n$5\r\nscore\r\n$3\r\n1.5\r\n$4\r\ntags\r\n*2\r\n$-1\r\n:0\r\n"},
+		{RESP3, "%2\r\n$5\r\nscore\r\n,1.5\r\n$4\r\ntags\r\n~2\r\n_\r\n#f\r\n"},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetProtocol(tt.proto)
+		w.WriteValue(reply)
+		w.Flush()
+
+		if buf.String() != tt.expected {
+			t.Errorf("RESP%d output = %q, want %q", tt.proto, buf.String(), tt.expected)
+		}
+
+		// The streamed RESP2 form must match the ToRESP2 tree.
+		if tt.proto == RESP2 && buf.String() != string(ToRESP2(reply).Serialize()) {
+			t.Errorf("RESP2 output = %q, want ToRESP2 encoding %q", buf.String(), ToRESP2(reply).Serialize())
+		}
+	}
+}
+
+func TestWriter_ZeroAlloc(t *testing.T) {
+	w := NewWriter(io.Discard)
+	var value Value = BulkString{Value: []byte("some cached value")}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		w.WriteArrayHeader(2)
+		w.WriteValue(value)
+		w.WriteInteger(12345)
+		w.Flush()
+	})
+	if allocs != 0 {
+		t.Errorf("Writer allocated %v times per reply, want 0", allocs)
+	}
+}
+
+// aliasWriter records whether it was handed the end of payload itself, rather
+// than a copy. (bufio.Writer may copy the start of a large write to fill its
+// buffer before passing the rest through.)
+type aliasWriter struct {
+	payload []byte
+	aliased bool
+	bytes.Buffer
+}
+
+func (w *aliasWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 && &p[len(p)-1] == &w.payload[len(w.payload)-1] {
+		w.aliased = true
+	}
+	return w.Buffer.Write(p)
+}
+
+// Large bulk strings go to the writer as they are, not through a copy.
+func TestBulkString_LargePayload(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+	value := BulkString{Value: payload}
+	expected := value.Serialize()
+
+	w := &aliasWriter{payload: payload}
+	if n, err := value.WriteTo(w); err != nil || n != int64(len(expected)) || !bytes.Equal(w.Bytes(), expected) {
+		t.Errorf("WriteTo() = %d, %v; want %d bytes of the encoding", n, err, len(expected))
+	}
+	if !w.aliased {
+		t.Errorf("WriteTo() copied the payload")
+	}
+
+	w = &aliasWriter{payload: payload}
+	rw := NewWriter(w)
+	if err := rw.WriteValue(value); err != nil || rw.Flush() != nil || !bytes.Equal(w.Bytes(), expected) {
+		t.Errorf("Writer.WriteValue() = %v; want the encoding", err)
+	}
+	if !w.aliased {
+		t.Errorf("Writer.WriteValue() copied the payload")
+	}
+
+	rw = NewWriter(io.Discard)
+	var v Value = value
+	allocs := testing.AllocsPerRun(10, func() {
+		rw.WriteValue(v)
+	})
+	if allocs != 0 {
+		t.Errorf("Writer.WriteValue() of a 1MB bulk string allocated %v times; want no copy of the payload", allocs)
+	}
+}
+
+func BenchmarkBulkString_Serialize(b *testing.B) {
+	value := BulkString{Value: []byte("some cached value")}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		io.Discard.Write(value.Serialize())
+	}
+}
+
+func BenchmarkWriter_WriteValue(b *testing.B) {
+	w := NewWriter(io.Discard)
+	var value Value = BulkString{Value: []byte("some cached value")}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.WriteValue(value)
+	}
+	w.Flush()
+}
+
+func TestBulkString_BinaryRoundTrip(t *testing.T) {
+	payload := []byte{0x00, '\r', '\n', 0xfe, 0xff}
+	b := BulkString{Value: payload}
+
+	result, err := Deserialize(bufio.NewReader(bytes.NewReader(b.Serialize())))
+	if err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	if !reflect.DeepEqual(result, b) {
+		t.Errorf("Deserialize() = %q, want %q", result, b)
+	}
+
+	// Large payloads are written through without being copied into the buffer.
+	large := BulkString{Value: bytes.Repeat([]byte{0, 1, 2, 3}, 4096)}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteBulk(large.Value)
+	w.Flush()
+	if !bytes.Equal(buf.Bytes(), large.Serialize()) {
+		t.Errorf("WriteBulk() of %d bytes produced a different encoding than Serialize()", len(large.Value))
+	}
+}
+
+type testProfile struct {
+	Name    string            `resp:"name"`
+	Age     int               `resp:"age"`
+	Score   float64           `resp:"score"`
+	Admin   bool              `resp:"admin"`
+	Tags    []string          `resp:"tags"`
+	Limits  map[string]int64  `resp:"limits"`
+	Nick    string            `resp:"nick,omitempty"`
+	Secret  string            `resp:"-"`
+	Manager *testProfile      `resp:"manager"`
+	Extra   map[string]string `resp:"extra,omitempty"`
+}
+
+func TestMarshal(t *testing.T) {
+	profile := testProfile{
+		Name:   "alice",
+		Age:    30,
+		Score:  9.5,
+		Admin:  true,
+		Tags:   []string{"a", "b"},
+		Limits: map[string]int64{"rps": 100, "burst": 10},
+		Secret: "hidden",
+	}
+
+	result, err := Marshal(profile)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	expected := Map{Entries: []MapEntry{
+		{Key: BulkString{Value: []byte("name")}, Value: BulkString{Value: []byte("alice")}},
+		{Key: BulkString{Value: []byte("age")}, Value: Integer{Value: 30}},
+		{Key: BulkString{Value: []byte("score")}, Value: Double{Value: 9.5}},
+		{Key: BulkString{Value: []byte("admin")}, Value: Boolean{Value: true}},
+		{Key: BulkString{Value: []byte("tags")}, Value: Array{Values: []Value{BulkString{Value: []byte("a")}, BulkString{Value: []byte("b")}}}},
+		{Key: BulkString{Value: []byte("limits")}, Value: Map{Entries: []MapEntry{
+			{Key: BulkString{Value: []byte("burst")}, Value: Integer{Value: 10}},
+			{Key: BulkString{Value: []byte("rps")}, Value: Integer{Value: 100}},
+		}}},
+		{Key: BulkString{Value: []byte("manager")}, Value: Null{}},
+	}}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Marshal() = %v, want %v", result, expected)
+	}
+
+	if _, err := Marshal(make(chan int)); err == nil {
+		t.Errorf("Marshal(chan) should return an error")
+	}
+}
+
+func TestUnmarshal_RoundTrip(t *testing.T) {
+	profile := testProfile{
+		Name:    "bob",
+		Age:     41,
+		Score:   -1.25,
+		Tags:    []string{"x"},
+		Limits:  map[string]int64{"rps": 5},
+		Nick:    "bobby",
+		Manager: &testProfile{Name: "carol", Age: 50},
+	}
+
+	value, err := Marshal(profile)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	// Both the RESP3 map and its flattened RESP2 form decode to the same struct.
+	for _, v := range []Value{value, ToRESP2(value)} {
+		var decoded testProfile
+		if err := Unmarshal(v, &decoded); err != nil {
+			t.Fatalf("Unmarshal(%T) error = %v", v, err)
+		}
+		if !reflect.DeepEqual(decoded, profile) {
+			t.Errorf("Unmarshal(%T) = %+v, want %+v", v, decoded, profile)
+		}
+	}
+}
+
+func TestUnmarshal_Conversions(t *testing.T) {
+	var n int64
+	if err := Unmarshal(BulkString{Value: []byte("42")}, &n); err != nil || n != 42 {
+		t.Errorf("Unmarshal(bulk 42) = %d, %v; want 42", n, err)
+	}
+
+	var small int8
+	if err := Unmarshal(Integer{Value: 300}, &small); err == nil {
+		t.Errorf("Unmarshal(300) into int8 should overflow")
+	}
+
+	var f float64
+	if err := Unmarshal(BulkString{Value: []byte("3.5")}, &f); err != nil || f != 3.5 {
+		t.Errorf("Unmarshal(bulk 3.5) = %v, %v; want 3.5", f, err)
+	}
+
+	var b bool
+	if err := Unmarshal(Integer{Value: 1}, &b); err != nil || !b {
+		t.Errorf("Unmarshal(:1) into bool = %v, %v; want true", b, err)
+	}
+
+	s := "previous"
+	if err := Unmarshal(BulkString{IsNull: true}, &s); err != nil || s != "" {
+		t.Errorf("Unmarshal(null) into string = %q, %v; want empty", s, err)
+	}
+
+	var anything any
+	if err := Unmarshal(Array{Values: []Value{Integer{Value: 1}, SimpleString{Value: "two"}, Null{}}}, &anything); err != nil {
+		t.Fatalf("Unmarshal() into any error = %v", err)
+	}
+	if !reflect.DeepEqual(anything, []any{int64(1), "two", nil}) {
+		t.Errorf("Unmarshal() into any = %#v", anything)
+	}
+
+	var raw Value
+	if err := Unmarshal(Integer{Value: 7}, &raw); err != nil || raw != (Integer{Value: 7}) {
+		t.Errorf("Unmarshal() into Value = %#v, %v", raw, err)
+	}
+
+	var str string
+	err := Unmarshal(Error{Value: "ERR boom"}, &str)
+	if replyErr, ok := err.(Error); !ok || replyErr.Value != "ERR boom" {
+		t.Errorf("Unmarshal(error reply) error = %v, want the reply", err)
+	}
+
+	if err := Unmarshal(Integer{Value: 1}, str); err == nil {
+		t.Errorf("Unmarshal() into non-pointer should return an error")
+	}
+	if err := Unmarshal(Map{}, &n); err == nil {
+		t.Errorf("Unmarshal(map) into int64 should return an error")
+	}
+}
@@ -1,30 +1,97 @@
 package resp
 
 import (
-	"bytes"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Predefined CRLF constant
 var crlf = []byte("\r\n")
 
 type Value interface {
+	// Serialize returns the RESP encoding of the value in a new slice.
 	Serialize() []byte
+	// AppendTo appends the RESP encoding of the value to dst and returns the
+	// extended slice, allocating only if dst runs out of capacity.
+	AppendTo(dst []byte) []byte
+	// WriteTo writes the RESP encoding of the value to w. Aggregates are
+	// written element by element instead of being encoded up front.
+	WriteTo(w io.Writer) (int64, error)
 	String() string
 }
 
+// Scratch buffers used by WriteTo, so scalar values can be encoded without
+// allocating.
+var scratchPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, scratchSize)
+		return &buf
+	},
+}
+
+// scratchSize is the initial capacity of a scratch buffer. Bulk payloads
+// longer than this are written straight from the value instead.
+const scratchSize = 512
+
+// Buffers that grew beyond this are dropped instead of returned to the pool.
+const maxPooledScratch = 64 * 1024
+
+// writeEncoded writes the AppendTo encoding of v to w using a pooled buffer.
+func writeEncoded(w io.Writer, v Value) (int64, error) {
+	bp := scratchPool.Get().(*[]byte)
+	buf := v.AppendTo((*bp)[:0])
+	n, err := w.Write(buf)
+	if cap(buf) <= maxPooledScratch {
+		*bp = buf
+		scratchPool.Put(bp)
+	}
+	return int64(n), err
+}
+
+// writeHeader writes an aggregate header such as *3\r\n.
+func writeHeader(w io.Writer, prefix byte, n int) (int64, error) {
+	var buf [24]byte
+	written, err := w.Write(appendHeader(buf[:0], prefix, n))
+	return int64(written), err
+}
+
+func appendHeader(dst []byte, prefix byte, n int) []byte {
+	dst = append(dst, prefix)
+	dst = strconv.AppendInt(dst, int64(n), 10)
+	return append(dst, crlf...)
+}
+
+// writeValues writes values one after another, stopping at the first error.
+func writeValues(w io.Writer, written int64, values []Value) (int64, error) {
+	for _, v := range values {
+		n, err := v.WriteTo(w)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
 /*Simple String Type*/
 type SimpleString struct {
 	Value string
 }
 
 func (s SimpleString) Serialize() []byte {
-	buf := make([]byte, 0, 1+len(s.Value)+2)
-	buf = append(buf, '+')
-	buf = append(buf, s.Value...)
-	buf = append(buf, crlf...)
-	return buf
+	return s.AppendTo(make([]byte, 0, 1+len(s.Value)+2))
+}
+
+func (s SimpleString) AppendTo(dst []byte) []byte {
+	dst = append(dst, '+')
+	dst = append(dst, s.Value...)
+	return append(dst, crlf...)
+}
+
+func (s SimpleString) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, s)
 }
 
 func (s SimpleString) String() string {
@@ -37,39 +104,64 @@ type Error struct {
 }
 
 func (e Error) Serialize() []byte {
-	buf := make([]byte, 0, 1+len(e.Value)+2)
-	buf = append(buf, '-')
-	buf = append(buf, e.Value...)
-	buf = append(buf, crlf...)
-	return buf
+	return e.AppendTo(make([]byte, 0, 1+len(e.Value)+2))
+}
+
+func (e Error) AppendTo(dst []byte) []byte {
+	dst = append(dst, '-')
+	dst = append(dst, e.Value...)
+	return append(dst, crlf...)
+}
+
+func (e Error) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, e)
 }
 
 func (e Error) String() string {
 	return e.Value
 }
 
+// Error makes an error reply usable as a Go error.
+func (e Error) Error() string {
+	return e.Value
+}
+
 /*Integer Type*/
 type Integer struct {
 	Value int64
 }
 
 func (i Integer) Serialize() []byte {
-	buf := make([]byte, 0, 23)
-	buf = append(buf, ':')
-	buf = strconv.AppendInt(buf, i.Value, 10)
-	buf = append(buf, crlf...)
-	return buf
+	return i.AppendTo(make([]byte, 0, 23))
+}
+
+func (i Integer) AppendTo(dst []byte) []byte {
+	dst = append(dst, ':')
+	dst = strconv.AppendInt(dst, i.Value, 10)
+	return append(dst, crlf...)
+}
+
+func (i Integer) WriteTo(w io.Writer) (int64, error) {
+	return writeEncoded(w, i)
 }
 
 func (i Integer) String() string {
 	return strconv.FormatInt(i.Value, 10)
 }
 
+// BulkString is a binary-safe string. Value is used as-is, without copying,
+// both when encoding and when returned by the decoder, so a decoded payload
+// can be handed on (e.g. stored) without further allocations.
 type BulkString struct {
-	Value  string
+	Value  []byte
 	IsNull bool
 }
 
+// NewBulkString returns a BulkString holding a copy of s.
+func NewBulkString(s string) BulkString {
+	return BulkString{Value: []byte(s)}
+}
+
 // Predefined Null Bulk String constant
 var nullBulkBytes = []byte("$-1\r\n")
 var emptyBulkBytes = []byte("$0\r\n\r\n") // Optimization for empty string
@@ -83,17 +175,35 @@ func (b BulkString) Serialize() []byte {
 		return emptyBulkBytes // Specific optimization for empty string
 	}
 
-	// Format: $<length>\r\n<value>\r\n
-	lenStr := strconv.Itoa(len(b.Value)) // Still need string length
-	// Estimate size: 1 ('$') + len(lenStr) + 2 + len(value) + 2
-	buf := make([]byte, 0, 1+len(lenStr)+2+len(b.Value)+2)
+	// Estimate size: 1 ('$') + up to 20 length digits + 2 + len(value) + 2
+	return b.AppendTo(make([]byte, 0, 1+20+2+len(b.Value)+2))
+}
+
+// AppendTo appends $<length>\r\n<value>\r\n, or the null bulk string.
+func (b BulkString) AppendTo(dst []byte) []byte {
+	if b.IsNull {
+		return append(dst, nullBulkBytes...)
+	}
+	return appendBlob(dst, '$', b.Value)
+}
 
-	buf = append(buf, '$')
-	buf = append(buf, lenStr...)
-	buf = append(buf, crlf...)
-	buf = append(buf, b.Value...)
-	buf = append(buf, crlf...)
-	return buf
+// WriteTo writes the bulk string to w. Large payloads are written as they
+// are, between the header and CRLF, rather than copied into a buffer.
+func (b BulkString) WriteTo(w io.Writer) (int64, error) {
+	if b.IsNull || len(b.Value) <= scratchSize {
+		return writeEncoded(w, b)
+	}
+	written, err := writeHeader(w, '$', len(b.Value))
+	if err != nil {
+		return written, err
+	}
+	n, err := w.Write(b.Value)
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	n, err = w.Write(crlf)
+	return written + int64(n), err
 }
 
 // String returns a human-readable representation of BulkString
@@ -101,7 +211,7 @@ func (b BulkString) String() string {
 	if b.IsNull {
 		return "(nil)"
 	}
-	return b.Value
+	return string(b.Value)
 }
 
 type Array struct {
@@ -118,18 +228,32 @@ func (a Array) Serialize() []byte {
 		return nullArrayBytes
 	}
 
-	// Use bytes.Buffer as element serialization complexity varies
-	var buf bytes.Buffer
-
-	buf.WriteByte('*')
-	buf.WriteString(strconv.Itoa(len(a.Values))) // WriteString is efficient on buffer
-	buf.Write(crlf)                              // Write CRLF bytes
+	return a.AppendTo(nil)
+}
 
+// AppendTo appends the array header followed by every element, encoding
+// elements directly into dst instead of serializing them separately.
+func (a Array) AppendTo(dst []byte) []byte {
+	if a.IsNull {
+		return append(dst, nullArrayBytes...)
+	}
+	dst = appendHeader(dst, '*', len(a.Values))
 	for _, v := range a.Values {
-		// Assume sub-serializers are also optimized
-		buf.Write(v.Serialize()) // Write serialized bytes of element
+		dst = v.AppendTo(dst)
+	}
+	return dst
+}
+
+func (a Array) WriteTo(w io.Writer) (int64, error) {
+	if a.IsNull {
+		n, err := w.Write(nullArrayBytes)
+		return int64(n), err
+	}
+	n, err := writeHeader(w, '*', len(a.Values))
+	if err != nil {
+		return n, err
 	}
-	return buf.Bytes() // .Bytes() avoids extra copy if possible
+	return writeValues(w, n, a.Values)
 }
 
 func (a Array) String() string {
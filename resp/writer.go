@@ -0,0 +1,232 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+)
+
+// Protocol versions a Writer can encode for.
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// Writer encodes replies directly into a buffered stream. Scalars are encoded
+// into the free space of the underlying bufio.Writer, so writing them does
+// not allocate, and aggregates can be produced incrementally with the
+// Write*Header methods followed by their elements. Large replies therefore
+// never have to exist in memory as a whole.
+//
+// A Writer encodes for one protocol version at a time. In RESP2 mode, RESP3
+// types are downgraded as they are written, using the same rules as ToRESP2.
+//
+// Like bufio.Writer, errors are sticky: once a write fails, every later call
+// returns the same error, so callers may check only the result of Flush.
+type Writer struct {
+	bw    *bufio.Writer
+	proto int
+}
+
+// NewWriter returns a RESP2 Writer on w. If w is already a *bufio.Writer it
+// is used directly.
+func NewWriter(w io.Writer) *Writer {
+	bw, ok := w.(*bufio.Writer)
+	if !ok {
+		bw = bufio.NewWriter(w)
+	}
+	return &Writer{bw: bw, proto: RESP2}
+}
+
+// SetProtocol switches the encoding used for subsequent writes.
+func (w *Writer) SetProtocol(proto int) {
+	w.proto = proto
+}
+
+// Protocol returns the protocol version the Writer encodes for.
+func (w *Writer) Protocol() int {
+	return w.proto
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (w *Writer) Flush() error {
+	return w.bw.Flush()
+}
+
+// Buffered returns the number of bytes waiting to be flushed.
+func (w *Writer) Buffered() int {
+	return w.bw.Buffered()
+}
+
+// WriteValue writes v, streaming aggregates element by element.
+func (w *Writer) WriteValue(v Value) error {
+	switch v := v.(type) {
+	case Array:
+		if v.IsNull {
+			return w.write(append(w.bw.AvailableBuffer(), nullArrayBytes...))
+		}
+		if err := w.WriteArrayHeader(len(v.Values)); err != nil {
+			return err
+		}
+		return w.writeValues(v.Values)
+	case Set:
+		if err := w.WriteSetHeader(len(v.Values)); err != nil {
+			return err
+		}
+		return w.writeValues(v.Values)
+	case Push:
+		if err := w.writeAggregateHeader('>', len(v.Values)); err != nil {
+			return err
+		}
+		return w.writeValues(v.Values)
+	case Map:
+		if err := w.WriteMapHeader(len(v.Entries)); err != nil {
+			return err
+		}
+		return w.writeEntries(v.Entries)
+	case Attribute:
+		// RESP2 has no way to express attributes; only the data survives.
+		if w.proto >= RESP3 {
+			if err := w.write(appendHeader(w.bw.AvailableBuffer(), '|', len(v.Entries))); err != nil {
+				return err
+			}
+			if err := w.writeEntries(v.Entries); err != nil {
+				return err
+			}
+		}
+		return w.WriteValue(v.Value)
+	case BulkString:
+		if v.IsNull {
+			return w.write(append(w.bw.AvailableBuffer(), nullBulkBytes...))
+		}
+		return w.WriteBulk(v.Value)
+	case Null:
+		return w.WriteNull()
+	case Boolean:
+		return w.WriteBoolean(v.Value)
+	case Double:
+		return w.WriteDouble(v.Value)
+	}
+
+	if w.proto < RESP3 {
+		v = ToRESP2(v)
+	}
+	return w.write(v.AppendTo(w.bw.AvailableBuffer()))
+}
+
+// WriteArrayHeader starts an array of n elements.
+func (w *Writer) WriteArrayHeader(n int) error {
+	return w.writeAggregateHeader('*', n)
+}
+
+// WriteMapHeader starts a map of n key/value pairs. In RESP2 mode this is an
+// array of 2n elements.
+func (w *Writer) WriteMapHeader(n int) error {
+	if w.proto < RESP3 {
+		return w.writeAggregateHeader('*', 2*n)
+	}
+	return w.writeAggregateHeader('%', n)
+}
+
+// WriteSetHeader starts a set of n elements. In RESP2 mode this is an array.
+func (w *Writer) WriteSetHeader(n int) error {
+	return w.writeAggregateHeader('~', n)
+}
+
+func (w *Writer) WriteSimpleString(s string) error {
+	return w.write(SimpleString{Value: s}.AppendTo(w.bw.AvailableBuffer()))
+}
+
+func (w *Writer) WriteError(s string) error {
+	return w.write(Error{Value: s}.AppendTo(w.bw.AvailableBuffer()))
+}
+
+func (w *Writer) WriteInteger(n int64) error {
+	return w.write(Integer{Value: n}.AppendTo(w.bw.AvailableBuffer()))
+}
+
+func (w *Writer) WriteBulkString(s string) error {
+	return w.write(appendBlob(w.bw.AvailableBuffer(), '$', s))
+}
+
+// WriteBulk writes b as a bulk string. Payloads that do not fit the free
+// buffer space are passed through without an intermediate copy.
+func (w *Writer) WriteBulk(b []byte) error {
+	if len(b) > w.bw.Available() {
+		if err := w.write(appendHeader(w.bw.AvailableBuffer(), '$', len(b))); err != nil {
+			return err
+		}
+		if err := w.write(b); err != nil {
+			return err
+		}
+		return w.write(crlf)
+	}
+	return w.write(appendBlob(w.bw.AvailableBuffer(), '$', b))
+}
+
+// WriteNull writes the null reply: _ in RESP3, a null bulk string in RESP2.
+func (w *Writer) WriteNull() error {
+	if w.proto < RESP3 {
+		return w.write(append(w.bw.AvailableBuffer(), nullBulkBytes...))
+	}
+	return w.write(append(w.bw.AvailableBuffer(), nullBytes...))
+}
+
+// WriteBoolean writes a boolean, or the integer 1/0 in RESP2 mode.
+func (w *Writer) WriteBoolean(b bool) error {
+	if w.proto < RESP3 {
+		if b {
+			return w.WriteInteger(1)
+		}
+		return w.WriteInteger(0)
+	}
+	return w.write(Boolean{Value: b}.AppendTo(w.bw.AvailableBuffer()))
+}
+
+// WriteDouble writes a double, or its bulk string form in RESP2 mode.
+func (w *Writer) WriteDouble(f float64) error {
+	if w.proto < RESP3 {
+		var digits [32]byte
+		formatted := appendFloat(digits[:0], f)
+		buf := appendHeader(w.bw.AvailableBuffer(), '$', len(formatted))
+		buf = append(buf, formatted...)
+		return w.write(append(buf, crlf...))
+	}
+	return w.write(Double{Value: f}.AppendTo(w.bw.AvailableBuffer()))
+}
+
+// writeAggregateHeader writes a header for prefix, or the equivalent array
+// header in RESP2 mode.
+func (w *Writer) writeAggregateHeader(prefix byte, n int) error {
+	if w.proto < RESP3 {
+		prefix = '*'
+	}
+	return w.write(appendHeader(w.bw.AvailableBuffer(), prefix, n))
+}
+
+func (w *Writer) writeValues(values []Value) error {
+	for _, v := range values {
+		if err := w.WriteValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) writeEntries(entries []MapEntry) error {
+	for _, e := range entries {
+		if err := w.WriteValue(e.Key); err != nil {
+			return err
+		}
+		if err := w.WriteValue(e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write hands buf to the bufio.Writer. When buf was built in the writer's
+// available buffer this is a no-copy commit of the encoded bytes.
+func (w *Writer) write(buf []byte) error {
+	_, err := w.bw.Write(buf)
+	return err
+}